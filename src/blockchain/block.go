@@ -1,13 +1,93 @@
 package blockchain
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // ============================ Block ============================
 
+// BLOCK_TIME_FORMAT is the format of every block's Timestamp. Timestamps are read back when the proof of work
+// difficulty is retargeted, so they must be written in a format that every peer parses the same way
+const BLOCK_TIME_FORMAT = time.RFC3339Nano
+
+// BlockHeader contains the fields of a Block that are hashed to produce its proof. The Block's Data is
+// committed to through the MerkleRoot, so hashing the header is enough to protect every transaction. Target is
+// the proof of work target that the block's hash had to meet, and is empty for consensus components that don't
+// use one. Consensus components whose blocks must come from a particular producer, such as proof of stake, have
+// the producer sign the block: PublicKey is the producer's key, which is hashed with the rest of the header, and
+// Signature is made over the block's hash, so it is the only field that isn't hashed
+type BlockHeader struct {
+	Index      int
+	Timestamp  string
+	PrevHash   string
+	MerkleRoot string
+	Nonce      int
+	Miner      string
+	Target     string
+	PublicKey  string
+	Signature  string
+}
+
 // Block is the Block object
 type Block struct {
-	Index     int
-	Timestamp string
-	Data      Data
-	PrevHash  string
-	Hash      string
-	Nonce     int
+	BlockHeader
+	Data []Data
+	Hash string
+}
+
+// ToString transforms the header into the record string that is hashed by the consensus components, which is its
+// canonical encoding, see BlockHeaderHashingBytes
+func (h BlockHeader) ToString() string {
+	return string(BlockHeaderHashingBytes(h))
+}
+
+// Time parses the header's Timestamp
+func (h BlockHeader) Time() (time.Time, error) {
+	return time.Parse(BLOCK_TIME_FORMAT, h.Timestamp)
+}
+
+// newTimestamp returns the current time as a block Timestamp
+func newTimestamp() string {
+	return time.Now().UTC().Format(BLOCK_TIME_FORMAT)
+}
+
+// blockJSON is the form a Block takes when encoded as JSON, with each of its Data entries tagged with its type
+type blockJSON struct {
+	BlockHeader
+	Data []taggedData
+	Hash string
+}
+
+// MarshalJSON is a custom JSON marshaller that tags each of the Block's Data entries with its type
+func (b Block) MarshalJSON() ([]byte, error) {
+
+	data, err := encodeDataList(b.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(blockJSON{BlockHeader: b.BlockHeader, Data: data, Hash: b.Hash})
+}
+
+// UnmarshalJSON is a custom JSON unmarshaller that decodes each of the Block's Data entries using the decoder
+// registered for its type
+func (b *Block) UnmarshalJSON(bytes []byte) error {
+
+	var raw blockJSON
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+
+	data, err := decodeDataList(raw.Data)
+	if err != nil {
+		return err
+	}
+
+	b.BlockHeader = raw.BlockHeader
+	b.Data = data
+	b.Hash = raw.Hash
+
+	return nil
 }
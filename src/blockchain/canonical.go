@@ -0,0 +1,305 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// ============================ Canonical Encoding ============================
+
+// TRANSACTION_SIGNING_DOMAIN is written at the start of the signing bytes of every transaction, so a transaction
+// signature can never be mistaken for a signature over any other kind of record
+const TRANSACTION_SIGNING_DOMAIN = "blockchain-for-education/transaction/v2"
+
+// STAKING_SIGNING_DOMAIN is written at the start of the signing bytes of transactions that bond or unbond stake
+// instead, so a signed transfer can never be replayed as a change to the sender's stake, or the other way around
+const STAKING_SIGNING_DOMAIN = "blockchain-for-education/staking/v1"
+
+// BLOCK_HEADER_DOMAIN, BLOCK_SIGNING_DOMAIN, ELECTION_ENTRY_SIGNING_DOMAIN and ELECTION_SEED_DOMAIN do the same for
+// the hashes of block headers, the signatures of block producers, the signatures of proof of stake election entries
+// and the randomness of elections
+const (
+	BLOCK_HEADER_DOMAIN           = "blockchain-for-education/block-header/v1"
+	BLOCK_SIGNING_DOMAIN          = "blockchain-for-education/block/v1"
+	ELECTION_ENTRY_SIGNING_DOMAIN = "blockchain-for-education/election-entry/v1"
+	ELECTION_SEED_DOMAIN          = "blockchain-for-education/election-seed/v1"
+)
+
+// canonicalEncoder builds the canonical byte encoding of a record, which doesn't depend on how any programming
+// language orders or formats fields. Every field is written in a fixed order: strings as their length, a 4 byte
+// big-endian unsigned integer, followed by their UTF-8 bytes, and integers as 8 byte big-endian two's complement
+// numbers. Since every string is prefixed with its length, no two different records share an encoding
+type canonicalEncoder struct {
+	buffer bytes.Buffer
+}
+
+// writeString appends a length prefixed string to the encoding
+func (e *canonicalEncoder) writeString(s string) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+	e.buffer.Write(length[:])
+	e.buffer.WriteString(s)
+}
+
+// writeInt appends a 64 bit integer to the encoding
+func (e *canonicalEncoder) writeInt(i int) {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], uint64(int64(i)))
+	e.buffer.Write(encoded[:])
+}
+
+// bytes returns the encoding
+func (e *canonicalEncoder) bytes() []byte {
+	return e.buffer.Bytes()
+}
+
+// TransactionSigningBytes returns the canonical encoding of a transaction that its signature is made over. It holds
+// TRANSACTION_SIGNING_DOMAIN, From, To, Amount, Nonce, Fee and PublicKey, in that order, and never the signature itself.
+// Transactions that bond or unbond stake hold STAKING_SIGNING_DOMAIN, Kind, From, Amount, Nonce, Fee and PublicKey
+// instead. Tools written in other languages produce valid signatures by building the same bytes, hashing them with
+// SHA-256 and signing the hash, see the README
+func TransactionSigningBytes(t Transaction) []byte {
+
+	var e canonicalEncoder
+	if t.Kind != "" {
+		e.writeString(STAKING_SIGNING_DOMAIN)
+		e.writeString(t.Kind)
+		e.writeString(t.From)
+		e.writeInt(t.Amount)
+		e.writeInt(t.Nonce)
+		e.writeInt(t.Fee)
+		e.writeString(t.PublicKey)
+
+		return e.bytes()
+	}
+
+	e.writeString(TRANSACTION_SIGNING_DOMAIN)
+	e.writeString(t.From)
+	e.writeString(t.To)
+	e.writeInt(t.Amount)
+	e.writeInt(t.Nonce)
+	e.writeInt(t.Fee)
+	e.writeString(t.PublicKey)
+
+	return e.bytes()
+}
+
+// BlockHeaderHashingBytes returns the canonical encoding of a block header that the consensus components hash. It
+// holds BLOCK_HEADER_DOMAIN, Index, Timestamp, PrevHash, MerkleRoot, Nonce, Miner, Target and PublicKey, in that order,
+// and never the signature, which is made over the hash
+func BlockHeaderHashingBytes(h BlockHeader) []byte {
+
+	var e canonicalEncoder
+	e.writeString(BLOCK_HEADER_DOMAIN)
+	e.writeInt(h.Index)
+	e.writeString(h.Timestamp)
+	e.writeString(h.PrevHash)
+	e.writeString(h.MerkleRoot)
+	e.writeInt(h.Nonce)
+	e.writeString(h.Miner)
+	e.writeString(h.Target)
+	e.writeString(h.PublicKey)
+
+	return e.bytes()
+}
+
+// LeafHashingBytes returns the canonical encoding of a Data entry that its Merkle leaf hash is made over, after the
+// prefix that marks it as a leaf. It holds the entry's type tag followed by the canonical encoding of its fields,
+// written as a string, which is produced by the encoder registered for its type, see RegisterPayloadType. Blocks
+// can't carry entries of any other type, so those are only encoded by their tag
+func LeafHashingBytes(d Data) []byte {
+
+	var e canonicalEncoder
+	e.writeString(d.GetType())
+
+	payload, ok := encodePayload(d)
+	if ok {
+		e.writeString(string(payload))
+	}
+
+	return e.bytes()
+}
+
+// BlockSigningBytes returns the canonical encoding of a block that its producer's signature is made over. It holds
+// BLOCK_SIGNING_DOMAIN and the block's Hash, which covers every field of the header, including the producer's
+// public key, except the signature itself
+func BlockSigningBytes(b Block) []byte {
+
+	var e canonicalEncoder
+	e.writeString(BLOCK_SIGNING_DOMAIN)
+	e.writeString(b.Hash)
+
+	return e.bytes()
+}
+
+// ElectionEntrySigningBytes returns the canonical encoding of an election entry that its signature is made over. It
+// holds ELECTION_ENTRY_SIGNING_DOMAIN, Height, PrevHash, Address, Stake, Commitment and PublicKey, in that order, and
+// never the secret, which is only revealed once every entry has been committed to
+func ElectionEntrySigningBytes(entry ElectionEntry) []byte {
+
+	var e canonicalEncoder
+	e.writeString(ELECTION_ENTRY_SIGNING_DOMAIN)
+	e.writeInt(entry.Height)
+	e.writeString(entry.PrevHash)
+	e.writeString(entry.Address)
+	e.writeInt(entry.Stake)
+	e.writeString(entry.Commitment)
+	e.writeString(entry.PublicKey)
+
+	return e.bytes()
+}
+
+// ElectionSeedBytes returns the canonical encoding of an election that its random seed is the SHA-256 hash of. It
+// holds ELECTION_SEED_DOMAIN, Height, PrevHash and Round, followed by the Address and Secret of every entry in the
+// order they are listed
+func ElectionSeedBytes(election Election) []byte {
+
+	var e canonicalEncoder
+	e.writeString(ELECTION_SEED_DOMAIN)
+	e.writeInt(election.Height)
+	e.writeString(election.PrevHash)
+	e.writeInt(election.Round)
+	for _, entry := range election.Entries {
+		e.writeString(entry.Address)
+		e.writeString(entry.Secret)
+	}
+
+	return e.bytes()
+}
+
+// ==================== Payload encodings ========================
+
+// canonicalTransaction encodes a transaction's Kind, From, To, Amount, Nonce, Fee, PublicKey and Signature, in that
+// order
+func canonicalTransaction(d Data) []byte {
+	var e canonicalEncoder
+	e.writeTransaction(d.(Transaction))
+	return e.bytes()
+}
+
+// canonicalCoinbase encodes a coinbase's Height, To and Amount, in that order
+func canonicalCoinbase(d Data) []byte {
+	c := d.(Coinbase)
+
+	var e canonicalEncoder
+	e.writeInt(c.Height)
+	e.writeString(c.To)
+	e.writeInt(c.Amount)
+	return e.bytes()
+}
+
+// canonicalAllocation encodes an allocation's To and Amount, in that order
+func canonicalAllocation(d Data) []byte {
+	a := d.(Allocation)
+
+	var e canonicalEncoder
+	e.writeString(a.To)
+	e.writeInt(a.Amount)
+	return e.bytes()
+}
+
+// canonicalNotarization encodes a notarization's DocumentHash and Description, in that order
+func canonicalNotarization(d Data) []byte {
+	n := d.(Notarization)
+
+	var e canonicalEncoder
+	e.writeString(n.DocumentHash)
+	e.writeString(n.Description)
+	return e.bytes()
+}
+
+// canonicalNote encodes a note's Text
+func canonicalNote(d Data) []byte {
+	var e canonicalEncoder
+	e.writeString(d.(Note).Text)
+	return e.bytes()
+}
+
+// canonicalElection encodes an election's Height, PrevHash and Round, followed by the number of its entries and every
+// entry's Height, PrevHash, Address, Stake, Commitment, PublicKey, Signature and Secret, in the order they are listed
+func canonicalElection(d Data) []byte {
+	var e canonicalEncoder
+	e.writeElection(d.(Election))
+	return e.bytes()
+}
+
+// canonicalSlashingEvidence encodes evidence's Offence followed by its Headers, Block and Election. The headers are
+// written as their number followed by every field of each header, including the signature. The block and the election
+// are written as 0 if they aren't set, or as 1 followed by the block's header fields, its Hash, the number of its data
+// entries and the leaf encoding of each one, or the election's encoding
+func canonicalSlashingEvidence(d Data) []byte {
+	evidence := d.(SlashingEvidence)
+
+	var e canonicalEncoder
+	e.writeString(evidence.Offence)
+
+	e.writeInt(len(evidence.Headers))
+	for _, h := range evidence.Headers {
+		e.writeHeader(h)
+	}
+
+	if evidence.Block == nil {
+		e.writeInt(0)
+	} else {
+		e.writeInt(1)
+		e.writeHeader(evidence.Block.BlockHeader)
+		e.writeString(evidence.Block.Hash)
+		e.writeInt(len(evidence.Block.Data))
+		for _, entry := range evidence.Block.Data {
+			e.writeString(string(LeafHashingBytes(entry)))
+		}
+	}
+
+	if evidence.Election == nil {
+		e.writeInt(0)
+	} else {
+		e.writeInt(1)
+		e.writeElection(*evidence.Election)
+	}
+
+	return e.bytes()
+}
+
+// writeTransaction appends every field of a transaction to the encoding
+func (e *canonicalEncoder) writeTransaction(t Transaction) {
+	e.writeString(t.Kind)
+	e.writeString(t.From)
+	e.writeString(t.To)
+	e.writeInt(t.Amount)
+	e.writeInt(t.Nonce)
+	e.writeInt(t.Fee)
+	e.writeString(t.PublicKey)
+	e.writeString(t.Signature)
+}
+
+// writeHeader appends every field of a block header to the encoding, including the signature
+func (e *canonicalEncoder) writeHeader(h BlockHeader) {
+	e.writeInt(h.Index)
+	e.writeString(h.Timestamp)
+	e.writeString(h.PrevHash)
+	e.writeString(h.MerkleRoot)
+	e.writeInt(h.Nonce)
+	e.writeString(h.Miner)
+	e.writeString(h.Target)
+	e.writeString(h.PublicKey)
+	e.writeString(h.Signature)
+}
+
+// writeElection appends every field of an election and its entries to the encoding
+func (e *canonicalEncoder) writeElection(election Election) {
+	e.writeInt(election.Height)
+	e.writeString(election.PrevHash)
+	e.writeInt(election.Round)
+
+	e.writeInt(len(election.Entries))
+	for _, entry := range election.Entries {
+		e.writeInt(entry.Height)
+		e.writeString(entry.PrevHash)
+		e.writeString(entry.Address)
+		e.writeInt(entry.Stake)
+		e.writeString(entry.Commitment)
+		e.writeString(entry.PublicKey)
+		e.writeString(entry.Signature)
+		e.writeString(entry.Secret)
+	}
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The vectors that the README gives for checking other implementations of the canonical encoding
+
+// readmeTransaction returns the transaction of the README's signing example
+func readmeTransaction() Transaction {
+	return Transaction{From: strings.Repeat("a", 40), To: strings.Repeat("b", 40), Amount: 5, Nonce: 0, Fee: 1, PublicKey: "02" + strings.Repeat("1", 62)}
+}
+
+func TestReadmeVectors(t *testing.T) {
+
+	signed := readmeTransaction()
+	signed.Signature = "3045"
+
+	header := BlockHeader{
+		Index:      1,
+		Timestamp:  "2024-01-01T00:00:00Z",
+		PrevHash:   "0",
+		MerkleRoot: strings.Repeat("c", 64),
+		Nonce:      7,
+		Miner:      strings.Repeat("d", 40),
+		Target:     "0f" + strings.Repeat("f", 62)}
+
+	tests := []struct {
+		name     string
+		hash     string
+		expected string
+	}{
+		{"transaction signing hash", hex.EncodeToString(transactionSigningHash(readmeTransaction())), "d6957126f42d1a05d7df48118b023b738fa2300d2ebbf2fcca9a4b30d88db7ac"},
+		{"header hash", (&ProofOfWork{}).CalculateHash(Block{BlockHeader: header}), "0a76c73676c00e2e27423ad84b3a61d842e7042367de54f34fce51a25bc4fb6c"},
+		{"signed header hash", signedHash(header), "0a76c73676c00e2e27423ad84b3a61d842e7042367de54f34fce51a25bc4fb6c"},
+		{"note leaf hash", LeafHash(Note{Text: "hello"}), "e5b7ecb1e5bc2e469b7458fbd7d83b93b2bc66ea7ccdead8873ed3206ea75e5a"},
+		{"transaction leaf hash", LeafHash(signed), "01369b15774e84700a35448419b1bc42a505981c0796824eb15e76b7095b1428"},
+	}
+
+	for _, test := range tests {
+		if test.hash != test.expected {
+			t.Errorf("%s is %s, the README gives %s", test.name, test.hash, test.expected)
+		}
+	}
+}
+
+func TestSigningHashCoversEveryFieldButTheSignature(t *testing.T) {
+
+	base := hex.EncodeToString(transactionSigningHash(readmeTransaction()))
+
+	tests := []struct {
+		name   string
+		change func(t *Transaction)
+		same   bool
+	}{
+		{"kind", func(t *Transaction) { t.Kind = TRANSACTION_STAKE }, false},
+		{"sender", func(t *Transaction) { t.From = strings.Repeat("e", 40) }, false},
+		{"recipient", func(t *Transaction) { t.To = strings.Repeat("e", 40) }, false},
+		{"amount", func(t *Transaction) { t.Amount = 6 }, false},
+		{"nonce", func(t *Transaction) { t.Nonce = 1 }, false},
+		{"fee", func(t *Transaction) { t.Fee = 2 }, false},
+		{"public key", func(t *Transaction) { t.PublicKey = "03" + strings.Repeat("1", 62) }, false},
+		{"signature", func(t *Transaction) { t.Signature = "3045" }, true},
+	}
+
+	for _, test := range tests {
+		changed := readmeTransaction()
+		test.change(&changed)
+
+		same := hex.EncodeToString(transactionSigningHash(changed)) == base
+		if same != test.same {
+			t.Errorf("changing the %s changes the signing hash: %v", test.name, !same)
+		}
+	}
+}
@@ -5,34 +5,66 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"math/big"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const MIDDLEWARE_URL = "http://localhost:8090/newTransaction"
+const MIDDLEWARE_URL = "http://localhost:8090"
+
+// DEFAULT_ACCOUNT is the name of the keystore account that a Client uses if no other account is chosen
+const DEFAULT_ACCOUNT = "default"
 
 var commandDescriptions = [][]string{
 	{"help", "Lists all valid commands with their descriptions."},
-	{"transaction", "Prompts user for recipient and amount values to send a new transaction. Expected input is of the form 'index of recipient in peers list,amount'. For example, '1,5' excluding the apostrophes."},
-	{"peers", "Lists all of the peers on the network that the user can send currency to.\nExample output:\n'index=1, ip=::1, port=55514'"},
+	{"transaction", "Prompts user for recipient, amount and optional fee values to send a new transaction. Expected input is of the form 'recipient wallet address,amount[,fee]'. For example, '3f1c9a...,5,1' excluding the apostrophes. Transactions with higher fees are mined first."},
+	{"address", "Prints out the user's wallet address, which other users send currency to."},
+	{"peers", "Lists all of the peers on the network.\nExample output:\n'index=1, ip=::1, port=55514'"},
 	{"bal", "Prints out the user's current wallet balance."},
+	{"balances", "Lists the balance of every account on the chain."},
+	{"supply", "Prompts user for a block height, and prints out the supply of currency once that block was added to the chain, along with the network's reward schedule. Leave the height empty for the latest block."},
+	{"stake", "Prompts user for an amount and optional fee, and bonds that much of the user's balance as stake, which makes the user a proof of stake validator. Expected input is of the form 'amount[,fee]'."},
+	{"unstake", fmt.Sprintf("Prompts user for an amount and optional fee, and unbonds that much of the user's stake. Unbonded stake can be spent once %d more blocks have been added to the chain. Expected input is of the form 'amount[,fee]'.", UNBONDING_PERIOD)},
+	{"validators", "Lists the validator set, which is every account with bonded stake, along with the stake each account is unbonding."},
+	{"stats", "Prints out the statistics of this Peer's recent proof of work mining sessions, such as the number of hashes tried, how long each session took and the hash rate."},
+	{"notarize", "Prompts user for the path of a file, and records the file's SHA-256 hash on the chain to prove that it existed at that time."},
+	{"note", "Prompts user for a short text message and records it on the chain."},
+	{"verify", "Prompts user for a block index and transaction hash, and checks that the transaction is included in that block using a Merkle proof. Expected input is of the form 'block index,transaction hash'."},
+	{"accounts", "Lists the accounts in the keystore, marking the account that is in use."},
+	{"newaccount", "Prompts user for a name and passphrase, and creates a new account in the keystore."},
+	{"switch", "Prompts user for the name and passphrase of an account in the keystore, and uses it from now on."},
+	{"import", "Prompts user for a name, a private key exported from another keystore and a passphrase, and saves the key as a new account."},
+	{"export", "Prompts user for the passphrase of the account in use, and prints out its private key. Anyone with the key can spend the account's funds."},
 }
 
 // ============================ Client ============================
 
+// Client implements ClientComponent, and reads commands from the console unless it is Headless, which is needed
+// when several Peers run in one process. Transactions and payloads are submitted to the Middleware's http server at
+// MiddlewareURL, which defaults to MIDDLEWARE_URL.
+//
+// The Client's key is loaded from the named Account, or DEFAULT_ACCOUNT, in the keystore at KeystoreDirectory, and
+// the account is created if it doesn't exist yet. The passphrase is asked for on the console, unless Passphrase is
+// set. Without a KeystoreDirectory, a new key is generated that is lost when the Peer exits
 type Client struct {
-	publicKey           ecdsa.PublicKey
-	peerPublicKeys      map[int]*ecdsa.PublicKey
+	Headless            bool
+	MiddlewareURL       string
+	KeystoreDirectory   string
+	Account             string
+	Passphrase          string
 	privateKey          *ecdsa.PrivateKey
 	peer                *Peer
 	commandDescriptions [][]string
@@ -46,32 +78,26 @@ func (c *Client) Initialize(com CommunicationComponent, p *Peer) error {
 	c.communicator = com
 	c.peer = p
 
-	// Generate public and private keys for digital signing
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return err
-	}
-
-	c.privateKey = privateKey
-	c.publicKey = c.privateKey.PublicKey
-
-	// Initialize peerPublicKeys map
-	c.peerPublicKeys = make(map[int]*ecdsa.PublicKey)
-
-	// Broadcast public key and get Peers' public keys on startup
-	data := c.ecdsaPublicKeytoPublicKey()
-	toSend, err := com.GenerateMessage("PUBLIC_KEYS", data)
-	if err != nil {
-		log.Printf("Error generating message: %v\n", err)
-	}
+	if c.KeystoreDirectory != "" {
+		// Load the key for digital signing from the keystore, so the wallet survives restarts
+		err := c.unlockAccount()
+		if err != nil {
+			return err
+		}
+	} else {
+		// Generate public and private keys for digital signing
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
 
-	err = com.BroadcastMsgToNetwork(toSend)
-	if err != nil {
-		log.Printf("Error sending Public Key to Peer: %v\n", err)
+		c.privateKey = privateKey
 	}
 
 	// Start a new thread running the sendTransaction method after the Peer has had some time to initialize
-	time.AfterFunc(3*time.Second, c.sendTransaction)
+	if !c.Headless {
+		time.AfterFunc(3*time.Second, c.sendTransaction)
+	}
 
 	return nil
 }
@@ -81,85 +107,55 @@ func (c Client) Terminate() {
 	// No clean-up needed for this implementation
 }
 
-func (c Client) addPublicKey(pk PublicKey, peer PeerAddress) {
-
-	publicKey := hexToPublicKey(pk.X, pk.Y)
+// GetAddress is the interface retriever method that returns the wallet address of this Client's key
+func (c Client) GetAddress() string {
+	return AddressFromPublicKey(&c.privateKey.PublicKey)
+}
 
-	for port := range c.peerPublicKeys {
-		// If we already have a key registered for the peer, just return
-		if peer.Address.Port == port {
-			return
-		}
-	}
-	// fmt.Println("DEBUG - Adding new public key")
-	c.peerPublicKeys[peer.Address.Port] = publicKey
+// GetPublicKey is the interface retriever method that returns the encoded public key of this Client's key
+func (c Client) GetPublicKey() string {
+	return EncodePublicKey(&c.privateKey.PublicKey)
 }
 
+// Sign is the interface method that signs a transaction from this Client's wallet address
 func (c Client) Sign(t Transaction) (Transaction, error) {
-	hash := t.ToString()
-	signature, err := ecdsa.SignASN1(rand.Reader, c.privateKey, []byte(hash))
-	if err != nil {
-		return t, err
-	}
-	t.Signature = hex.EncodeToString(signature)
-	return t, nil
+	return SignTransaction(t, c.privateKey)
 }
 
-func (c Client) Verify(t Transaction) bool {
-
-	mapKey, _ := strconv.Atoi(strings.Split(t.From, ":")[1])
-	key := c.peerPublicKeys[mapKey]
-	temp := Transaction{To: t.To, From: t.From, Amount: t.Amount}
-	hash := temp.ToString()
-	sig, _ := hex.DecodeString(t.Signature)
-	return ecdsa.VerifyASN1(key, []byte(hash), sig)
+// SignBlock is the interface method that signs a block produced by this Client's wallet address
+func (c Client) SignBlock(b Block) (Block, error) {
+	return SignBlock(b, c.privateKey)
 }
 
-// HandleCommand is the interface method that handles the passed message
-func (c *Client) HandleCommand(msg Message, com CommunicationComponent) (err error) {
-
-	switch msg.Command {
-	case "PUBLIC_KEY":
-		go func() {
-			log.Println("Received Peer's Public Key")
-			publicKey := msg.Data.(PublicKey)
-			c.addPublicKey(publicKey, msg.From)
-		}()
-
-	case "PUBLIC_KEYS":
-		go func() {
-			log.Println("Received request for Peer's Public Key, sending...")
-
-			publicKey := msg.Data.(PublicKey)
-			c.addPublicKey(publicKey, msg.From)
-			data := c.ecdsaPublicKeytoPublicKey()
-			toSend, err := com.GenerateMessage("PUBLIC_KEY", data)
-			if err != nil {
-				log.Printf("Error generating message: %v\n", err)
-			}
-
-			err = com.SendMsgToPeer(toSend, msg.From)
-			if err != nil {
-				log.Printf("Error sending Public Key to Peer: %v\n", err)
-			}
-		}()
-
-	default:
-		err = errors.New("command not supported")
-	}
+// SignElectionEntry is the interface method that signs a proof of stake election entry from this Client's wallet address
+func (c Client) SignElectionEntry(e ElectionEntry) (ElectionEntry, error) {
+	return SignElectionEntry(e, c.privateKey)
+}
 
-	return err
+// Verify is the interface method that checks a transaction's signature against the public key that it carries
+func (c Client) Verify(t Transaction) bool {
+	return VerifyTransaction(t) == nil
+}
 
+// HandleCommand is the interface method that handles the passed message. This Client doesn't need any commands from
+// the network, as every transaction carries the public key that its signature is checked against
+func (c *Client) HandleCommand(msg Message, com CommunicationComponent) (err error) {
+	return errors.New("command not supported")
 }
 
 // SendTransaction is the interface method that calls this component's cleanup method
-func (c Client) sendTransaction() {
+func (c *Client) sendTransaction() {
 
 	// We run indefinitely
 	for {
 		consoleReader := bufio.NewReader(os.Stdin)
 		log.Println("Enter a command or enter 'help' for a list of commands: ")
-		input, _ := consoleReader.ReadString('\n')
+		input, err := consoleReader.ReadString('\n')
+		if err == io.EOF {
+			// There will never be another command, for example because input was redirected from a file
+			log.Println("Console input closed, no longer reading commands")
+			return
+		}
 
 		input = strings.ToLower(input)
 		input = strings.TrimRight(input, "\n")
@@ -171,46 +167,312 @@ func (c Client) sendTransaction() {
 		case "peers":
 			c.listPeers()
 		case "transaction":
-			// There must be at least one other node on the network (other than the Middleware) to send currency to
-			if len(c.communicator.GetPeerNodes()) > 1 {
-				fmt.Println("Enter transaction data or 'cancel' to cancel.")
-				//Get transaction input
-				input, _ = consoleReader.ReadString('\n')
-				input = strings.TrimRight(input, "\n")
-				if input == "cancel" {
+			fmt.Println("Enter transaction data or 'cancel' to cancel.")
+			//Get transaction input
+			input, _ = consoleReader.ReadString('\n')
+			input = strings.TrimRight(input, "\n")
+			if input == "cancel" {
+				break CommandSwitch
+			} else {
+				s := strings.Split(input, ",")
+				if len(s) != 2 && len(s) != 3 {
+					fmt.Println("Incorrect input, please enter 'help' to see expected transaction input and try again")
 					break CommandSwitch
-				} else {
-					s := strings.Split(input, ",")
+				}
 
-					recipientIndex, err := strconv.Atoi(s[0])
-					if err != nil {
-						fmt.Println("Incorrect input, please enter 'help' to see expected transaction input and try again")
-						break CommandSwitch
-					}
+				recipient := strings.ToLower(strings.TrimSpace(s[0]))
 
-					amount, err := strconv.Atoi(s[1])
+				amount, err := strconv.Atoi(strings.TrimSpace(s[1]))
+				if err != nil {
+					fmt.Println("Incorrect input, please enter 'help' to see expected transaction input and try again")
+					break CommandSwitch
+				}
+
+				// The fee is optional
+				fee := 0
+				if len(s) == 3 {
+					fee, err = strconv.Atoi(strings.TrimSpace(s[2]))
 					if err != nil {
 						fmt.Println("Incorrect input, please enter 'help' to see expected transaction input and try again")
 						break CommandSwitch
 					}
+				}
 
-					err = c.createNewTransaction(recipientIndex, amount)
-					if err != nil {
-						fmt.Printf("Error creating new transaction: %+v\n", err)
-						break CommandSwitch
-					}
+				err = c.createNewTransaction(recipient, amount, fee)
+				if err != nil {
+					fmt.Printf("Error creating new transaction: %+v\n", err)
+					break CommandSwitch
 				}
-			} else {
-				fmt.Println("Warning: Cannot create new transaction, no other Peers on the network")
+			}
+		case "stake", "unstake":
+			kind := input
+			fmt.Println("Enter amount and optional fee or 'cancel' to cancel.")
+			input, _ = consoleReader.ReadString('\n')
+			input = strings.TrimRight(input, "\n")
+			if input == "cancel" {
+				break CommandSwitch
+			}
+
+			s := strings.Split(input, ",")
+			if len(s) != 1 && len(s) != 2 {
+				fmt.Println("Incorrect input, please enter 'help' to see expected stake input and try again")
+				break CommandSwitch
+			}
+
+			amount, err := strconv.Atoi(strings.TrimSpace(s[0]))
+			if err != nil {
+				fmt.Println("Incorrect input, please enter 'help' to see expected stake input and try again")
+				break CommandSwitch
+			}
+
+			// The fee is optional
+			fee := 0
+			if len(s) == 2 {
+				fee, err = strconv.Atoi(strings.TrimSpace(s[1]))
+				if err != nil {
+					fmt.Println("Incorrect input, please enter 'help' to see expected stake input and try again")
+					break CommandSwitch
+				}
+			}
+
+			err = c.createStakingTransaction(kind, amount, fee)
+			if err != nil {
+				fmt.Printf("Error creating new transaction: %+v\n", err)
+			}
+		case "validators":
+			if c.peer.lightClient {
+				fmt.Println("Warning: The validator set isn't available in light client mode")
+				break CommandSwitch
+			}
+			c.listValidators()
+		case "address":
+			fmt.Printf("Wallet address: %s\n", c.GetAddress())
+		case "accounts", "newaccount", "switch", "import", "export":
+			if c.KeystoreDirectory == "" {
+				fmt.Println("Warning: No keystore is configured, so accounts aren't available")
+				break CommandSwitch
+			}
+
+			err = c.handleAccountCommand(input, consoleReader)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
 			}
 		case "bal":
-			fmt.Printf("Current wallet balance: %d\n", c.peer.wallet)
+			if c.peer.lightClient {
+				fmt.Println("Warning: Balances aren't available in light client mode")
+				break CommandSwitch
+			}
+			fmt.Printf("Current wallet balance: %d\n", c.peer.balance())
+			if validator := c.peer.ledger.Validator(c.GetAddress()); validator.Stake > 0 || len(validator.Unbonding) > 0 {
+				fmt.Println(validator.String())
+			}
+		case "balances":
+			if c.peer.lightClient {
+				fmt.Println("Warning: Balances aren't available in light client mode")
+				break CommandSwitch
+			}
+			c.listBalances()
+		case "supply":
+			if c.peer.lightClient {
+				fmt.Println("Warning: The supply isn't available in light client mode")
+				break CommandSwitch
+			}
+
+			input = readLine(consoleReader, "Block height (empty for the latest block, 'cancel' to cancel): ")
+			if input == "cancel" {
+				break CommandSwitch
+			}
+
+			supply, err := c.supply(input)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				break CommandSwitch
+			}
+
+			c.printSupply(supply)
+		case "stats":
+			c.printMiningStats()
+		case "notarize":
+			fmt.Println("Enter the path of the file to notarize or 'cancel' to cancel.")
+			input, _ = consoleReader.ReadString('\n')
+			input = strings.TrimRight(input, "\n")
+			if input == "cancel" {
+				break CommandSwitch
+			}
+
+			contents, err := ioutil.ReadFile(input)
+			if err != nil {
+				fmt.Printf("Error reading file: %+v\n", err)
+				break CommandSwitch
+			}
+
+			hashed := sha256.Sum256(contents)
+			err = c.submitPayload(Notarization{DocumentHash: hex.EncodeToString(hashed[:]), Description: filepath.Base(input)})
+			if err != nil {
+				fmt.Printf("Error notarizing file: %+v\n", err)
+			}
+		case "note":
+			fmt.Println("Enter the text of the note or 'cancel' to cancel.")
+			input, _ = consoleReader.ReadString('\n')
+			input = strings.TrimRight(input, "\n")
+			if input == "cancel" {
+				break CommandSwitch
+			}
+
+			err := c.submitPayload(Note{Text: input})
+			if err != nil {
+				fmt.Printf("Error recording note: %+v\n", err)
+			}
+		case "verify":
+			fmt.Println("Enter block index and transaction hash or 'cancel' to cancel.")
+			input, _ = consoleReader.ReadString('\n')
+			input = strings.TrimRight(input, "\n")
+			if input == "cancel" {
+				break CommandSwitch
+			}
+
+			s := strings.Split(input, ",")
+			if len(s) != 2 {
+				fmt.Println("Incorrect input, please enter 'help' to see expected verify input and try again")
+				break CommandSwitch
+			}
+
+			blockIndex, err := strconv.Atoi(s[0])
+			if err != nil {
+				fmt.Println("Incorrect input, please enter 'help' to see expected verify input and try again")
+				break CommandSwitch
+			}
+
+			err = c.peer.RequestInclusionProof(blockIndex, strings.TrimSpace(s[1]))
+			if err != nil {
+				fmt.Printf("Error verifying transaction: %+v\n", err)
+			}
 		default:
 			fmt.Printf("Error: Invalid command '%s', Please try again.\n", input)
 		}
 	}
 }
 
+// unlockAccount loads the key of the Client's account from the keystore, creating the account if it doesn't exist
+func (c *Client) unlockAccount() error {
+
+	if c.Account == "" {
+		c.Account = DEFAULT_ACCOUNT
+	}
+
+	keystore := Keystore{Directory: c.KeystoreDirectory}
+	exists := keystore.HasAccount(c.Account)
+
+	passphrase := c.Passphrase
+	if passphrase == "" && !c.Headless {
+		consoleReader := bufio.NewReader(os.Stdin)
+		if exists {
+			passphrase = readLine(consoleReader, fmt.Sprintf("Enter the passphrase of account '%s': ", c.Account))
+		} else {
+			passphrase = readLine(consoleReader, fmt.Sprintf("Creating account '%s', enter a passphrase to encrypt it with: ", c.Account))
+		}
+	}
+
+	var key *ecdsa.PrivateKey
+	var err error
+	if exists {
+		key, err = keystore.LoadAccount(c.Account, passphrase)
+	} else {
+		key, err = keystore.CreateAccount(c.Account, passphrase)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error unlocking account '%s': %v", c.Account, err)
+	}
+
+	// The passphrase isn't needed once the key is unlocked, so it isn't kept around
+	c.Passphrase = ""
+	c.privateKey = key
+	log.Printf("Using account '%s' with wallet address %s\n", c.Account, c.GetAddress())
+
+	return nil
+}
+
+// handleAccountCommand runs one of the console commands that manage the accounts in the keystore
+func (c *Client) handleAccountCommand(command string, consoleReader *bufio.Reader) error {
+
+	keystore := Keystore{Directory: c.KeystoreDirectory}
+
+	switch command {
+	case "accounts":
+		accounts, err := keystore.ListAccounts()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("===== Accounts =====")
+		for _, account := range accounts {
+			if account.Name == c.Account {
+				fmt.Printf("name=%s, address=%s [In use]\n", account.Name, account.Address)
+			} else {
+				fmt.Printf("name=%s, address=%s\n", account.Name, account.Address)
+			}
+		}
+		fmt.Println("====================")
+
+	case "newaccount":
+		name := readLine(consoleReader, "Enter a name for the new account: ")
+		passphrase := readLine(consoleReader, "Enter a passphrase to encrypt it with: ")
+
+		key, err := keystore.CreateAccount(name, passphrase)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created account '%s' with wallet address %s, enter 'switch' to use it\n", name, AddressFromPublicKey(&key.PublicKey))
+
+	case "switch":
+		name := readLine(consoleReader, "Enter the name of the account: ")
+		passphrase := readLine(consoleReader, "Enter its passphrase: ")
+
+		key, err := keystore.LoadAccount(name, passphrase)
+		if err != nil {
+			return err
+		}
+
+		c.Account = name
+		c.privateKey = key
+		fmt.Printf("Now using account '%s' with wallet address %s\n", name, c.GetAddress())
+
+	case "import":
+		name := readLine(consoleReader, "Enter a name for the imported account: ")
+		encodedKey := readLine(consoleReader, "Enter the exported private key: ")
+		passphrase := readLine(consoleReader, "Enter a passphrase to encrypt it with: ")
+
+		key, err := keystore.ImportAccount(name, encodedKey, passphrase)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Imported account '%s' with wallet address %s, enter 'switch' to use it\n", name, AddressFromPublicKey(&key.PublicKey))
+
+	case "export":
+		passphrase := readLine(consoleReader, fmt.Sprintf("Enter the passphrase of account '%s': ", c.Account))
+
+		encodedKey, err := keystore.ExportAccount(c.Account, passphrase)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Keep this private key secret, anyone who has it can spend this account's funds:")
+		fmt.Println(encodedKey)
+	}
+
+	return nil
+}
+
+// readLine prints the prompt and returns the next line entered on the console, without its line ending
+func readLine(consoleReader *bufio.Reader, prompt string) string {
+	fmt.Print(prompt)
+	input, _ := consoleReader.ReadString('\n')
+	return strings.TrimRight(input, "\r\n")
+}
+
 func (c Client) printCommands() {
 	fmt.Println("===== Commands =====")
 	for _, desc := range c.commandDescriptions {
@@ -226,7 +488,7 @@ func (c Client) listPeers() {
 	if len(peersList) > 1 {
 		fmt.Println("===== Known Peers =====")
 		for i, peer := range peersList {
-			if peer.Address.Port != 8080 {
+			if !equalPeers(peer.Address, c.communicator.GetMiddlewarePeer().Address) {
 				fmt.Printf("index=%d, ip=%v, port=%v\n", i, peer.Address.IP, peer.Address.Port)
 			} else {
 				fmt.Printf("index=%d, ip=%v, port=%v [Middleware Peer]\n", i, peer.Address.IP, peer.Address.Port)
@@ -239,97 +501,288 @@ func (c Client) listPeers() {
 
 }
 
-func (c Client) createNewTransaction(index int, amount int) error {
-
-	// First, check if the user has the amount of currency they are wanting to send
-	if amount <= c.peer.wallet {
-
-		peersList := c.communicator.GetPeerNodes()
-		recipient := peersList[index]
+func (c Client) listBalances() {
 
-		// Prevent the user from sending to the middleware
-		if recipient.Address.Port != c.communicator.GetMiddlewarePeer().Address.Port {
+	balances := c.peer.ledger.Balances()
+	if len(balances) > 0 {
+		fmt.Println("===== Balances =====")
+		for address, balance := range balances {
+			fmt.Printf("address=%s, balance=%d\n", address, balance)
+		}
+		fmt.Println("====================")
+	} else {
+		fmt.Println("No accounts on the chain yet.")
+	}
 
-			toStr := recipient.String()
-			fromStr := c.communicator.GetSelfAddress().String()
+}
 
-			// Hit the Middleware endpoint
-			// to create an entry in the blockchain for the transaction
-			data := Transaction{From: fromStr, To: toStr, Amount: amount}
+// listValidators prints out the validator set according to this Peer's chain
+func (c Client) listValidators() {
 
-			data, err := c.Sign(data)
-			if err != nil {
-				return err
+	validators := c.peer.ledger.Validators()
+	if len(validators) > 0 {
+		fmt.Println("===== Validators =====")
+		for _, v := range validators {
+			fmt.Println(v.String())
+			for _, u := range v.Unbonding {
+				fmt.Printf("  unbonding %d, spendable from block %d\n", u.Amount, u.ReleaseHeight)
 			}
+		}
+		fmt.Println("====================")
+	} else {
+		fmt.Println("No validators yet, any account can stake up to its balance until the first stake is bonded.")
+	}
 
-			values := url.Values{"to": {data.To}, "from": {data.From}, "amount": {fmt.Sprint(amount)}, "signature": {data.Signature}}
+}
 
-			// Hit the Middleware's create transaction endpoint
-			resp, err := http.PostForm(MIDDLEWARE_URL, values)
+// supply returns the supply of currency at the block height that the user entered. Without a height, the supply of
+// the latest block is read from the Peer's ledger, which the balances are read from as well, so they always agree.
+// The supply at an earlier height is found by replaying the chain up to it
+func (c Client) supply(input string) (Supply, error) {
 
-			if err != nil {
-				return err
-			}
+	if input == "" {
+		return c.peer.ledger.Supply(), nil
+	}
 
-			defer resp.Body.Close()
+	height, err := strconv.Atoi(input)
+	if err != nil {
+		return Supply{}, errors.New("the height must be a number")
+	}
 
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return err
-			}
+	return SupplyAt(c.peer.GetChain(), height)
+}
 
-			// Return the error from the server if the request is not successful
-			if resp.StatusCode != 200 {
-				return errors.New(string(body))
-			} else {
-				fmt.Println(string(body))
-			}
+// printSupply prints out the passed supply of currency, and how much the network's reward schedule will ever create
+func (c Client) printSupply(supply Supply) {
 
-			// If the Middleware accepts the transaction, send the currency to
-			// the intended recipient
+	rewards := c.peer.consensusComponent.GetRewardSchedule()
 
-			toSend, err := c.communicator.GenerateMessage("TRANSACTION", data)
-			if err != nil {
-				return err
-			}
+	fmt.Println("===== Supply =====")
+	fmt.Printf("height=%d, accounts=%d\n", supply.Height, supply.Accounts)
+	fmt.Printf("allocated=%d, minted=%d, burned=%d, circulating=%d\n", supply.Allocated, supply.Minted, supply.Burned, supply.Circulating)
+	fmt.Printf("reward schedule: %s, next block reward=%d\n", rewards.String(), rewards.Reward(supply.Height+1))
+	if maxSupply, limited := rewards.MaxSupply(); limited {
+		fmt.Printf("block rewards will create at most %d\n", maxSupply)
+	} else {
+		fmt.Println("block rewards will create currency forever")
+	}
+	fmt.Println("==================")
+}
 
-			err = c.communicator.SendMsgToPeer(toSend, recipient)
-			if err != nil {
-				return err
-			}
+// printMiningStats prints out the statistics of this Peer's recent mining sessions, followed by the totals of every
+// session at each difficulty, so that the effect of the difficulty on block times can be seen
+func (c Client) printMiningStats() {
 
-			// Finally, subtract the amount from this Peer's wallet
-			c.peer.wallet -= amount
+	stats := c.peer.consensusComponent.GetMiningStats()
+	if len(stats) == 0 {
+		fmt.Println("No mining sessions yet. Mining statistics are only recorded with Proof of Work.")
+		return
+	}
 
-		} else {
-			return errors.New("can't transfer money to Middleware")
+	type total struct {
+		sessions, found int
+		hashes          int64
+		elapsed         time.Duration
+	}
+	totals := make(map[float64]*total)
+	difficulties := []float64{}
+
+	fmt.Println("===== Mining Sessions =====")
+	for _, s := range stats {
+		fmt.Println(s.String())
+
+		t := totals[s.Difficulty]
+		if t == nil {
+			t = &total{}
+			totals[s.Difficulty] = t
+			difficulties = append(difficulties, s.Difficulty)
 		}
-	} else {
-		return errors.New("amount entered to send is greater than balance")
+		t.sessions++
+		t.hashes += s.Hashes
+		t.elapsed += s.Elapsed
+		if s.Found {
+			t.found++
+		}
+	}
+
+	sort.Float64s(difficulties)
+	fmt.Println("===== By Difficulty =====")
+	for _, d := range difficulties {
+		t := totals[d]
+		rate := 0.0
+		if t.elapsed > 0 {
+			rate = float64(t.hashes) / t.elapsed.Seconds()
+		}
+		fmt.Printf("difficulty=%.0f, sessions=%d, found=%d, average time=%v, average rate=%s\n",
+			d, t.sessions, t.found, (t.elapsed / time.Duration(t.sessions)).Round(time.Microsecond), FormatHashRate(rate))
+	}
+	fmt.Println("====================")
+}
+
+// submitPayload sends a Data entry that isn't a transaction to the Middleware to be mined into the chain
+func (c Client) submitPayload(d Data) error {
+
+	err := ValidatePayload(d)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	// Hit the Middleware's generic payload endpoint
+	err = c.postToMiddleware("/newData", url.Values{"type": {d.GetType()}, "data": {string(raw)}})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Entry hash: %s\n", LeafHash(d))
+
+	return nil
+}
+
+// postToMiddleware posts the form values to the passed endpoint of the Middleware's http server, and returns the
+// server's response as an error if the request isn't successful
+func (c Client) postToMiddleware(endpoint string, values url.Values) error {
+
+	resp, err := http.PostForm(c.middlewareURL()+endpoint, values)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Return the error from the server if the request is not successful
+	if resp.StatusCode != 200 {
+		return errors.New(string(body))
 	}
 
+	fmt.Println(string(body))
+
 	return nil
 }
 
-// hex.EncodeToString(hashed)
-func hexToPublicKey(xHex string, yHex string) *ecdsa.PublicKey {
-	xBytes, _ := hex.DecodeString(xHex)
-	x := new(big.Int)
-	x.SetBytes(xBytes)
+// middlewareURL returns the URL of the Middleware's http server
+func (c Client) middlewareURL() string {
+	if c.MiddlewareURL == "" {
+		return MIDDLEWARE_URL
+	}
+	return c.MiddlewareURL
+}
 
-	yBytes, _ := hex.DecodeString(yHex)
-	y := new(big.Int)
-	y.SetBytes(yBytes)
+// nextNonce asks the Middleware for the nonce of this wallet's next transaction. The Middleware counts the
+// transactions that are waiting to be mined, which this Peer's chain doesn't know about yet
+func (c Client) nextNonce() (int, error) {
 
-	pub := new(ecdsa.PublicKey)
-	pub.X = x
-	pub.Y = y
+	resp, err := http.Get(c.middlewareURL() + "/nonce?address=" + url.QueryEscape(c.GetAddress()))
+	if err != nil {
+		return 0, err
+	}
 
-	pub.Curve = elliptic.P256()
+	defer resp.Body.Close()
 
-	return pub
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != 200 {
+		return 0, errors.New(string(body))
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(body)))
 }
 
-func (c Client) ecdsaPublicKeytoPublicKey() PublicKey {
-	return PublicKey{X: hex.EncodeToString(c.publicKey.X.Bytes()), Y: hex.EncodeToString(c.publicKey.Y.Bytes())}
+func (c Client) createNewTransaction(recipient string, amount int, fee int) error {
+
+	if !ValidAddress(recipient) {
+		return errors.New("recipient is not a wallet address")
+	}
+
+	if recipient == c.GetAddress() {
+		return errors.New("can't transfer money to your own wallet")
+	}
+
+	// First, check if the user has the amount of currency they are wanting to send. Light clients don't have the
+	// blocks needed to know their balance, so they leave the check to the network
+	if !c.peer.lightClient && amount+fee > c.peer.balance() {
+		return errors.New("amount entered to send, plus the fee, is greater than balance")
+	}
+
+	err := c.submitTransaction(Transaction{To: recipient, Amount: amount, Fee: fee})
+	if err != nil {
+		return err
+	}
+
+	// The amount is moved from this wallet to the recipient's once the transaction is mined into the chain
+
+	return nil
+}
+
+// createStakingTransaction bonds or unbonds the passed amount of this wallet's stake, depending on the kind, which is
+// TRANSACTION_STAKE or TRANSACTION_UNSTAKE
+func (c Client) createStakingTransaction(kind string, amount int, fee int) error {
+
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+
+	// Light clients don't have the blocks needed to know their balance or stake, so they leave the checks to the network
+	if !c.peer.lightClient {
+		if kind == TRANSACTION_STAKE && amount+fee > c.peer.balance() {
+			return errors.New("amount entered to stake, plus the fee, is greater than balance")
+		}
+		if kind == TRANSACTION_UNSTAKE && amount > c.peer.ledger.Stake(c.GetAddress()) {
+			return errors.New("amount entered to unstake is greater than the bonded stake")
+		}
+		if kind == TRANSACTION_UNSTAKE && fee > c.peer.balance() {
+			return errors.New("fee is greater than balance")
+		}
+	}
+
+	err := c.submitTransaction(Transaction{Kind: kind, Amount: amount, Fee: fee})
+	if err != nil {
+		return err
+	}
+
+	// The stake is bonded or unbonded once the transaction is mined into the chain
+
+	return nil
+}
+
+// submitTransaction signs a transaction from this wallet with the wallet's next nonce, and sends it to the Middleware
+func (c Client) submitTransaction(t Transaction) error {
+
+	// The nonce is signed along with the rest of the transaction, so the transaction can't be mined a second time
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return fmt.Errorf("couldn't get the next nonce from the Middleware: %v", err)
+	}
+
+	t.From = c.GetAddress()
+	t.Nonce = nonce
+
+	data, err := c.Sign(t)
+	if err != nil {
+		return err
+	}
+
+	values := url.Values{"kind": {data.Kind}, "to": {data.To}, "from": {data.From}, "amount": {fmt.Sprint(data.Amount)}, "fee": {fmt.Sprint(data.Fee)}, "nonce": {fmt.Sprint(data.Nonce)}, "publicKey": {data.PublicKey}, "signature": {data.Signature}}
+
+	// Hit the Middleware's create transaction endpoint
+	err = c.postToMiddleware("/newTransaction", values)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction hash: %s\n", LeafHash(data))
+
+	return nil
 }
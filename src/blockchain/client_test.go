@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestClientSupplyFollowsMinedBlocks(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("a mining session takes more than 10 seconds")
+	}
+
+	middleware, peers, clients := startMemoryNetwork(t, 2, 0)
+	mineEntry(t, middleware, peers, Note{Text: "adds to the supply"})
+
+	for i, client := range clients {
+		chain := client.peer.GetChain()
+		height := len(chain) - 1
+
+		latest, err := client.supply("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if latest.Height != height || latest.Minted != REWARD_AMOUNT*height || latest.Circulating != latest.Minted {
+			t.Errorf("client %d: supply of the latest block is %+v at height %d", i, latest, height)
+		}
+
+		replayed, err := client.supply(strconv.Itoa(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if replayed != latest {
+			t.Errorf("client %d: supply replayed from the chain is %+v, the ledger's is %+v", i, replayed, latest)
+		}
+
+		genesis, err := client.supply("0")
+		if err != nil || genesis.Height != 0 || genesis.Minted != 0 {
+			t.Errorf("client %d: supply of the genesis block is %+v: %v", i, genesis, err)
+		}
+
+		for _, input := range []string{"-1", strconv.Itoa(height + 1), "latest"} {
+			_, err = client.supply(input)
+			if err == nil {
+				t.Errorf("client %d: supply at height %q was found", i, input)
+			}
+		}
+	}
+}
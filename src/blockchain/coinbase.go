@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ============================ Coinbase ============================
+
+// REWARD_AMOUNT is the currency created by every block under the default reward schedule, which is paid to its miner
+// along with the block's fees
+const REWARD_AMOUNT = 5
+
+// BlockFees returns the sum of the fees of the transactions among the passed entries
+func BlockFees(entries []Data) int {
+
+	fees := 0
+	for _, d := range entries {
+		if transaction, ok := d.(Transaction); ok {
+			fees += transaction.Fee
+		}
+	}
+
+	return fees
+}
+
+// NewCoinbase returns the coinbase of the block with the passed index and entries, which pays the schedule's block
+// reward plus the entries' fees to the miner
+func NewCoinbase(index int, miner string, entries []Data, rewards RewardSchedule) Coinbase {
+	return Coinbase{Height: index, To: miner, Amount: rewards.Reward(index) + BlockFees(entries)}
+}
+
+// withCoinbase returns the entries of a new block, which are the block's coinbase followed by the passed entries
+func withCoinbase(index int, miner string, entries []Data, rewards RewardSchedule) []Data {
+	return append([]Data{NewCoinbase(index, miner, entries, rewards)}, entries...)
+}
+
+// checkCoinbase checks that a block after the genesis block starts with its one coinbase, and that the coinbase pays
+// exactly the block reward plus the block's fees to the block's miner. If no reward schedule is passed, the reward
+// isn't checked, only that the coinbase pays at least the fees
+func checkCoinbase(b Block, rewards *RewardSchedule) error {
+
+	if len(b.Data) == 0 {
+		return errors.New("block has no coinbase")
+	}
+
+	coinbase, ok := b.Data[0].(Coinbase)
+	if !ok {
+		return errors.New("first entry of the block is not a coinbase")
+	}
+
+	for i, d := range b.Data[1:] {
+		if _, ok := d.(Coinbase); ok {
+			return fmt.Errorf("data entry %d is a second coinbase", i+1)
+		}
+	}
+
+	if coinbase.Height != b.Index {
+		return fmt.Errorf("coinbase is for block %d", coinbase.Height)
+	}
+
+	if coinbase.To != b.Miner {
+		return errors.New("coinbase doesn't pay the block's miner")
+	}
+
+	fees := BlockFees(b.Data)
+	if rewards == nil {
+		if coinbase.Amount < fees {
+			return fmt.Errorf("coinbase pays %d, which is less than the block's fees of %d", coinbase.Amount, fees)
+		}
+		return nil
+	}
+
+	expected := rewards.Reward(b.Index) + fees
+	if coinbase.Amount != expected {
+		return fmt.Errorf("coinbase pays %d, but the block reward plus fees is %d", coinbase.Amount, expected)
+	}
+
+	return nil
+}
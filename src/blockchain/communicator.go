@@ -3,11 +3,13 @@ package blockchain
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,24 +18,53 @@ import (
 
 // ============================ Communication ============================
 
-// Communicator implements CommunicationsComponent and facilities Blockchain communication
+// MIDDLEWARE_PORT is the well-known port that the Middleware listens on, which is how nodes that discover it through
+// ZeroConf recognize it when no MiddlewareAddress is configured
+const MIDDLEWARE_PORT = 8080
+
+// Communicator implements CommunicationsComponent and facilities Blockchain communication. Messages are sent over
+// UDP by default, or over TCP if Transport is set to "tcp", which is needed for messages larger than one datagram,
+// such as long chains. Every node on the network must use the same transport.
+//
+// Nodes are discovered through ZeroConf unless DisableZeroConf is set, which is needed on networks that block
+// multicast. Seeds lists the "host:port" addresses of nodes to bootstrap from, and the rest of the network is learned
+// through peer exchange, with nodes asking each other for the peers that they know. MiddlewareAddress is the
+// "host:port" address of the Middleware, which otherwise is the node discovered on MIDDLEWARE_PORT.
+//
+// BindAddress is the IPv4 or IPv6 address to listen on, and defaults to every interface. ExternalAddress is the
+// address, optionally with a port, that other nodes should reach this node at, for example when it is behind a NAT.
+// Without one, the bind address is advertised if it is a specific address, otherwise the address of the interface
+// that this machine's traffic is routed through
 type Communicator struct {
-	service       *zeroconf.Server
-	socket        *net.UDPConn
-	peerAddresses []PeerAddress
-	peerMessage   chan Message
-	middleware    PeerAddress
-	self          PeerAddress
+	Transport         string
+	BindAddress       string
+	ExternalAddress   string
+	DisableZeroConf   bool
+	Seeds             []string
+	MiddlewareAddress string
+	service           *zeroconf.Server
+	transport         transport
+	peerAddresses     []PeerAddress
+	peerMessage       chan Message
+	middleware        PeerAddress
+	self              PeerAddress
 }
 
-// PeerAddress represents a peer on the network and contains metadata about that peer
+// PeerAddress represents a peer on the network and contains metadata about that peer. The Address is used as an
+// IP and port pair whichever transport is in use
 type PeerAddress struct {
 	Address         net.UDPAddr `json:"address"`
 	LastMessageTime time.Time   `json:"lastMessageTime"`
 }
 
 func (p PeerAddress) String() string {
-	return fmt.Sprintf("%v:%v", p.Address.IP, p.Address.Port)
+	return net.JoinHostPort(p.Address.IP.String(), strconv.Itoa(p.Address.Port))
+}
+
+// Register the commands that discover the network, which carry no Data
+func init() {
+	RegisterCommand("PING")
+	RegisterCommand("GET_PEERS")
 }
 
 // GetMessageChannel is the interface retriever method that returns the channel that a message from a peer is put into upon read
@@ -57,38 +88,42 @@ func (c Communicator) GetSelfAddress() PeerAddress {
 }
 
 // RecieveFromNetwork is the interface method that
-// returns a Message that it reads from this peer's UDP socket
+// returns a Message that it reads from this peer's transport. Messages that can't be decoded are logged and
+// dropped, so an error is only returned when the transport itself fails
 func (c *Communicator) RecieveFromNetwork(withTimeout bool) error {
 
-	buf := make([]byte, 65535)
-	if withTimeout {
-		c.socket.SetReadDeadline(time.Now().Add(1 * time.Millisecond))
+	// Read from the transport
+	buf, source, err := c.transport.receive(withTimeout)
+	if err != nil {
+		// This was an error, but not a timeout, so print it out
+		log.Printf("Error reading from transport: %v\n", err)
+		return err
 	}
 
-	// Read from the socket
-	len, _, err := c.socket.ReadFromUDP(buf)
-	if err != nil {
-		if er, ok := err.(net.Error); ok && er.Timeout() {
-			// This was a timeout error, so just return as there was nothing to be read
-			return nil
-		} else if err != nil {
-			// This was an error, but not a timeout, so print it out
-			log.Printf("Error reading from socket: %v\n", err)
-			return err
-		}
+	// There was nothing to be read before the timeout
+	if buf == nil {
+		return nil
 	}
 	// fmt.Printf("DEBUG - Read a message from socket: %+v\n", string(buf))
 
 	message := new(Message)
 
-	err = message.UnmarshalJSON(buf[:len])
+	err = message.UnmarshalJSON(buf)
 	if err != nil {
-		log.Printf("Error unmarshalling message: %v\n", err)
-		return err
+		// A malformed or foreign message is dropped, only a failure of this node's own transport is fatal
+		log.Printf("Dropping message that can't be decoded: %v\n", err)
+		return nil
 	}
+	message.source = source
 
 	// fmt.Printf("DEBUG - Unmarshalled message from socket: %+v\n", message)
 
+	// Ignore messages that reach this node from itself, which can happen when it is listed as a seed or in an
+	// exchanged list of peers
+	if c.isSelf(message.From.Address) {
+		return nil
+	}
+
 	// If the peer that sent the message is not a known peer, add it to the peerNodes list
 	if !knownPeer(c.peerAddresses, message.From) {
 		// fmt.Printf("DEBUG - Peer is not known: %v\n", message.From)
@@ -100,6 +135,16 @@ func (c *Communicator) RecieveFromNetwork(withTimeout bool) error {
 	c.peerAddresses = updateLastMessage(c.peerAddresses, message.From)
 	// fmt.Println("DEBUG - Updated last message")
 
+	// Peer exchange is handled by the communicator itself, so these messages aren't passed on
+	switch message.Command {
+	case "GET_PEERS":
+		c.sendKnownPeers(message.From)
+		return nil
+	case "PEERS":
+		c.addExchangedPeers(message.Data.(PeerList).Peers)
+		return nil
+	}
+
 	c.peerMessage <- *message
 	// fmt.Println("DEBUG - Successfully received message")
 
@@ -134,27 +179,28 @@ func (c Communicator) PingNetwork() error {
 }
 
 // Initialize initializes a new communicator by initializing
-// a socket and ZeroConf service and discovering other services
+// a transport and ZeroConf service and discovering other services
 func (c *Communicator) Initialize() error {
 
-	// Initialize the socket that this peer will communicate through
-	c.socket = initializeSocket()
+	// Initialize the transport that this peer will communicate through, on a dynamically assigned port
+	err := c.initializeTransport(0)
+	if err != nil {
+		log.Printf("Failed to initialize transport: %+v\n", err)
+		return err
+	}
 
-	// Get the UDPAddr of this peer's socket
-	addr, err := getUDPAddr(c.socket)
+	// Get the address that other peers reach this peer's transport at
+	addr, err := c.advertisedAddress(c.transport.localPort())
 	if err != nil {
-		log.Printf("Failed to get UDP address: %+v\n", err)
+		log.Printf("Failed to get advertised address: %+v\n", err)
 		return err
 	}
 
 	// Remember this peer's address
 	c.self = PeerAddress{Address: addr}
 
-	// Initialize the service that this peer will join the p2p network through
-	c.service = initializeService(addr.Port)
-
-	// Discover peers on the p2p network
-	err = c.discoverPeers(addr)
+	// Join the p2p network and discover the peers on it
+	err = c.joinNetwork(addr)
 	if err != nil {
 		log.Printf("Error discovering peers: %+v\n", err)
 		return err
@@ -171,24 +217,25 @@ func (c *Communicator) Initialize() error {
 // the communicator with the passed well-defined port, instead of dynamically assgning a port
 func (c *Communicator) InitializeWithPort(port int) error {
 
-	// Initialize the socket that this peer will communicate through
-	c.socket = initializeSocketWithPort(port)
+	// Initialize the transport that this peer will communicate through
+	err := c.initializeTransport(port)
+	if err != nil {
+		log.Printf("Failed to initialize transport: %+v\n", err)
+		return err
+	}
 
-	// Get the UDPAddr of this peer's socket
-	addr, err := getUDPAddr(c.socket)
+	// Get the address that other peers reach this peer's transport at
+	addr, err := c.advertisedAddress(c.transport.localPort())
 	if err != nil {
-		log.Printf("Failed to get UDP address: %+v\n", err)
+		log.Printf("Failed to get advertised address: %+v\n", err)
 		return err
 	}
 
 	// Remember this peer's address
 	c.self = PeerAddress{Address: addr}
 
-	// Initialize the service that this peer will join the p2p network through
-	c.service = initializeService(port)
-
-	// Discover peers on the p2p network
-	err = c.discoverPeers(addr)
+	// Join the p2p network and discover the peers on it
+	err = c.joinNetwork(addr)
 	if err != nil {
 		log.Printf("Error discovering peers: %+v\n", err)
 		return err
@@ -209,11 +256,6 @@ func (c Communicator) Terminate() {
 // helper methods to broadcast messages
 func (c Communicator) BroadcastMsgToNetwork(m Message) error {
 
-	//=========== TODO: REMOVE AFTER DEVELOPMENT ===========
-	temp, _ := net.LookupIP("localhost")
-	m.From.Address.IP = temp[0]
-	// =====================================================
-
 	err := c.broadcastToNetwork(m)
 	if err != nil {
 		log.Printf("Error broadcasting message: %v\n", err)
@@ -227,11 +269,6 @@ func (c Communicator) BroadcastMsgToNetwork(m Message) error {
 // helper methods to send a message to a peer
 func (c Communicator) SendMsgToPeer(m Message, p PeerAddress) error {
 
-	//=========== TODO: REMOVE AFTER DEVELOPMENT ===========
-	temp, _ := net.LookupIP("localhost")
-	m.From.Address.IP = temp[0]
-	// =====================================================
-
 	err := c.sendToPeer(m, p)
 	if err != nil {
 		log.Printf("Error sending message to Peer: %v\n", err)
@@ -259,72 +296,260 @@ func (c *Communicator) PrunePeerNodes() {
 // GenerateMessage uses the passed values to generate a new Message
 func (c *Communicator) GenerateMessage(cmd string, data Data) (Message, error) {
 
-	addr, err := getUDPAddr(c.socket)
-	if err != nil {
-		log.Fatalf("Failed to get UDP address: %+v\n", err)
-		return Message{}, err
-	}
-
-	newMessage := Message{Command: cmd, Data: data, From: PeerAddress{Address: addr, LastMessageTime: time.Now()}}
+	newMessage := Message{Command: cmd, Data: data, From: PeerAddress{Address: c.self.Address, LastMessageTime: time.Now()}}
 
 	return newMessage, nil
 }
 
 // ==================== Non-interface, helper methods ========================
 
-// terminateCommunicator cleans up and terminates this peer's socket and service
+// terminateCommunicator cleans up and terminates this peer's transport and service
 func (c Communicator) terminateCommunicator() {
 
 	log.Println("Terminating communicator...")
 
-	//Shutdown self service instance
-	c.service.Shutdown()
+	//Shutdown self service instance, which only exists if ZeroConf was used
+	if c.service != nil {
+		c.service.Shutdown()
+	}
 
-	//Close the socket
-	err := c.socket.Close()
+	//Close the transport
+	err := c.transport.close()
 
 	if err != nil {
-		log.Printf("Error closing socket: %+v\n", err)
+		log.Printf("Error closing transport: %+v\n", err)
 	}
 }
 
-func initializeSocket() *net.UDPConn {
+// initializeTransport creates the transport configured by the Transport field and starts listening on the passed
+// port, or on a dynamically assigned port if the passed port is 0
+func (c *Communicator) initializeTransport(port int) error {
 
-	//Dynamically get an unused port assigned by opening a socket with port set to 0
-	addr, err := net.ResolveUDPAddr("udp", ":0")
+	t, err := newTransport(c.Transport)
 	if err != nil {
-		log.Fatalf("Failed to resolve UDP address: %+v\n", err)
+		return err
 	}
 
-	s, err := net.ListenUDP("udp", addr)
+	err = t.listen(c.BindAddress, port)
 	if err != nil {
-		log.Fatalf("Failed to create new socket: %+v\n", err)
+		return err
+	}
+
+	c.transport = t
+
+	return nil
+}
+
+// Errors that occur within this function and similar ones do not need to be passed up to the caller
+// because the program just exits if an error occurs
+
+// joinNetwork joins the p2p network through a ZeroConf service, unless it is disabled, and through the configured
+// seeds, and sets the Middleware's address if it is configured
+func (c *Communicator) joinNetwork(addr net.UDPAddr) error {
+
+	if !c.DisableZeroConf {
+		// Initialize the service that this peer will join the p2p network through
+		c.service = initializeService(addr, c.transport.serviceName())
+
+		err := c.discoverPeers()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.Seeds) > 0 {
+		err := c.bootstrapFromSeeds()
+		if err != nil {
+			return err
+		}
 	}
 
-	return s
+	if c.MiddlewareAddress != "" {
+		middlewareAddr, err := net.ResolveUDPAddr("udp", c.MiddlewareAddress)
+		if err != nil {
+			return fmt.Errorf("invalid Middleware address %q: %v", c.MiddlewareAddress, err)
+		}
+
+		c.middleware = PeerAddress{Address: *middlewareAddr, LastMessageTime: time.Now()}
+
+		if !c.isSelf(*middlewareAddr) && !knownPeer(c.peerAddresses, c.middleware) {
+			c.peerAddresses = append(c.peerAddresses, c.middleware)
+		}
+	}
+
+	return nil
 }
 
-// initializeSocketWithPort "overloads" the initializeSocket method, and initializes
-// the socket with the passed well-defined port, instead of dynamically assgning a port
-func initializeSocketWithPort(port int) *net.UDPConn {
+// bootstrapFromSeeds adds every seed as a known peer and asks it for the peers that it knows, which also lets the
+// seed know about this node
+func (c *Communicator) bootstrapFromSeeds() error {
 
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", port))
+	seeds := []PeerAddress{}
+	for _, seed := range c.Seeds {
+		seedAddr, err := net.ResolveUDPAddr("udp", seed)
+		if err != nil {
+			log.Printf("Error resolving seed %q: %v\n", seed, err)
+			continue
+		}
+
+		seeds = append(seeds, PeerAddress{Address: *seedAddr, LastMessageTime: time.Now()})
+	}
+
+	if len(seeds) == 0 {
+		return errors.New("none of the seeds could be resolved")
+	}
+
+	c.addExchangedPeers(seeds)
+
+	fmt.Printf("Bootstrapped from seed nodes: %+v\n", c.peerAddresses)
+
+	return nil
+}
+
+// sendKnownPeers sends the list of peers that this node knows to the peer that asked for it
+func (c Communicator) sendKnownPeers(to PeerAddress) {
+
+	known := PeerList{Peers: []PeerAddress{}}
+	for _, peer := range c.peerAddresses {
+		if !equalPeers(peer.Address, to.Address) {
+			known.Peers = append(known.Peers, peer)
+		}
+	}
+
+	toSend, err := c.GenerateMessage("PEERS", known)
 	if err != nil {
-		log.Fatalf("Failed to resolve UDP address: %v\n", err)
+		log.Printf("Error generating message: %v\n", err)
+		return
 	}
 
-	s, err := net.ListenUDP("udp", addr)
+	err = c.SendMsgToPeer(toSend, to)
 	if err != nil {
-		log.Fatalf("Failed to create new socket: %v\n", err)
+		log.Printf("Error sending known peers: %v\n", err)
 	}
+}
+
+// addExchangedPeers adds the peers that this node didn't know about yet to its list of known peers, and asks each of
+// them for the peers that they know in turn, until the whole network has been learned
+func (c *Communicator) addExchangedPeers(peers []PeerAddress) {
 
-	return s
+	for _, peer := range peers {
+		if c.isSelf(peer.Address) || knownPeer(c.peerAddresses, peer) {
+			continue
+		}
+
+		peer.LastMessageTime = time.Now()
+		c.peerAddresses = append(c.peerAddresses, peer)
+
+		toSend, err := c.GenerateMessage("GET_PEERS", nil)
+		if err != nil {
+			log.Printf("Error generating message: %v\n", err)
+			continue
+		}
+
+		err = c.SendMsgToPeer(toSend, peer)
+		if err != nil {
+			log.Printf("Error asking peer for its known peers: %v\n", err)
+		}
+	}
 }
 
-// Errors that occur within this function and similar ones do not need to be passed up to the caller
-// because the program just exits if an error occurs
+// isSelf returns true if the passed address is this node's own address, including when it is reached over loopback
+// while listening on every interface
+func (c Communicator) isSelf(addr net.UDPAddr) bool {
+	if equalPeers(addr, c.self.Address) {
+		return true
+	}
 
-func initializeService(port int) *zeroconf.Server {
+	bindIP := net.ParseIP(c.BindAddress)
+	listensOnLoopback := c.BindAddress == "" || (bindIP != nil && bindIP.IsUnspecified())
+
+	return listensOnLoopback && addr.IP.IsLoopback() && addr.Port == c.transport.localPort()
+}
+
+// advertisedAddress returns the address that other nodes reach this node at, given the port that it listens on
+func (c *Communicator) advertisedAddress(port int) (net.UDPAddr, error) {
+
+	if c.ExternalAddress != "" {
+		host := c.ExternalAddress
+
+		// The external address may include a port, for example when a NAT forwards a different port to this node
+		h, p, err := net.SplitHostPort(c.ExternalAddress)
+		if err == nil {
+			host = h
+			port, err = strconv.Atoi(p)
+			if err != nil {
+				return net.UDPAddr{}, fmt.Errorf("invalid port in external address %q", c.ExternalAddress)
+			}
+		}
+
+		ip, err := net.ResolveIPAddr("ip", strings.Trim(host, "[]"))
+		if err != nil {
+			return net.UDPAddr{}, fmt.Errorf("invalid external address %q: %v", c.ExternalAddress, err)
+		}
+
+		return net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+	}
+
+	if c.BindAddress != "" {
+		ip, err := net.ResolveIPAddr("ip", c.BindAddress)
+		if err != nil {
+			return net.UDPAddr{}, fmt.Errorf("invalid bind address %q: %v", c.BindAddress, err)
+		}
+
+		if !ip.IP.IsUnspecified() {
+			return net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+		}
+	}
+
+	return net.UDPAddr{IP: interfaceAddress(), Port: port}, nil
+}
+
+// interfaceAddress returns the IP address of the interface that traffic leaving this machine is routed through,
+// preferring IPv4 over IPv6. If there is no route, the first interface address that isn't a loopback address is used,
+// and if there is none of those either, the loopback address, which is enough for nodes on the same machine
+func interfaceAddress() net.IP {
+
+	// Connecting a UDP socket only looks up the route, so nothing is sent to these documentation addresses
+	for _, target := range []string{"192.0.2.1:9", "[2001:db8::1]:9"} {
+		conn, err := net.Dial("udp", target)
+		if err != nil {
+			continue
+		}
+
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		conn.Close()
+
+		return ip
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.IsGlobalUnicast() {
+				return ipNet.IP
+			}
+		}
+	}
+
+	return net.IPv4(127, 0, 0, 1)
+}
+
+// serviceEntryAddress returns the address of a service discovered through ZeroConf, preferring IPv4 over IPv6
+func serviceEntryAddress(entry *zeroconf.ServiceEntry) (net.UDPAddr, error) {
+
+	if len(entry.AddrIPv4) > 0 {
+		return net.UDPAddr{IP: entry.AddrIPv4[0], Port: entry.Port}, nil
+	}
+
+	if len(entry.AddrIPv6) > 0 {
+		return net.UDPAddr{IP: entry.AddrIPv6[0], Port: entry.Port}, nil
+	}
+
+	return net.UDPAddr{}, errors.New("service has no addresses")
+}
+
+func initializeService(addr net.UDPAddr, serviceName string) *zeroconf.Server {
 	// TODO: Consider whether the Middleware should be the only peer initializing the service,
 	// and the rest of the Peers simpy join its service
 
@@ -344,16 +569,13 @@ func initializeService(port int) *zeroconf.Server {
 	peerName := fmt.Sprintf("%s-%s", se, out)
 	peerName = strings.TrimSuffix(peerName, "\n")
 
-	//The name of the service
-	serviceName := "_blockchain-P2P-Network._udp"
-
 	//The service's domain
 	domain := "local."
 
 	fmt.Println("Initiliazing service...")
 
-	//Register the service
-	self, err := zeroconf.Register(peerName, serviceName, domain, port, []string{"txtv=0", "lo=1", "la=2"}, nil)
+	//Register the service with the address that other nodes reach this node at
+	self, err := zeroconf.RegisterProxy(peerName, serviceName, domain, addr.Port, se, []string{addr.IP.String()}, []string{"txtv=0", "lo=1", "la=2"}, nil)
 	if err != nil {
 		log.Fatalln("Error registering service: ", err)
 	}
@@ -363,13 +585,14 @@ func initializeService(port int) *zeroconf.Server {
 	fmt.Println("- Name:", peerName)
 	fmt.Println("- Type:", serviceName)
 	fmt.Println("- Domain:", domain)
-	fmt.Println("- Port:", port)
+	fmt.Println("- Address:", addr.IP)
+	fmt.Println("- Port:", addr.Port)
 
 	return self
 }
 
-func (c *Communicator) discoverPeers(addr net.UDPAddr) error {
-	// Discover all services on the '_blockchain-P2P-Network._udp' blockchain network
+func (c *Communicator) discoverPeers() error {
+	// Discover all services on the blockchain network that use the same transport
 	resolver, err := zeroconf.NewResolver(nil)
 	if err != nil {
 		log.Printf("Failed to initialize resolver: %+v\n", err)
@@ -381,29 +604,20 @@ func (c *Communicator) discoverPeers(addr net.UDPAddr) error {
 		//For all peers found on the network
 		for entry := range results {
 
-			newAddr, err := net.ResolveUDPAddr(addr.Network(), fmt.Sprintf("%v:%d", entry.AddrIPv4[0], entry.Port))
+			newAddr, err := serviceEntryAddress(entry)
 			if err != nil {
-				log.Println("Failed to resolve UDP address:", err.Error())
+				log.Println("Failed to get address of service:", err.Error())
 				continue
 			}
 
 			//If the entry is the service corresponding to this peer, ignore it
-			if equalPeers(*newAddr, addr) {
+			if c.isSelf(newAddr) {
 				continue
 			}
 
-			newPeer := PeerAddress{Address: *newAddr, LastMessageTime: time.Now()}
-
-			//=========== TODO: REMOVE AFTER DEVELOPMENT ===========
-			temp, err := net.LookupIP("localhost")
-			if err != nil {
-				log.Println("Failed to LookupIP:", err.Error())
-				continue
-			}
-			newPeer.Address.IP = temp[0]
-			// =====================================================
+			newPeer := PeerAddress{Address: newAddr, LastMessageTime: time.Now()}
 
-			if newAddr.Port == 8080 {
+			if newAddr.Port == MIDDLEWARE_PORT {
 				// If this peer is the Middleware, set it as the communicators Middleware node value
 				c.middleware = newPeer
 			}
@@ -417,7 +631,7 @@ func (c *Communicator) discoverPeers(addr net.UDPAddr) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(3))
 	defer cancel()
-	err = resolver.Browse(ctx, "_blockchain-P2P-Network._udp", "local.", entries)
+	err = resolver.Browse(ctx, c.transport.serviceName(), "local.", entries)
 	if err != nil {
 		log.Printf("Failed to browse: %+v\n", err)
 		return err
@@ -435,7 +649,7 @@ func (c *Communicator) discoverPeers(addr net.UDPAddr) error {
 }
 
 // broadcastToNetwork is the helper method that uses
-// UDP to broadcast a message to all the peers on the network
+// the transport to broadcast a message to all the peers on the network
 func (c Communicator) broadcastToNetwork(msg Message) error {
 
 	// Marshal the Message into JSON
@@ -450,14 +664,9 @@ func (c Communicator) broadcastToNetwork(msg Message) error {
 	// Send the message to each known peer node
 	for _, peer := range c.peerAddresses {
 
-		//=========== TODO: REMOVE AFTER DEVELOPMENT ===========
-		temp, _ := net.LookupIP("localhost")
-		peer.Address.IP = temp[0]
-		// =====================================================
-
 		// fmt.Printf("DEBUG - Broadcasting a message to peer: %+v\n", peer.Address)
 
-		_, err := c.socket.WriteToUDP(endcodedMessage, &peer.Address)
+		err := c.transport.send(endcodedMessage, peer.Address)
 		if err != nil {
 			log.Printf("Couldn't send message to peer during broadcast: %v\n", err)
 			return err
@@ -469,7 +678,7 @@ func (c Communicator) broadcastToNetwork(msg Message) error {
 }
 
 // sendToPeer is the helper method that sends a
-// UDP message to one peer on the network
+// message to one peer on the network over the transport
 func (c Communicator) sendToPeer(msg Message, p PeerAddress) error {
 
 	// Marshal the Message into JSON
@@ -479,14 +688,9 @@ func (c Communicator) sendToPeer(msg Message, p PeerAddress) error {
 		return err
 	}
 
-	//=========== TODO: REMOVE AFTER DEVELOPMENT ===========
-	temp, _ := net.LookupIP("localhost")
-	p.Address.IP = temp[0]
-	// =====================================================
-
 	// Send the message to the peer
 	// fmt.Printf("DEBUG - Sending a message to peer: %+v\n", p.Address)
-	_, err = c.socket.WriteToUDP(endcodedMessage, &p.Address)
+	err = c.transport.send(endcodedMessage, p.Address)
 	if err != nil {
 		log.Printf("Couldn't send message to peer: %v\n", err)
 		return err
@@ -506,27 +710,6 @@ func knownPeer(slice []PeerAddress, p PeerAddress) bool {
 	return false
 }
 
-func getUDPAddr(c *net.UDPConn) (net.UDPAddr, error) {
-
-	port := c.LocalAddr().(*net.UDPAddr).Port
-
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Printf("Error resolving hostname: %+v", err)
-		return net.UDPAddr{}, nil
-	}
-
-	ip, err := net.LookupIP(hostname)
-	if err != nil {
-		log.Printf("Error resolving hostname IP: %+v", err)
-		return net.UDPAddr{}, nil
-	}
-
-	addr := net.UDPAddr{IP: ip[0], Port: port, Zone: ""}
-
-	return addr, nil
-}
-
 func removeFromList(peers []PeerAddress, p PeerAddress, i int) []PeerAddress {
 
 	peers[i] = peers[len(peers)-1]
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// startSeededCommunicator starts a Communicator on a free port of the loopback interface, without ZeroConf, that
+// bootstraps from the passed seeds
+func startSeededCommunicator(t *testing.T, seeds ...string) *Communicator {
+
+	c := &Communicator{DisableZeroConf: true, BindAddress: "127.0.0.1", Seeds: seeds}
+	err := c.InitializeWithPort(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Terminate)
+
+	return c
+}
+
+// knowsExactly returns true if the Communicator knows every other node once, and doesn't list itself
+func knowsExactly(c *Communicator, nodes []*Communicator) bool {
+
+	known := c.GetPeerNodes()
+	if len(known) != len(nodes)-1 {
+		return false
+	}
+
+	for _, node := range nodes {
+		if node != c && !knownPeer(known, node.GetSelfAddress()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestCommunicatorLearnsNetworkFromSeeds(t *testing.T) {
+
+	// Each node only knows the node started before it, and learns the rest through peer exchange
+	first := startSeededCommunicator(t)
+	second := startSeededCommunicator(t, first.GetSelfAddress().String())
+	third := startSeededCommunicator(t, second.GetSelfAddress().String())
+	fourth := startSeededCommunicator(t, third.GetSelfAddress().String())
+	nodes := []*Communicator{first, second, third, fourth}
+
+	// The nodes are polled from this goroutine only, so their lists of peers are never read while they change
+	for round := 0; round < 1000; round++ {
+		learned := true
+		for _, c := range nodes {
+			err := c.RecieveFromNetwork(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			learned = learned && knowsExactly(c, nodes)
+		}
+
+		if learned {
+			return
+		}
+	}
+
+	for i, c := range nodes {
+		t.Errorf("node %d at %s knows %+v", i, c.GetSelfAddress().String(), c.GetPeerNodes())
+	}
+}
+
+func TestCommunicatorRefusesUnresolvableSeeds(t *testing.T) {
+
+	c := &Communicator{DisableZeroConf: true, BindAddress: "127.0.0.1", Seeds: []string{"not an address"}}
+	err := c.InitializeWithPort(0)
+	if err == nil {
+		c.Terminate()
+		t.Error("communicator started without any seed it could reach")
+	}
+}
@@ -2,22 +2,34 @@ package blockchain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 )
 
-// Data is an interface used to standardize methods for any type of Block data
+// Data is an interface used to standardize methods for any type of Block data. Every implementation
+// registers a decoder for the tag returned by GetType, see RegisterDataType
 type Data interface {
 	GetData() Data
+	GetType() string
 	ToString() string
 }
 
 // =========== Transaction ===========
 
-// Transaction is a type of Data
+// Transaction is a type of Data. Its Nonce is the number of transactions its sender sent before it, which is
+// covered by the signature so that a signed transaction can only ever be mined once. The optional Fee is paid by the
+// sender to the block's miner on top of the Amount, and transactions with higher fees are mined first. A transaction
+// without a Kind transfers the Amount to To, while the TRANSACTION_STAKE and TRANSACTION_UNSTAKE kinds bond and
+// unbond the sender's own stake and have no recipient, see staking.go
 type Transaction struct {
+	Kind      string `json:"kind,omitempty"`
 	From      string `json:"from"`
 	To        string `json:"to"`
 	Amount    int    `json:"amount"`
+	Nonce     int    `json:"nonce"`
+	Fee       int    `json:"fee"`
+	PublicKey string `json:"publicKey"`
 	Signature string `json:"signature"`
 }
 
@@ -26,6 +38,11 @@ func (t Transaction) GetData() Data {
 	return t
 }
 
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (t Transaction) GetType() string {
+	return "transaction"
+}
+
 // ToString is the interface method that is required to transform the Data object into a string for communication
 func (t Transaction) ToString() string {
 	b, err := json.Marshal(t)
@@ -36,6 +53,172 @@ func (t Transaction) ToString() string {
 	return string(b)
 }
 
+// Register the decoder for the Data object, and allow it to be carried in blocks
+func init() {
+	RegisterDataType(Transaction{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var t Transaction
+		err := json.Unmarshal(raw, &t)
+		return t, err
+	})
+
+	RegisterPayloadType(Transaction{}.GetType(), func(d Data) error {
+		t := d.(Transaction)
+		switch t.Kind {
+		case "":
+			if t.From == "" || t.To == "" {
+				return errors.New("transaction is missing its sender or recipient")
+			}
+			if !ValidAddress(t.From) || !ValidAddress(t.To) {
+				return errors.New("transaction sender and recipient must be wallet addresses")
+			}
+		case TRANSACTION_STAKE, TRANSACTION_UNSTAKE:
+			if !ValidAddress(t.From) {
+				return errors.New("transaction sender must be a wallet address")
+			}
+			if t.To != "" {
+				return fmt.Errorf("%s transactions have no recipient", t.Kind)
+			}
+		default:
+			return fmt.Errorf("transaction kind %q is not supported", t.Kind)
+		}
+		if t.Amount <= 0 {
+			return errors.New("transaction amount must be positive")
+		}
+		if t.Nonce < 0 {
+			return errors.New("transaction nonce must not be negative")
+		}
+		if t.Fee < 0 {
+			return errors.New("transaction fee must not be negative")
+		}
+		if t.Fee > math.MaxInt-t.Amount {
+			return errors.New("transaction amount plus fee is too large")
+		}
+		return nil
+	}, canonicalTransaction)
+}
+
+// =========== Coinbase ===========
+
+// Coinbase is the first entry of every block after the genesis block, which pays the block reward plus the fees of
+// the block's transactions to the block's miner. Height is the index of the block, so every coinbase is different
+type Coinbase struct {
+	Height int    `json:"height"`
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (c Coinbase) GetData() Data {
+	return c
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (c Coinbase) GetType() string {
+	return "coinbase"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (c Coinbase) ToString() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and allow it to be carried in blocks. Where it may appear in a block,
+// and how much it pays, is checked along with the rest of the block, see checkCoinbase
+func init() {
+	RegisterDataType(Coinbase{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var c Coinbase
+		err := json.Unmarshal(raw, &c)
+		return c, err
+	})
+
+	RegisterPayloadType(Coinbase{}.GetType(), func(d Data) error {
+		c := d.(Coinbase)
+		if c.Height < 1 {
+			return errors.New("coinbase height must be the index of a block after the genesis block")
+		}
+		if !ValidAddress(c.To) {
+			return errors.New("coinbase recipient must be a wallet address")
+		}
+		if c.Amount < 0 {
+			return errors.New("coinbase amount must not be negative")
+		}
+		return nil
+	}, canonicalCoinbase)
+}
+
+// =========== DataBatch ===========
+
+// DataBatch is an ordered list of Data entries, of any payload type, that are mined together into one block
+type DataBatch struct {
+	Entries []Data `json:"entries"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (d DataBatch) GetData() Data {
+	return d
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (d DataBatch) GetType() string {
+	return "dataBatch"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (d DataBatch) ToString() string {
+	b, err := json.Marshal(d)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// MarshalJSON is a custom JSON marshaller that tags each of the batch's entries with its type
+func (d DataBatch) MarshalJSON() ([]byte, error) {
+
+	entries, err := encodeDataList(d.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Entries []taggedData `json:"entries"`
+	}{Entries: entries})
+}
+
+// UnmarshalJSON is a custom JSON unmarshaller that decodes each of the batch's entries with the decoder registered
+// for its type
+func (d *DataBatch) UnmarshalJSON(bytes []byte) error {
+
+	var raw struct {
+		Entries []taggedData `json:"entries"`
+	}
+
+	err := json.Unmarshal(bytes, &raw)
+	if err != nil {
+		return err
+	}
+
+	d.Entries, err = decodeDataList(raw.Entries)
+	return err
+}
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(DataBatch{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var d DataBatch
+		err := json.Unmarshal(raw, &d)
+		return d, err
+	})
+
+	RegisterCommand("MINE", DataBatch{}.GetType())
+}
+
 // =========== Chain ===========
 
 // Chain contains a slice, or chain, of blocks, representing a blockchain
@@ -48,6 +231,11 @@ func (c Chain) GetData() Data {
 	return c
 }
 
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (c Chain) GetType() string {
+	return "chain"
+}
+
 // ToString is the interface method that is required to transform the Data object into a string for communication
 func (c Chain) ToString() string {
 	b, err := json.Marshal(c)
@@ -58,6 +246,17 @@ func (c Chain) ToString() string {
 	return string(b)
 }
 
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(Chain{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var c Chain
+		err := json.Unmarshal(raw, &c)
+		return c, err
+	})
+
+	RegisterCommand("PEER_CHAIN", Chain{}.GetType())
+}
+
 // =========== PeerChains ===========
 
 // PeerChains is a list of all the copies of the blockchain on the network
@@ -70,6 +269,11 @@ func (p PeerChains) GetData() Data {
 	return p
 }
 
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (p PeerChains) GetType() string {
+	return "peerChains"
+}
+
 // ToString is the interface method that is required to transform the Data object into a string for communication
 func (p PeerChains) ToString() string {
 	b, err := json.Marshal(p)
@@ -80,12 +284,60 @@ func (p PeerChains) ToString() string {
 	return string(b)
 }
 
+// Register the decoder for the Data object
+func init() {
+	RegisterDataType(PeerChains{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var p PeerChains
+		err := json.Unmarshal(raw, &p)
+		return p, err
+	})
+}
+
+// =========== PeerList ===========
+
+// PeerList is a list of the peers that a node knows about, which is shared with other nodes during peer exchange
+type PeerList struct {
+	Peers []PeerAddress `json:"peers"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (p PeerList) GetData() Data {
+	return p
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (p PeerList) GetType() string {
+	return "peerList"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (p PeerList) ToString() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(PeerList{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var p PeerList
+		err := json.Unmarshal(raw, &p)
+		return p, err
+	})
+
+	RegisterCommand("PEERS", PeerList{}.GetType())
+}
+
 // =========== LotteryEntry ===========
 
-// LotteryEntry represents one entry in the proof of stake lottery
+// LotteryEntry represents one entry in the proof of stake lottery, which is a peer's signed election entry along
+// with the address of the peer that sent it
 type LotteryEntry struct {
-	Stake int         `json:"stake"`
-	Peer  PeerAddress `json:"peer"`
+	Entry ElectionEntry `json:"entry"`
+	Peer  PeerAddress   `json:"peer"`
 }
 
 // GetData is the interface method that is required to retrieve Data object
@@ -93,6 +345,11 @@ func (l LotteryEntry) GetData() Data {
 	return l
 }
 
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (l LotteryEntry) GetType() string {
+	return "lotteryEntry"
+}
+
 // ToString is the interface method that is required to transform the Data object into a string for communication
 func (l LotteryEntry) ToString() string {
 	b, err := json.Marshal(l)
@@ -103,6 +360,17 @@ func (l LotteryEntry) ToString() string {
 	return string(b)
 }
 
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(LotteryEntry{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var l LotteryEntry
+		err := json.Unmarshal(raw, &l)
+		return l, err
+	})
+
+	RegisterCommand("STAKE", LotteryEntry{}.GetType())
+}
+
 // =========== CandidateBlock ===========
 
 // CandidateBlock represents a peer's mined block that must be validated
@@ -116,6 +384,11 @@ func (c CandidateBlock) GetData() Data {
 	return c
 }
 
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (c CandidateBlock) GetType() string {
+	return "candidateBlock"
+}
+
 // ToString is the interface method that is required to transform the Data object into a string for communication
 func (c CandidateBlock) ToString() string {
 	b, err := json.Marshal(c)
@@ -126,25 +399,135 @@ func (c CandidateBlock) ToString() string {
 	return string(b)
 }
 
-// =========== PublicKey ===========
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(CandidateBlock{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var c CandidateBlock
+		err := json.Unmarshal(raw, &c)
+		return c, err
+	})
+
+	RegisterCommand("PROOF", CandidateBlock{}.GetType())
+	RegisterCommand("VALIDATE", CandidateBlock{}.GetType())
+}
+
+// =========== HeaderChain ===========
 
-// PublicKey represents a peer's mined block that must be validated
-type PublicKey struct {
-	X string `json:"x"`
-	Y string `json:"y"`
+// HeaderChain contains only the headers of a chain's blocks, which is all that a light client stores
+type HeaderChain struct {
+	Headers []BlockHeader `json:"headers"`
 }
 
 // GetData is the interface method that is required to retrieve Data object
-func (pk PublicKey) GetData() Data {
-	return pk
+func (h HeaderChain) GetData() Data {
+	return h
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (h HeaderChain) GetType() string {
+	return "headerChain"
 }
 
 // ToString is the interface method that is required to transform the Data object into a string for communication
-func (pk PublicKey) ToString() string {
-	b, err := json.Marshal(pk)
+func (h HeaderChain) ToString() string {
+	b, err := json.Marshal(h)
 	if err != nil {
 		fmt.Println(err)
 		return ""
 	}
 	return string(b)
 }
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(HeaderChain{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var h HeaderChain
+		err := json.Unmarshal(raw, &h)
+		return h, err
+	})
+
+	RegisterCommand("PEER_HEADERS", HeaderChain{}.GetType())
+}
+
+// =========== MerkleProofRequest ===========
+
+// MerkleProofRequest asks a full peer to prove that the entry with the given leaf hash is included in a block
+type MerkleProofRequest struct {
+	BlockIndex int    `json:"blockIndex"`
+	Leaf       string `json:"leaf"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (m MerkleProofRequest) GetData() Data {
+	return m
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (m MerkleProofRequest) GetType() string {
+	return "merkleProofRequest"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (m MerkleProofRequest) ToString() string {
+	b, err := json.Marshal(m)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(MerkleProofRequest{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var m MerkleProofRequest
+		err := json.Unmarshal(raw, &m)
+		return m, err
+	})
+
+	RegisterCommand("GET_MERKLE_PROOF", MerkleProofRequest{}.GetType())
+}
+
+// =========== MerkleProof ===========
+
+// MerkleProof is a Merkle branch proving that the entry with the given leaf hash is included in a block. The branch
+// holds the sibling hashes on the path from the leaf up to the root, starting at the bottom of the tree. Leaves is the
+// number of entries in the block, which says at which levels the path has no sibling
+type MerkleProof struct {
+	BlockIndex int      `json:"blockIndex"`
+	Leaf       string   `json:"leaf"`
+	Position   int      `json:"position"`
+	Leaves     int      `json:"leaves"`
+	Branch     []string `json:"branch"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (m MerkleProof) GetData() Data {
+	return m
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (m MerkleProof) GetType() string {
+	return "merkleProof"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (m MerkleProof) ToString() string {
+	b, err := json.Marshal(m)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(MerkleProof{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var m MerkleProof
+		err := json.Unmarshal(raw, &m)
+		return m, err
+	})
+
+	RegisterCommand("MERKLE_PROOF", MerkleProof{}.GetType())
+}
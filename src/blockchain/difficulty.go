@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ============================ Difficulty ============================
+
+// MAX_TARGET_ADJUSTMENT is the most that a single retarget can multiply or divide the proof of work target by, so
+// that a few blocks with unusual timestamps can't swing the difficulty too far
+const MAX_TARGET_ADJUSTMENT = 4
+
+// maxTarget is the easiest possible target, 2^256 - 1, which every hash meets
+var maxTarget = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// A proof of work target is a 256 bit number written as 64 lowercase hex characters, and a block's hash meets the
+// target if the hash, read as a number, is less than or equal to it. Halving the target doubles the work that is
+// expected to find a block, and since any value can be chosen the difficulty can be adjusted in small steps rather
+// than a whole hex character at a time.
+
+// TargetFromDifficulty returns the target that is met by exactly the hashes that start with the passed number of
+// zero hex characters, which is how the difficulty of the first block is configured
+func TargetFromDifficulty(zeros int) string {
+	if zeros <= 0 {
+		return encodeTarget(maxTarget)
+	}
+	if zeros > 63 {
+		zeros = 63
+	}
+
+	target := new(big.Int).Rsh(maxTarget, uint(4*zeros))
+	return encodeTarget(target)
+}
+
+// ParseTarget decodes a target, which must be 64 lowercase hex characters and not 0
+func ParseTarget(target string) (*big.Int, error) {
+
+	if len(target) != 64 {
+		return nil, fmt.Errorf("target must be 64 hex characters, not %d", len(target))
+	}
+
+	decoded, ok := new(big.Int).SetString(target, 16)
+	if !ok || encodeTarget(decoded) != target {
+		return nil, errors.New("target must be lowercase hex")
+	}
+
+	if decoded.Sign() == 0 {
+		return nil, errors.New("target must not be 0")
+	}
+
+	return decoded, nil
+}
+
+// HashMeetsTarget returns true if the passed hex hash, read as a number, is less than or equal to the target
+func HashMeetsTarget(hash string, target string) bool {
+
+	t, err := ParseTarget(target)
+	if err != nil || len(hash) != 64 {
+		return false
+	}
+
+	h, ok := new(big.Int).SetString(hash, 16)
+	if !ok {
+		return false
+	}
+
+	return h.Cmp(t) <= 0
+}
+
+// TargetDifficulty returns how many times more work the target takes to meet than the easiest possible target,
+// which is easier for people to compare than the targets themselves
+func TargetDifficulty(target string) float64 {
+
+	t, err := ParseTarget(target)
+	if err != nil {
+		return 0
+	}
+
+	difficulty, _ := new(big.Float).Quo(new(big.Float).SetInt(maxTarget), new(big.Float).SetInt(t)).Float64()
+	return difficulty
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// encodeTarget writes a target as 64 lowercase hex characters
+func encodeTarget(target *big.Int) string {
+	return fmt.Sprintf("%064x", target)
+}
+
+// retarget scales the target by how long the blocks actually took compared to how long they were expected to take,
+// so that slow blocks make the target easier and fast blocks make it harder. The change is limited to a factor of
+// MAX_TARGET_ADJUSTMENT, and the target never gets easier than maxTarget
+func retarget(target *big.Int, actual time.Duration, expected time.Duration) *big.Int {
+
+	if actual < expected/MAX_TARGET_ADJUSTMENT {
+		actual = expected / MAX_TARGET_ADJUSTMENT
+	}
+	if actual > expected*MAX_TARGET_ADJUSTMENT {
+		actual = expected * MAX_TARGET_ADJUSTMENT
+	}
+
+	adjusted := new(big.Int).Mul(target, big.NewInt(int64(actual)))
+	adjusted.Quo(adjusted, big.NewInt(int64(expected)))
+
+	if adjusted.Sign() == 0 {
+		adjusted.SetInt64(1)
+	}
+	if adjusted.Cmp(maxTarget) > 0 {
+		adjusted.Set(maxTarget)
+	}
+
+	return adjusted
+}
@@ -0,0 +1,117 @@
+package blockchain
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetarget(t *testing.T) {
+
+	target := big.NewInt(1000)
+	expected := 100 * time.Second
+
+	tests := []struct {
+		name     string
+		target   *big.Int
+		actual   time.Duration
+		adjusted *big.Int
+	}{
+		{"on time", target, expected, big.NewInt(1000)},
+		{"twice as slow", target, 2 * expected, big.NewInt(2000)},
+		{"twice as fast", target, expected / 2, big.NewInt(500)},
+		{"slower than the limit", target, 10 * expected, big.NewInt(4000)},
+		{"faster than the limit", target, expected / 10, big.NewInt(250)},
+		{"no time at all", target, 0, big.NewInt(250)},
+		{"timestamps going backwards", target, -expected, big.NewInt(250)},
+		{"never below 1", big.NewInt(1), expected / 2, big.NewInt(1)},
+		{"never above the easiest target", maxTarget, 2 * expected, maxTarget},
+	}
+
+	for _, test := range tests {
+		adjusted := retarget(new(big.Int).Set(test.target), test.actual, expected)
+		if adjusted.Cmp(test.adjusted) != 0 {
+			t.Errorf("%s: target is %v, expected %v", test.name, adjusted, test.adjusted)
+		}
+	}
+}
+
+// timedHeaders returns a chain of headers whose blocks were created the passed time apart and carry the passed target
+func timedHeaders(count int, apart time.Duration, target string) []BlockHeader {
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	headers := []BlockHeader{}
+	for i := 0; i < count; i++ {
+		headers = append(headers, BlockHeader{Index: i, Timestamp: start.Add(time.Duration(i) * apart).Format(BLOCK_TIME_FORMAT), Target: target})
+	}
+
+	return headers
+}
+
+func TestNextTarget(t *testing.T) {
+
+	p := &ProofOfWork{ProofDifficulty: 2, TargetBlockTime: 10 * time.Second, RetargetInterval: 4}
+
+	initial := TargetFromDifficulty(2)
+	parsed, _ := ParseTarget(initial)
+	doubled := encodeTarget(new(big.Int).Mul(parsed, big.NewInt(2)))
+	halved := encodeTarget(new(big.Int).Quo(parsed, big.NewInt(2)))
+
+	tests := []struct {
+		name    string
+		headers []BlockHeader
+		target  string
+	}{
+		{"first block", timedHeaders(1, 10*time.Second, ""), initial},
+		{"between retargets", timedHeaders(3, 20*time.Second, initial), initial},
+		{"retarget on time", timedHeaders(5, 10*time.Second, initial), initial},
+		{"retarget after slow blocks", timedHeaders(5, 20*time.Second, initial), doubled},
+		{"retarget after fast blocks", timedHeaders(5, 5*time.Second, initial), halved},
+		{"after a retarget", timedHeaders(6, 5*time.Second, initial), initial},
+		{"second retarget", timedHeaders(9, 20*time.Second, initial), doubled},
+	}
+
+	for _, test := range tests {
+		target := p.NextTarget(test.headers)
+		if target != test.target {
+			t.Errorf("%s: target is %s, expected %s", test.name, target, test.target)
+		}
+	}
+
+	// Without a retarget interval, the target of the first block is kept
+	fixed := &ProofOfWork{ProofDifficulty: 2}
+	if target := fixed.NextTarget(timedHeaders(9, time.Hour, initial)); target != initial {
+		t.Errorf("target changed without retargeting: %s", target)
+	}
+}
+
+func TestTargetFromDifficulty(t *testing.T) {
+
+	tests := []struct {
+		zeros  int
+		target string
+	}{
+		{-1, strings.Repeat("f", 64)},
+		{0, strings.Repeat("f", 64)},
+		{1, "0" + strings.Repeat("f", 63)},
+		{5, "00000" + strings.Repeat("f", 59)},
+		{64, strings.Repeat("0", 63) + "f"},
+	}
+
+	for _, test := range tests {
+		target := TargetFromDifficulty(test.zeros)
+		if target != test.target {
+			t.Errorf("%d zeros: target is %s", test.zeros, target)
+		}
+
+		if !HashMeetsTarget(target, target) {
+			t.Errorf("%d zeros: target doesn't meet itself", test.zeros)
+		}
+	}
+
+	if HashMeetsTarget("1"+strings.Repeat("0", 63), TargetFromDifficulty(1)) {
+		t.Error("hash without a leading zero met a target of 1 zero")
+	}
+}
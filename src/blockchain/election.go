@@ -0,0 +1,393 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ============================ Proof of Stake Election ============================
+
+// The producer of every proof of stake block is elected with a commit-reveal scheme, so that the draw can't be
+// predicted or steered by any single node, including the Middleware, and can be checked by every peer:
+//
+//  1. Every peer that wants to produce the block picks a random secret and sends the Middleware a signed
+//     ElectionEntry, which holds its stake and the hash of its secret, its commitment
+//  2. Once entries are closed, the Middleware sends every peer the list of entries, and each peer reveals its secret
+//  3. The revealed entries make up the Election, along with an absent entry for every other validator, which can't
+//     be elected. Its seed is the hash of the previous block's hash, the election's round and every secret, and the
+//     seed picks the leader among the revealed entries, with a chance in proportion to their stake
+//  4. The leader records the Election in its block, right after the coinbase, and signs the block
+//
+// Peers reject a block unless its Election has an entry for every validator of the chain before it, and the block
+// was produced and signed by the Election's leader. As with any commit-reveal scheme, the last entrant to reveal can
+// only choose between the outcome with its secret and the outcome without its entry, which is the best it can do to
+// influence the draw. If the leader misses its slot, the Middleware runs the next round, which draws again without
+// the leaders of the earlier rounds. The block of a later round records the missed slot of every earlier round's
+// leader right after the Election, and the Election's round must be the number of missed slots it records, so the
+// producer can't choose the round.
+//
+// An absent entry carries no signature, as the validator it records didn't take part, so nothing but the other entries
+// shows that it really was absent. To keep a validator from marking every other validator absent and electing itself,
+// peers also reject an Election whose revealed entries don't stake more than half of the bonded stake. Some trust in
+// the Middleware is left, as it is the one node that learns every secret before the draw, and it could mark entries
+// holding less than half of the stake absent to steer the draw. Until stake is bonded there are no validators to
+// check an Election against, so any entrant can elect itself. Blocks are only produced while validators holding a
+// majority of the stake reveal their secrets.
+
+// =========== ElectionEntry ===========
+
+// ElectionEntry is a peer's entry into the election of the producer of the block at Height, which must follow the
+// block with PrevHash. Its Stake weighs its chance of being elected and may be no more than the balance of its Address.
+// The entry is signed by the key of its Address, and Secret is left empty until every entry has been committed to.
+// A validator that didn't enter or didn't reveal its secret is recorded with an absent entry, which only holds the
+// Height, PrevHash, Address and Stake
+type ElectionEntry struct {
+	Height     int    `json:"height"`
+	PrevHash   string `json:"prevHash"`
+	Address    string `json:"address"`
+	Stake      int    `json:"stake"`
+	Commitment string `json:"commitment"`
+	PublicKey  string `json:"publicKey"`
+	Signature  string `json:"signature"`
+	Secret     string `json:"secret,omitempty"`
+}
+
+// =========== Election ===========
+
+// Election is a type of Data that records the entries of a proof of stake election and their revealed secrets, so
+// that every peer can check which peer was elected to produce the block. Entries are listed in order of address.
+// Round is the number of leaders that missed their slot before the block was produced
+type Election struct {
+	Height   int             `json:"height"`
+	PrevHash string          `json:"prevHash"`
+	Round    int             `json:"round"`
+	Entries  []ElectionEntry `json:"entries"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (e Election) GetData() Data {
+	return e
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (e Election) GetType() string {
+	return "election"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (e Election) ToString() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object and the commands whose messages carry it, and allow it to be carried in
+// blocks
+func init() {
+	RegisterDataType(Election{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var e Election
+		err := json.Unmarshal(raw, &e)
+		return e, err
+	})
+
+	RegisterCommand("REVEAL", Election{}.GetType())
+	RegisterCommand("WINNER", Election{}.GetType())
+
+	RegisterPayloadType(Election{}.GetType(), func(d Data) error {
+		e := d.(Election)
+		if e.Height < 1 {
+			return errors.New("election must be for a block after the genesis block")
+		}
+		if e.Round < 0 {
+			return errors.New("election round must not be negative")
+		}
+		if len(e.Entries) == 0 {
+			return errors.New("election must have at least one entry")
+		}
+		revealed := 0
+		for i, entry := range e.Entries {
+			if !ValidAddress(entry.Address) {
+				return fmt.Errorf("entry %d is not from a wallet address", i)
+			}
+			if i > 0 && entry.Address <= e.Entries[i-1].Address {
+				return errors.New("election entries must be listed once each, in order of address")
+			}
+			if entry.Stake < 1 {
+				return fmt.Errorf("stake of entry %d must be at least 1", i)
+			}
+			if !entry.absent() {
+				revealed++
+			}
+		}
+		if revealed <= e.Round {
+			return fmt.Errorf("election has %d revealed entries, which can't elect a leader in round %d", revealed, e.Round)
+		}
+		return nil
+	}, canonicalElection)
+}
+
+// =========== ElectionReveal ===========
+
+// ElectionReveal is sent by a peer to the Middleware to reveal the secret behind its election entry
+type ElectionReveal struct {
+	Height  int    `json:"height"`
+	Address string `json:"address"`
+	Secret  string `json:"secret"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (r ElectionReveal) GetData() Data {
+	return r
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (r ElectionReveal) GetType() string {
+	return "electionReveal"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (r ElectionReveal) ToString() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(ElectionReveal{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var r ElectionReveal
+		err := json.Unmarshal(raw, &r)
+		return r, err
+	})
+
+	// REVEAL also carries the Election to peers, so its handlers must check which one they received
+	RegisterCommand("REVEAL", ElectionReveal{}.GetType())
+}
+
+// =========== Draw ===========
+
+// NewElectionSecret returns a random secret for an election entry, along with its commitment
+func NewElectionSecret() (string, string, error) {
+
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	encoded := hex.EncodeToString(secret)
+	return encoded, ElectionCommitment(encoded), nil
+}
+
+// ElectionCommitment returns the commitment to a secret, which is the hex encoded SHA-256 hash of the secret
+func ElectionCommitment(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// Seed returns the election's random seed, the SHA-256 hash of its canonical seed bytes, see ElectionSeedBytes
+func (e Election) Seed() []byte {
+	hash := sha256.Sum256(ElectionSeedBytes(e))
+	return hash[:]
+}
+
+// Leader returns the address of the entry that the election's round elects. Every round draws among the revealed
+// entries whose leaders didn't miss the slot of an earlier round. Each of them owns a range of numbers as wide as its
+// stake, in the order the entries are listed, and the round's leader is the owner of the round's seed modulo their
+// total stake
+func (e Election) Leader() (string, error) {
+
+	missed := make(map[string]bool)
+	for round := 0; round <= e.Round; round++ {
+		leader, err := e.draw(round, missed)
+		if err != nil {
+			return "", err
+		}
+
+		if round == e.Round {
+			return leader, nil
+		}
+		missed[leader] = true
+	}
+
+	return "", errors.New("election round must not be negative")
+}
+
+// MissedSlots returns the evidence that the leader of every round before the election's round missed its slot, in
+// order of round. The block produced by the election records it right after the election
+func (e Election) MissedSlots() ([]SlashingEvidence, error) {
+
+	missed := []SlashingEvidence{}
+	for round := 0; round < e.Round; round++ {
+		earlier := e
+		earlier.Round = round
+
+		evidence, err := NewMissedSlotEvidence(earlier)
+		if err != nil {
+			return nil, fmt.Errorf("evidence of the missed slot of round %d is invalid: %v", round, err)
+		}
+		missed = append(missed, evidence)
+	}
+
+	return missed, nil
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// absent returns true if the entry records a validator that didn't enter the election or didn't reveal its secret
+func (entry ElectionEntry) absent() bool {
+	return entry.Commitment == "" && entry.Secret == ""
+}
+
+// draw returns the leader of a round of the election, drawn among the revealed entries that aren't in missed
+func (e Election) draw(round int, missed map[string]bool) (string, error) {
+
+	candidates := []ElectionEntry{}
+	total := 0
+	for _, entry := range e.Entries {
+		if entry.absent() || missed[entry.Address] {
+			continue
+		}
+		candidates = append(candidates, entry)
+		total += entry.Stake
+	}
+
+	if total <= 0 {
+		return "", fmt.Errorf("election has no stake left to draw round %d from", round)
+	}
+
+	// The seed of every round is that of the election held in that round
+	held := e
+	held.Round = round
+
+	pick := new(big.Int).SetBytes(held.Seed())
+	pick.Mod(pick, big.NewInt(int64(total)))
+
+	for _, entry := range candidates {
+		if pick.Int64() < int64(entry.Stake) {
+			return entry.Address, nil
+		}
+		pick.Sub(pick, big.NewInt(int64(entry.Stake)))
+	}
+
+	return "", fmt.Errorf("election has no stake left to draw round %d from", round)
+}
+
+// checkElection checks that a block records a valid election, held for the block's position in the chain, and that
+// the block's producer won it. The election's round is taken from the missed slots that the block records right after
+// the election, which must be one for every earlier round of the same election, in order. Whether the entries match
+// the validator set of the chain before the block is checked by the Ledger, see Ledger.CheckElection
+func checkElection(b Block) error {
+
+	var election *Election
+	for i, d := range b.Data {
+		e, ok := d.(Election)
+		if !ok {
+			continue
+		}
+		if i != 1 || election != nil {
+			return errors.New("election must be the entry right after the coinbase")
+		}
+		election = &e
+	}
+
+	if election == nil {
+		return errors.New("block has no election")
+	}
+
+	if election.Height != b.Index || election.PrevHash != b.PrevHash {
+		return errors.New("election was held for another block")
+	}
+
+	err := checkElectionEntries(*election)
+	if err != nil {
+		return err
+	}
+
+	missed := 0
+	for i, d := range b.Data {
+		evidence, ok := d.(SlashingEvidence)
+		if !ok || evidence.Offence != OFFENCE_MISSED_SLOT {
+			continue
+		}
+		if i != 2+missed {
+			return errors.New("missed slots must be recorded right after the election")
+		}
+		if evidence.Election == nil || evidence.Election.Round != missed || !sameElection(*evidence.Election, *election) {
+			return fmt.Errorf("missed slot %d is not round %d of the block's election", missed, missed)
+		}
+		missed++
+	}
+
+	if election.Round != missed {
+		return fmt.Errorf("election claims round %d, but the block records %d missed slots", election.Round, missed)
+	}
+
+	leader, err := election.Leader()
+	if err != nil {
+		return err
+	}
+
+	if leader != b.Miner {
+		return fmt.Errorf("block was produced by %s, but %s was elected", b.Miner, leader)
+	}
+
+	return nil
+}
+
+// checkElectionEntries checks that every entry of an election was made for the election's block. A revealed entry
+// must be signed by its address and carry the secret behind its commitment, and an absent entry must carry neither
+func checkElectionEntries(election Election) error {
+
+	for i, entry := range election.Entries {
+		if entry.Height != election.Height || entry.PrevHash != election.PrevHash {
+			return fmt.Errorf("election entry %d was made for another block", i)
+		}
+
+		if entry.absent() {
+			if entry.PublicKey != "" || entry.Signature != "" {
+				return fmt.Errorf("absent election entry %d must not be signed", i)
+			}
+			continue
+		}
+
+		err := VerifyElectionEntry(entry)
+		if err != nil {
+			return fmt.Errorf("election entry %d is invalid: %v", i, err)
+		}
+
+		if ElectionCommitment(entry.Secret) != entry.Commitment {
+			return fmt.Errorf("secret of election entry %d does not match its commitment", i)
+		}
+	}
+
+	return nil
+}
+
+// sameElection returns true if both elections were held for the same block among the same entries, whatever their
+// rounds
+func sameElection(a Election, b Election) bool {
+
+	if a.Height != b.Height || a.PrevHash != b.PrevHash || len(a.Entries) != len(b.Entries) {
+		return false
+	}
+
+	for i := range a.Entries {
+		if a.Entries[i] != b.Entries[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,279 @@
+package blockchain
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// parent is the hash of the block that the elections of the tests follow, at height 1
+var parent = strings.Repeat("f", 64)
+
+// enter returns the wallet's signed and revealed entry into the election of the block at height 2
+func (w wallet) enter(t *testing.T, stake int) ElectionEntry {
+	return w.enterAt(t, 2, parent, stake)
+}
+
+// enterAt returns the wallet's signed and revealed entry into the election of the block at the passed height, which
+// follows the block with the passed hash
+func (w wallet) enterAt(t *testing.T, height int, prevHash string, stake int) ElectionEntry {
+
+	secret, commitment, err := NewElectionSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := SignElectionEntry(ElectionEntry{Height: height, PrevHash: prevHash, Address: w.address, Stake: stake, Commitment: commitment}, w.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Secret = secret
+
+	return entry
+}
+
+// absentEntry returns the entry that records a validator as absent from the election of the block at height 2
+func absentEntry(w wallet, stake int) ElectionEntry {
+	return ElectionEntry{Height: 2, PrevHash: parent, Address: w.address, Stake: stake}
+}
+
+// newElection returns the election of the passed round of the block at height 2, with its entries in order of address
+func newElection(round int, entries ...ElectionEntry) Election {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Address < entries[j].Address })
+	return Election{Height: 2, PrevHash: parent, Round: round, Entries: entries}
+}
+
+// produce returns the block at height 2 that the wallet produces and signs with the passed entries after its coinbase
+func (w wallet) produce(t *testing.T, entries ...Data) Block {
+	return w.produceAt(t, 2, parent, entries...)
+}
+
+// produceAt returns the block at the passed height, following the block with the passed hash, that the wallet
+// produces and signs with the passed entries after its coinbase
+func (w wallet) produceAt(t *testing.T, height int, prevHash string, entries ...Data) Block {
+
+	data := withCoinbase(height, w.address, entries, RewardSchedule{})
+
+	b := Block{BlockHeader: BlockHeader{
+		Index:      height,
+		Timestamp:  newTimestamp(),
+		PrevHash:   prevHash,
+		MerkleRoot: MerkleRoot(data),
+		Miner:      w.address,
+		PublicKey:  EncodePublicKey(&w.key.PublicKey)}, Data: data}
+	b.Hash = (&ProofOfStake{}).CalculateHash(b)
+
+	b, err := SignBlock(b, w.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// leaderOf returns the wallet that the election elects
+func leaderOf(t *testing.T, election Election, wallets ...wallet) wallet {
+
+	leader, err := election.Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range wallets {
+		if w.address == leader {
+			return w
+		}
+	}
+
+	t.Fatalf("%s was elected, but isn't one of the wallets", leader)
+	return wallet{}
+}
+
+// missedSlots returns the evidence of the missed slots of the election's earlier rounds
+func missedSlots(t *testing.T, election Election) []Data {
+
+	evidence, err := election.MissedSlots()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missed := []Data{}
+	for _, e := range evidence {
+		missed = append(missed, e)
+	}
+	return missed
+}
+
+// validatorLedger returns the Ledger of the chain up to height 1, in which every wallet has bonded the passed stake
+func validatorLedger(wallets []wallet, stakes []int) *Ledger {
+
+	allocations, bonds := []Data{}, []Data{}
+	for i, w := range wallets {
+		allocations = append(allocations, Allocation{To: w.address, Amount: 100})
+		bonds = append(bonds, Transaction{Kind: TRANSACTION_STAKE, From: w.address, Amount: stakes[i], Nonce: 0})
+	}
+
+	l := NewLedger()
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 0}, Data: allocations})
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 1}, Data: bonds, Hash: parent})
+
+	return l
+}
+
+func TestElectionLeaderIsDrawnByStake(t *testing.T) {
+
+	a, b, c := newWallet(t), newWallet(t), newWallet(t)
+
+	// Only a revealed entry can be elected, whatever the stake of the absent ones
+	only := newElection(0, a.enter(t, 1), absentEntry(b, 1000), absentEntry(c, 1000))
+	if leaderOf(t, only, a, b, c) != a {
+		t.Error("an absent entry was elected")
+	}
+
+	// Every secret changes the seed, so the leader is drawn again, with a chance in proportion to its stake
+	wins := map[string]int{}
+	for i := 0; i < 200; i++ {
+		election := newElection(0, a.enter(t, 3), b.enter(t, 1), absentEntry(c, 1000))
+
+		leader := leaderOf(t, election, a, b, c)
+		if leaderOf(t, election, a, b, c) != leader {
+			t.Fatal("the same election elected two leaders")
+		}
+		wins[leader.address]++
+	}
+
+	if wins[c.address] != 0 || wins[b.address] == 0 || wins[a.address] <= wins[b.address] {
+		t.Errorf("leaders weren't drawn by stake: %d, %d and %d wins", wins[a.address], wins[b.address], wins[c.address])
+	}
+}
+
+func TestElectionLeaderExcludesEarlierLeaders(t *testing.T) {
+
+	a, b, c, d := newWallet(t), newWallet(t), newWallet(t), newWallet(t)
+	election := newElection(0, a.enter(t, 1), b.enter(t, 2), c.enter(t, 3), absentEntry(d, 4))
+
+	leaders := map[string]bool{}
+	for round := 0; round < 3; round++ {
+		election.Round = round
+
+		leader := leaderOf(t, election, a, b, c, d)
+		if leaders[leader.address] {
+			t.Errorf("round %d elected the leader of an earlier round", round)
+		}
+		leaders[leader.address] = true
+
+		evidence := missedSlots(t, election)
+		if len(evidence) != round {
+			t.Fatalf("round %d has %d missed slots", round, len(evidence))
+		}
+		for i, e := range evidence {
+			if e.(SlashingEvidence).Election.Round != i {
+				t.Errorf("round %d: missed slot %d is of round %d", round, i, e.(SlashingEvidence).Election.Round)
+			}
+		}
+	}
+
+	// Every revealed entry has led a round, so there is nobody left to draw
+	election.Round = 3
+	_, err := election.Leader()
+	if err == nil {
+		t.Error("a round was drawn after every revealed entry had missed its slot")
+	}
+}
+
+func TestCheckElection(t *testing.T) {
+
+	a, b, c := newWallet(t), newWallet(t), newWallet(t)
+	wallets := []wallet{a, b, c}
+
+	election := newElection(0, a.enter(t, 10), b.enter(t, 10), absentEntry(c, 10))
+	leader := leaderOf(t, election, wallets...)
+
+	var other wallet
+	for _, w := range wallets {
+		if w != leader && w != c {
+			other = w
+		}
+	}
+
+	second := election
+	second.Round = 1
+	secondLeader := leaderOf(t, second, wallets...)
+	missed := missedSlots(t, second)
+
+	otherHeight := election
+	otherHeight.Height = 3
+
+	wrongSecret := newElection(0, a.enter(t, 10), b.enter(t, 10), absentEntry(c, 10))
+	for i := range wrongSecret.Entries {
+		if wrongSecret.Entries[i].Address == a.address {
+			wrongSecret.Entries[i].Secret = "secret"
+		}
+	}
+
+	signedAbsent := newElection(0, a.enter(t, 10), b.enter(t, 10), c.enter(t, 10))
+	for i := range signedAbsent.Entries {
+		if signedAbsent.Entries[i].Address == c.address {
+			signedAbsent.Entries[i].Commitment, signedAbsent.Entries[i].Secret = "", ""
+		}
+	}
+
+	otherElection := newElection(1, a.enter(t, 10), b.enter(t, 10), absentEntry(c, 10))
+
+	tests := []struct {
+		name  string
+		block Block
+		valid bool
+	}{
+		{"produced by the leader", leader.produce(t, election), true},
+		{"produced by another entrant", other.produce(t, election), false},
+		{"produced by an absent validator", c.produce(t, election), false},
+		{"no election", leader.produce(t, Note{Text: "hello"}), false},
+		{"election after another entry", leader.produce(t, Note{Text: "hello"}, election), false},
+		{"election of another block", leader.produce(t, otherHeight), false},
+		{"secret that doesn't match its commitment", leaderOf(t, wrongSecret, wallets...).produce(t, wrongSecret), false},
+		{"signed absent entry", leaderOf(t, signedAbsent, wallets...).produce(t, signedAbsent), false},
+		{"later round with its missed slot", secondLeader.produce(t, append([]Data{second}, missed...)...), true},
+		{"later round without its missed slot", secondLeader.produce(t, second), false},
+		{"missed slot after another entry", secondLeader.produce(t, second, Note{Text: "hello"}, missed[0]), false},
+		{"missed slot of a round that wasn't held", leader.produce(t, append([]Data{election}, missed...)...), false},
+		{"missed slot of another election", secondLeader.produce(t, append([]Data{second}, missedSlots(t, otherElection)...)...), false},
+	}
+
+	for _, test := range tests {
+		err := checkElection(test.block)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestSelfElectedBlockIsRejected(t *testing.T) {
+
+	a, b, c := newWallet(t), newWallet(t), newWallet(t)
+	wallets, stakes := []wallet{a, b, c}, []int{50, 30, 20}
+
+	tests := []struct {
+		name     string
+		election Election
+		valid    bool
+	}{
+		{"majority of the stake revealed", newElection(0, a.enter(t, 50), b.enter(t, 30), absentEntry(c, 20)), true},
+		{"every other validator marked absent", newElection(0, absentEntry(a, 50), absentEntry(b, 30), c.enter(t, 20)), false},
+		{"half of the stake revealed", newElection(0, a.enter(t, 50), absentEntry(b, 30), absentEntry(c, 20)), false},
+	}
+
+	for _, test := range tests {
+		block := leaderOf(t, test.election, wallets...).produce(t, test.election)
+
+		// Without the chain, nothing shows that the absent validators didn't take part
+		if !(&ProofOfStake{}).ValidateBlock(block, nil) {
+			t.Errorf("%s: block was rejected without the chain", test.name)
+		}
+
+		err := validateBlockState(block, validatorLedger(wallets, stakes))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
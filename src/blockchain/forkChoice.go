@@ -0,0 +1,39 @@
+package blockchain
+
+import (
+	"math/big"
+)
+
+// ============================ Fork Choice ============================
+
+// DEFAULT_FINALITY_DEPTH is the number of blocks that must be built on top of a block before a ProofOfStake Peer
+// considers it final, if no FinalityDepth is set
+const DEFAULT_FINALITY_DEPTH = 6
+
+// ChainWork returns the total proof of work of the passed headers, which is the number of hashes that are expected
+// to be tried to mine all of them. A header's work is 2^256 / (target + 1), so a block whose target is half as large
+// counts twice as much. Headers without a target, such as the genesis block or blocks mined by proof of stake, count
+// for nothing. The targets are taken as they are, so the headers must have been checked to meet them
+func ChainWork(headers []BlockHeader) *big.Int {
+
+	total := new(big.Int)
+	for _, h := range headers {
+		total.Add(total, headerWork(h))
+	}
+
+	return total
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// headerWork returns the expected number of hashes that were tried to mine the header
+func headerWork(h BlockHeader) *big.Int {
+
+	target, err := ParseTarget(h.Target)
+	if err != nil {
+		return new(big.Int)
+	}
+
+	space := new(big.Int).Lsh(big.NewInt(1), 256)
+	return space.Quo(space, target.Add(target, big.NewInt(1)))
+}
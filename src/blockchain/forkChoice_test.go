@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// entrant is a wallet that enters the elections of a test chain with the passed stake
+type entrant struct {
+	wallet
+	stake int
+}
+
+// extendChain returns a copy of the chain with a block added for each of the passed groups of entrants. Every entrant
+// of a group enters the election of its block, and the elected one produces it
+func extendChain(t *testing.T, chain []Block, groups ...[]entrant) []Block {
+
+	extended := append([]Block{}, chain...)
+	for _, group := range groups {
+		prev := extended[len(extended)-1]
+		height := len(extended)
+
+		election := Election{Height: height, PrevHash: prev.Hash}
+		wallets := []wallet{}
+		for _, e := range group {
+			election.Entries = append(election.Entries, e.enterAt(t, height, prev.Hash, e.stake))
+			wallets = append(wallets, e.wallet)
+		}
+		sort.Slice(election.Entries, func(i, j int) bool { return election.Entries[i].Address < election.Entries[j].Address })
+
+		extended = append(extended, leaderOf(t, election, wallets...).produceAt(t, height, prev.Hash, election))
+	}
+
+	return extended
+}
+
+// repeat returns the group of entrants the passed number of times
+func repeat(group []entrant, times int) [][]entrant {
+	groups := [][]entrant{}
+	for i := 0; i < times; i++ {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func TestProofOfStakePrefersChainEndorsedByMoreStake(t *testing.T) {
+
+	heavy, light := entrant{newWallet(t), 50}, entrant{newWallet(t), 10}
+	both := []entrant{heavy, light}
+
+	p := &ProofOfStake{FinalityDepth: 3}
+	genesis := []Block{{BlockHeader: BlockHeader{Index: 0}, Hash: GENESIS_HASH}}
+
+	shared := extendChain(t, genesis, both)
+	byLight := extendChain(t, shared, repeat([]entrant{light}, 2)...)
+	byHeavy := extendChain(t, shared, []entrant{heavy})
+	byBoth := extendChain(t, shared, both, both)
+
+	tampered := extendChain(t, shared, []entrant{heavy})
+	tampered[2].Timestamp = time.Now().Add(time.Hour).UTC().Format(BLOCK_TIME_FORMAT)
+
+	tests := []struct {
+		name      string
+		current   []Block
+		candidate []Block
+		preferred bool
+	}{
+		{"shorter chain endorsed by more stake", byLight, byHeavy, true},
+		{"longer chain endorsed by less stake", byHeavy, byLight, false},
+		{"chain endorsed by the same validators again", byHeavy, byBoth, true},
+		{"chain that drops a validator's later endorsement", byBoth, byHeavy, false},
+		{"same chain", byLight, byLight, false},
+		{"part of the current chain", byBoth, byBoth[:3], false},
+		{"extension of the current chain", byBoth[:3], byBoth, true},
+		{"chain whose endorsing block was changed", byLight, tampered, false},
+	}
+
+	for _, test := range tests {
+		if p.PreferChain(test.current, test.candidate) != test.preferred {
+			t.Errorf("%s: expected preferred %v", test.name, test.preferred)
+		}
+	}
+}
+
+func TestProofOfStakeNeverPrefersChainThatRevertsFinalBlocks(t *testing.T) {
+
+	heavy, light := entrant{newWallet(t), 50}, entrant{newWallet(t), 10}
+
+	p := &ProofOfStake{FinalityDepth: 2}
+	genesis := []Block{{BlockHeader: BlockHeader{Index: 0}, Hash: GENESIS_HASH}}
+
+	// Blocks 1 and 2 of the current chain have 2 or more blocks on top of them, so they are final
+	current := extendChain(t, genesis, repeat([]entrant{light}, 4)...)
+
+	if p.PreferChain(current, extendChain(t, current[:1], []entrant{heavy})) {
+		t.Error("chain forking before the first final block was preferred")
+	}
+
+	if p.PreferChain(current, extendChain(t, current[:2], []entrant{heavy})) {
+		t.Error("chain forking before the last final block was preferred")
+	}
+
+	if !p.PreferChain(current, extendChain(t, current[:3], []entrant{heavy})) {
+		t.Error("chain forking after the last final block wasn't preferred")
+	}
+}
+
+// minedHeaders returns a chain of headers mined to the targets that the consensus component sets, whose blocks were
+// created the passed time apart
+func minedHeaders(t *testing.T, p *ProofOfWork, count int, apart time.Duration) []BlockHeader {
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	headers := []BlockHeader{{Index: 0, Timestamp: start.Format(BLOCK_TIME_FORMAT)}}
+	prevHash := GENESIS_HASH
+	for i := 1; i < count; i++ {
+		h := BlockHeader{Index: i, Timestamp: start.Add(time.Duration(i) * apart).Format(BLOCK_TIME_FORMAT), PrevHash: prevHash, Target: p.NextTarget(headers)}
+
+		for !HashMeetsTarget(p.CalculateHash(Block{BlockHeader: h}), h.Target) {
+			h.Nonce++
+		}
+
+		headers = append(headers, h)
+		prevHash = p.CalculateHash(Block{BlockHeader: h})
+	}
+
+	return headers
+}
+
+// withHeaders returns blocks holding only the passed headers, which is all that proof of work fork choice reads
+func withHeaders(headers []BlockHeader) []Block {
+	chain := []Block{}
+	for _, h := range headers {
+		chain = append(chain, Block{BlockHeader: h})
+	}
+	return chain
+}
+
+func TestProofOfWorkPrefersChainWithMostWork(t *testing.T) {
+
+	p := &ProofOfWork{ProofDifficulty: 1, TargetBlockTime: 10 * time.Second, RetargetInterval: 2}
+
+	// Fast blocks make the target of every interval harder, and slow blocks make it easier
+	hard := withHeaders(minedHeaders(t, p, 5, time.Second))
+	easy := withHeaders(minedHeaders(t, p, 9, 100*time.Second))
+
+	broken := withHeaders(minedHeaders(t, p, 5, time.Second))
+	broken[2].PrevHash = GENESIS_HASH
+
+	tests := []struct {
+		name      string
+		current   []Block
+		candidate []Block
+		preferred bool
+	}{
+		{"shorter chain with more work", easy, hard, true},
+		{"longer chain with less work", hard, easy, false},
+		{"same chain", hard, hard, false},
+		{"extension of the current chain", hard[:4], hard, true},
+		{"chain whose work stops at a broken link", easy, broken, false},
+	}
+
+	for _, test := range tests {
+		if p.PreferChain(test.current, test.candidate) != test.preferred {
+			t.Errorf("%s: expected preferred %v", test.name, test.preferred)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+)
+
+// ============================ Genesis ============================
+
+// Every account starts with nothing. Currency only exists once it is recorded on the chain, either as an Allocation
+// in the genesis block or as a block reward. The allocations are part of the network's Genesis, which every Peer and
+// the Middleware of a network must be started with, so that they all create the same genesis block. A chain whose
+// genesis block holds different allocations belongs to a different network, and is rejected.
+
+// networkGenesis is the Genesis of the network that this process takes part in, which has no allocations unless
+// another Genesis is set with SetGenesis
+var networkGenesis = Genesis{}
+var networkGenesisMutex sync.RWMutex
+
+// Genesis describes the genesis block of a network. It is usually loaded from a JSON file, for example:
+//
+//	{"allocations": [{"to": "3f1c9a...", "amount": 10}, {"to": "8be02d...", "amount": 10}]}
+type Genesis struct {
+	Allocations []Allocation `json:"allocations"`
+}
+
+// LoadGenesis reads a Genesis from the JSON file at the passed path and checks that it is valid
+func LoadGenesis(path string) (Genesis, error) {
+
+	var g Genesis
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return g, err
+	}
+
+	err = json.Unmarshal(raw, &g)
+	if err != nil {
+		return g, fmt.Errorf("genesis file %s is malformed: %v", path, err)
+	}
+
+	return g, g.Validate()
+}
+
+// SetGenesis sets the Genesis of the network that this process takes part in. It must be called before any Peer or
+// Middleware is created
+func SetGenesis(g Genesis) error {
+
+	err := g.Validate()
+	if err != nil {
+		return err
+	}
+
+	networkGenesisMutex.Lock()
+	defer networkGenesisMutex.Unlock()
+
+	networkGenesis = Genesis{Allocations: append([]Allocation{}, g.Allocations...)}
+
+	return nil
+}
+
+// NetworkGenesis returns the Genesis of the network that this process takes part in
+func NetworkGenesis() Genesis {
+	networkGenesisMutex.RLock()
+	defer networkGenesisMutex.RUnlock()
+
+	return Genesis{Allocations: append([]Allocation{}, networkGenesis.Allocations...)}
+}
+
+// Validate checks that every allocation pays a positive amount to a wallet address, that no address is allocated to
+// twice and that the allocations don't add up to more currency than can be counted
+func (g Genesis) Validate() error {
+
+	seen := make(map[string]bool)
+	total := 0
+	for i, a := range g.Allocations {
+		if !ValidAddress(a.To) {
+			return fmt.Errorf("allocation %d is not to a wallet address", i)
+		}
+		if a.Amount <= 0 {
+			return fmt.Errorf("allocation %d must be positive", i)
+		}
+		if seen[a.To] {
+			return fmt.Errorf("%s is allocated to more than once", a.To)
+		}
+		if a.Amount > math.MaxInt-total {
+			return errors.New("allocations add up to more currency than can be counted")
+		}
+
+		seen[a.To] = true
+		total += a.Amount
+	}
+
+	return nil
+}
+
+// Block creates and returns the genesis block, which holds the allocations in order. Its hash is always GENESIS_HASH,
+// and its Merkle root commits to the allocations
+func (g Genesis) Block() Block {
+
+	data := []Data{}
+	for _, a := range g.Allocations {
+		data = append(data, a)
+	}
+
+	genesisBlock := Block{}
+	genesisBlock.Index = 0
+	genesisBlock.Timestamp = newTimestamp()
+	genesisBlock.Data = data
+	genesisBlock.PrevHash = ""
+	genesisBlock.MerkleRoot = MerkleRoot(data)
+	genesisBlock.Nonce = 0
+	genesisBlock.Hash = GENESIS_HASH
+
+	return genesisBlock
+}
+
+// =========== Allocation ===========
+
+// Allocation is a type of Data that credits an account with currency when the chain starts. It can only be
+// recorded in the genesis block
+type Allocation struct {
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (a Allocation) GetData() Data {
+	return a
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (a Allocation) GetType() string {
+	return "allocation"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (a Allocation) ToString() string {
+	b, err := json.Marshal(a)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object. The genesis block isn't mined, so an allocation is never a valid payload
+// of a mined block or the mempool, see checkGenesis
+func init() {
+	RegisterDataType(Allocation{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var a Allocation
+		err := json.Unmarshal(raw, &a)
+		return a, err
+	})
+
+	RegisterPayloadType(Allocation{}.GetType(), func(d Data) error {
+		return errors.New("allocations can only be recorded in the genesis block")
+	}, canonicalAllocation)
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// checkGenesis checks that a genesis block is well-formed and holds exactly the allocations of the network's Genesis.
+// Every peer creates its own genesis block, so the timestamp may differ
+func checkGenesis(b Block) error {
+
+	err := checkGenesisHeader(b.BlockHeader)
+	if err != nil {
+		return err
+	}
+
+	if b.Hash != GENESIS_HASH {
+		return errors.New("genesis block is malformed")
+	}
+
+	if b.MerkleRoot != MerkleRoot(b.Data) {
+		return errors.New("merkle root does not match the genesis block data")
+	}
+
+	for i, d := range b.Data {
+		if _, ok := d.(Allocation); !ok {
+			return fmt.Errorf("data entry %d of the genesis block is not an allocation", i)
+		}
+	}
+
+	return nil
+}
+
+// checkGenesisHeader checks that a genesis header is well-formed and commits to the allocations of the network's
+// Genesis, which is all a light client can check
+func checkGenesisHeader(h BlockHeader) error {
+
+	if h.Index != 0 || h.PrevHash != "" {
+		return errors.New("genesis block is malformed")
+	}
+
+	if h.MerkleRoot != NetworkGenesis().Block().MerkleRoot {
+		return errors.New("genesis block does not hold the allocations of this network")
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// ============================ Identity ============================
+
+// ADDRESS_LENGTH is the number of bytes of a public key's hash that make up a wallet address
+const ADDRESS_LENGTH = 20
+
+// AddressFromPublicKey returns the wallet address of a public key, which is the hex encoded first ADDRESS_LENGTH
+// bytes of the SHA-256 hash of the compressed key. The address stays the same for as long as the key is kept,
+// whichever machine or port the wallet is used from
+func AddressFromPublicKey(key *ecdsa.PublicKey) string {
+	hash := sha256.Sum256(elliptic.MarshalCompressed(key.Curve, key.X, key.Y))
+	return hex.EncodeToString(hash[:ADDRESS_LENGTH])
+}
+
+// ValidAddress returns true if the passed string has the form of a wallet address
+func ValidAddress(address string) bool {
+	decoded, err := hex.DecodeString(address)
+	return err == nil && len(decoded) == ADDRESS_LENGTH
+}
+
+// EncodePublicKey returns the hex encoded, compressed form of a public key, which is how it is carried in transactions
+func EncodePublicKey(key *ecdsa.PublicKey) string {
+	return hex.EncodeToString(elliptic.MarshalCompressed(key.Curve, key.X, key.Y))
+}
+
+// DecodePublicKey decodes a public key that was encoded with EncodePublicKey
+func DecodePublicKey(encoded string) (*ecdsa.PublicKey, error) {
+
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("public key is not hex encoded")
+	}
+
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), decoded)
+	if x == nil {
+		return nil, errors.New("public key is not a compressed P-256 key")
+	}
+
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// SignTransaction sets the transaction's public key to the passed key's public half and signs the transaction. The
+// transaction's From address must be the address of the key
+func SignTransaction(t Transaction, key *ecdsa.PrivateKey) (Transaction, error) {
+
+	if t.From != AddressFromPublicKey(&key.PublicKey) {
+		return t, errors.New("transaction is not from the address of the signing key")
+	}
+
+	t.PublicKey = EncodePublicKey(&key.PublicKey)
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, transactionSigningHash(t))
+	if err != nil {
+		return t, err
+	}
+
+	t.Signature = hex.EncodeToString(signature)
+
+	return t, nil
+}
+
+// VerifyTransaction checks that a transaction carries the public key of its From address and a valid signature made
+// with that key. Everything needed is in the transaction itself, so any node can check it without knowing the sender
+func VerifyTransaction(t Transaction) error {
+
+	key, err := DecodePublicKey(t.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if AddressFromPublicKey(key) != t.From {
+		return errors.New("public key does not belong to the sender's address")
+	}
+
+	signature, err := hex.DecodeString(t.Signature)
+	if err != nil {
+		return errors.New("signature is not hex encoded")
+	}
+
+	if !ecdsa.VerifyASN1(key, transactionSigningHash(t), signature) {
+		return errors.New("signature does not match the transaction")
+	}
+
+	return nil
+}
+
+// transactionSigningHash returns the hash that a transaction's signature is made over, which is the SHA-256 hash of
+// the transaction's canonical signing bytes and so covers every field except the signature itself
+func transactionSigningHash(t Transaction) []byte {
+	hash := sha256.Sum256(TransactionSigningBytes(t))
+	return hash[:]
+}
+
+// SignBlock signs a block as its producer. The block's PublicKey must already be set to the passed key's public
+// half, and its Hash computed, as the signature is made over the hash
+func SignBlock(b Block, key *ecdsa.PrivateKey) (Block, error) {
+
+	if b.PublicKey != EncodePublicKey(&key.PublicKey) || b.Miner != AddressFromPublicKey(&key.PublicKey) {
+		return b, errors.New("block was not produced by the signing key")
+	}
+
+	hash := sha256.Sum256(BlockSigningBytes(b))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return b, err
+	}
+
+	b.Signature = hex.EncodeToString(signature)
+
+	return b, nil
+}
+
+// VerifyBlockSignature checks that a block carries the public key of its Miner address and a valid signature made
+// with that key over the block's hash
+func VerifyBlockSignature(b Block) error {
+
+	hash := sha256.Sum256(BlockSigningBytes(b))
+	return verifySignature(b.PublicKey, b.Miner, b.Signature, hash[:])
+}
+
+// SignElectionEntry sets the entry's public key to the passed key's public half and signs the entry. The entry's
+// Address must be the address of the key
+func SignElectionEntry(e ElectionEntry, key *ecdsa.PrivateKey) (ElectionEntry, error) {
+
+	if e.Address != AddressFromPublicKey(&key.PublicKey) {
+		return e, errors.New("election entry is not for the address of the signing key")
+	}
+
+	e.PublicKey = EncodePublicKey(&key.PublicKey)
+
+	hash := sha256.Sum256(ElectionEntrySigningBytes(e))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return e, err
+	}
+
+	e.Signature = hex.EncodeToString(signature)
+
+	return e, nil
+}
+
+// VerifyElectionEntry checks that an election entry carries the public key of its Address and a valid signature made
+// with that key
+func VerifyElectionEntry(e ElectionEntry) error {
+
+	hash := sha256.Sum256(ElectionEntrySigningBytes(e))
+	return verifySignature(e.PublicKey, e.Address, e.Signature, hash[:])
+}
+
+// verifySignature checks that the encoded public key belongs to the address and that the hex encoded signature was
+// made over the hash with that key
+func verifySignature(publicKey string, address string, signature string, hash []byte) error {
+
+	key, err := DecodePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if AddressFromPublicKey(key) != address {
+		return errors.New("public key does not belong to the signer's address")
+	}
+
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("signature is not hex encoded")
+	}
+
+	if !ecdsa.VerifyASN1(key, hash, decoded) {
+		return errors.New("signature does not match")
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+package blockchain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ============================ Keystore ============================
+
+const (
+	keystoreVersion = 1
+
+	// scrypt parameters, which make every guess at a passphrase take a noticeable amount of time and memory
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+
+	// Limits on the scrypt parameters read from an account file, so that a tampered file can't make loading it use
+	// more memory or time than the machine has. scrypt needs 128 * N * R bytes of memory
+	minScryptN      = 1 << 10
+	maxScryptN      = 1 << 20
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 256 << 20
+
+	accountFileExtension = ".json"
+)
+
+// Account names become file names, so they are limited to characters that are safe in a path
+var accountNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Keystore saves the private keys of named accounts in a directory, one file per account. Every key is encrypted
+// with AES-GCM under a key derived from the account's passphrase with scrypt, so the files are safe to back up
+type Keystore struct {
+	Directory string
+}
+
+// AccountInfo describes an account in the keystore, which can be listed without knowing its passphrase
+type AccountInfo struct {
+	Name    string
+	Address string
+}
+
+// encryptedKey is the format of an account file
+type encryptedKey struct {
+	Version    int    `json:"version"`
+	Address    string `json:"address"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// CreateAccount generates a new key, saves it under the passed name and returns it
+func (k Keystore) CreateAccount(name string, passphrase string) (*ecdsa.PrivateKey, error) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	err = k.SaveAccount(name, key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// SaveAccount encrypts the key with the passphrase and saves it under the passed name, which must not be taken
+func (k Keystore) SaveAccount(name string, key *ecdsa.PrivateKey, passphrase string) error {
+
+	if passphrase == "" {
+		return errors.New("passphrase must not be empty")
+	}
+
+	if k.HasAccount(name) {
+		return fmt.Errorf("account %q already exists", name)
+	}
+
+	path, err := k.accountPath(name)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 32)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newAccountCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	// The address is authenticated along with the key, so it can't be swapped out in the file
+	address := AddressFromPublicKey(&key.PublicKey)
+	ciphertext := gcm.Seal(nil, nonce, privateKeyBytes(key), []byte(address))
+
+	encoded, err := json.MarshalIndent(encryptedKey{
+		Version:    keystoreVersion,
+		Address:    address,
+		KDF:        "scrypt",
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(ciphertext),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(k.Directory, 0700)
+	if err != nil {
+		return err
+	}
+
+	// Only the owner may read the file, even though the key in it is encrypted
+	return writeFileAtomically(path, encoded, 0600)
+}
+
+// LoadAccount decrypts and returns the key of the named account
+func (k Keystore) LoadAccount(name string, passphrase string) (*ecdsa.PrivateKey, error) {
+
+	stored, err := k.readAccount(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.Version != keystoreVersion || stored.KDF != "scrypt" {
+		return nil, fmt.Errorf("account %q was saved in an unsupported format", name)
+	}
+
+	salt, err := hex.DecodeString(stored.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(stored.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := hex.DecodeString(stored.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkScryptParameters(stored.N, stored.R, stored.P)
+	if err != nil {
+		return nil, fmt.Errorf("account %q is corrupt: %v", name, err)
+	}
+
+	gcm, err := newAccountCipher(passphrase, salt, stored.N, stored.R, stored.P)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("account %q is corrupt", name)
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(stored.Address))
+	if err != nil {
+		return nil, errors.New("wrong passphrase, or the account file is corrupt")
+	}
+
+	key, err := privateKeyFromBytes(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	if AddressFromPublicKey(&key.PublicKey) != stored.Address {
+		return nil, fmt.Errorf("account %q is corrupt", name)
+	}
+
+	return key, nil
+}
+
+// ImportAccount saves a hex encoded private key, as returned by ExportAccount, under the passed name
+func (k Keystore) ImportAccount(name string, encodedKey string, passphrase string) (*ecdsa.PrivateKey, error) {
+
+	decoded, err := hex.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, errors.New("private key is not hex encoded")
+	}
+
+	key, err := privateKeyFromBytes(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	err = k.SaveAccount(name, key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ExportAccount decrypts the named account and returns its private key hex encoded, so it can be imported into
+// another keystore. Anyone who has the exported key can spend the account's funds
+func (k Keystore) ExportAccount(name string, passphrase string) (string, error) {
+
+	key, err := k.LoadAccount(name, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(privateKeyBytes(key)), nil
+}
+
+// HasAccount returns true if an account with the passed name is saved in the keystore
+func (k Keystore) HasAccount(name string) bool {
+
+	path, err := k.accountPath(name)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// ListAccounts returns the name and address of every account in the keystore, sorted by name
+func (k Keystore) ListAccounts() ([]AccountInfo, error) {
+
+	files, err := ioutil.ReadDir(k.Directory)
+	if os.IsNotExist(err) {
+		return []AccountInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	accounts := []AccountInfo{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), accountFileExtension)
+		if file.IsDir() || name == file.Name() || !accountNamePattern.MatchString(name) {
+			continue
+		}
+
+		stored, err := k.readAccount(name)
+		if err != nil {
+			continue
+		}
+
+		accounts = append(accounts, AccountInfo{Name: name, Address: stored.Address})
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+
+	return accounts, nil
+}
+
+// ==================== Non-interface, helper methods ========================
+
+func (k Keystore) accountPath(name string) (string, error) {
+
+	if !accountNamePattern.MatchString(name) {
+		return "", errors.New("account names may only contain letters, digits, '-' and '_'")
+	}
+
+	return filepath.Join(k.Directory, name+accountFileExtension), nil
+}
+
+func (k Keystore) readAccount(name string) (encryptedKey, error) {
+
+	path, err := k.accountPath(name)
+	if err != nil {
+		return encryptedKey{}, err
+	}
+
+	encoded, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return encryptedKey{}, fmt.Errorf("account %q does not exist", name)
+	} else if err != nil {
+		return encryptedKey{}, err
+	}
+
+	var stored encryptedKey
+	err = json.Unmarshal(encoded, &stored)
+	if err != nil {
+		return encryptedKey{}, fmt.Errorf("account %q is corrupt: %v", name, err)
+	}
+
+	return stored, nil
+}
+
+// checkScryptParameters returns an error describing why the scrypt parameters of an account file are out of bounds,
+// or nil if they aren't
+func checkScryptParameters(n int, r int, p int) error {
+
+	if n < minScryptN || n > maxScryptN || n&(n-1) != 0 {
+		return fmt.Errorf("scrypt N must be a power of two from %d to %d", minScryptN, maxScryptN)
+	}
+
+	if r < 1 || r > maxScryptR {
+		return fmt.Errorf("scrypt r must be from 1 to %d", maxScryptR)
+	}
+
+	if p < 1 || p > maxScryptP {
+		return fmt.Errorf("scrypt p must be from 1 to %d", maxScryptP)
+	}
+
+	if 128*n*r > maxScryptMemory {
+		return fmt.Errorf("scrypt parameters need more than %d bytes of memory", maxScryptMemory)
+	}
+
+	return nil
+}
+
+// newAccountCipher derives an AES-256 key from the passphrase with scrypt and returns an AES-GCM cipher using it
+func newAccountCipher(passphrase string, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, n, r, p, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// privateKeyBytes returns the 32 byte private scalar of a P-256 key
+func privateKeyBytes(key *ecdsa.PrivateKey) []byte {
+	return key.D.FillBytes(make([]byte, 32))
+}
+
+// privateKeyFromBytes rebuilds a P-256 key from its 32 byte private scalar
+func privateKeyFromBytes(b []byte) (*ecdsa.PrivateKey, error) {
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(b)
+	if len(b) != 32 || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key is not a valid P-256 key")
+	}
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(b)
+
+	return key, nil
+}
@@ -0,0 +1,164 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystoreSavesAndLoadsAccounts(t *testing.T) {
+
+	k := Keystore{Directory: filepath.Join(t.TempDir(), "keystore")}
+
+	key, err := k.CreateAccount("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := k.LoadAccount("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.D.Cmp(key.D) != 0 {
+		t.Error("loaded key isn't the saved key")
+	}
+
+	// Only the owner may read the account file
+	info, err := os.Stat(filepath.Join(k.Directory, "alice.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("account file has permissions %v", info.Mode().Perm())
+	}
+
+	accounts, err := k.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Name != "alice" || accounts[0].Address != AddressFromPublicKey(&key.PublicKey) {
+		t.Errorf("accounts are listed as %+v", accounts)
+	}
+
+	// An exported key imports into another keystore as the same key
+	exported, err := k.ExportAccount("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := Keystore{Directory: t.TempDir()}
+	imported, err := other.ImportAccount("backup", exported, "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.D.Cmp(key.D) != 0 || !other.HasAccount("backup") {
+		t.Error("imported key isn't the exported key")
+	}
+}
+
+func TestKeystoreRefusesWrongPassphrasesAndNames(t *testing.T) {
+
+	k := Keystore{Directory: t.TempDir()}
+
+	_, err := k.CreateAccount("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		try  func() error
+	}{
+		{"wrong passphrase", func() error { _, err := k.LoadAccount("alice", "correct horsE"); return err }},
+		{"empty passphrase", func() error { _, err := k.LoadAccount("alice", ""); return err }},
+		{"export with the wrong passphrase", func() error { _, err := k.ExportAccount("alice", "wrong"); return err }},
+		{"missing account", func() error { _, err := k.LoadAccount("bob", "correct horse"); return err }},
+		{"saving without a passphrase", func() error { _, err := k.CreateAccount("bob", ""); return err }},
+		{"saving over an account", func() error { _, err := k.CreateAccount("alice", "other"); return err }},
+		{"name outside the keystore", func() error { _, err := k.CreateAccount("../alice", "other"); return err }},
+		{"name with a space", func() error { _, err := k.CreateAccount("alice smith", "other"); return err }},
+		{"empty name", func() error { _, err := k.CreateAccount("", "other"); return err }},
+		{"import of a key that isn't hex", func() error { _, err := k.ImportAccount("bob", "not a key", "other"); return err }},
+		{"import of a key of the wrong length", func() error { _, err := k.ImportAccount("bob", "abcd", "other"); return err }},
+	}
+
+	for _, test := range tests {
+		if test.try() == nil {
+			t.Errorf("%s: succeeded", test.name)
+		}
+	}
+
+	if k.HasAccount("bob") {
+		t.Error("an account was saved by a refused call")
+	}
+}
+
+func TestKeystoreRefusesTamperedAccounts(t *testing.T) {
+
+	other := newWallet(t).address
+
+	tests := []struct {
+		name   string
+		tamper func(e *encryptedKey)
+	}{
+		{"other address", func(e *encryptedKey) { e.Address = other }},
+		{"changed ciphertext", func(e *encryptedKey) { e.Ciphertext = flipFirstByte(e.Ciphertext) }},
+		{"changed salt", func(e *encryptedKey) { e.Salt = flipFirstByte(e.Salt) }},
+		{"short nonce", func(e *encryptedKey) { e.Nonce = e.Nonce[2:] }},
+		{"salt that isn't hex", func(e *encryptedKey) { e.Salt = "salt" }},
+		{"other version", func(e *encryptedKey) { e.Version = keystoreVersion + 1 }},
+		{"other key derivation", func(e *encryptedKey) { e.KDF = "pbkdf2" }},
+		{"scrypt N beyond the memory limit", func(e *encryptedKey) { e.N = 1 << 30 }},
+		{"scrypt N that isn't a power of two", func(e *encryptedKey) { e.N = 3 << 12 }},
+		{"scrypt r of 0", func(e *encryptedKey) { e.R = 0 }},
+		{"scrypt p beyond the limit", func(e *encryptedKey) { e.P = maxScryptP + 1 }},
+	}
+
+	for _, test := range tests {
+		k := Keystore{Directory: t.TempDir()}
+
+		_, err := k.CreateAccount("alice", "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(k.Directory, "alice.json")
+		encoded, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stored encryptedKey
+		err = json.Unmarshal(encoded, &stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.tamper(&stored)
+
+		encoded, err = json.Marshal(stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, encoded, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = k.LoadAccount("alice", "correct horse")
+		if err == nil {
+			t.Errorf("%s: account was loaded", test.name)
+		}
+	}
+}
+
+// flipFirstByte returns the hex encoded bytes with the bits of the first byte flipped
+func flipFirstByte(encoded string) string {
+	b, _ := hex.DecodeString(encoded)
+	b[0] ^= 0xff
+	return hex.EncodeToString(b)
+}
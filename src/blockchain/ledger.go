@@ -0,0 +1,606 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ============================ Ledger ============================
+
+// Ledger is the account state of the network, derived by replaying the blocks of a chain. Balances and stakes are
+// never stored anywhere else, so they always agree with what the chain says.
+type Ledger struct {
+	balances  map[string]int
+	nonces    map[string]int
+	bonded    map[string]int
+	unbonding map[string][]Unbonding
+	election  Election
+	missed    int
+	slashed   map[string]bool
+	allocated int
+	minted    int
+	burned    int
+	height    int
+	mutex     sync.Mutex
+}
+
+// NewLedger creates and returns an empty Ledger
+func NewLedger() *Ledger {
+	return &Ledger{balances: make(map[string]int), nonces: make(map[string]int), bonded: make(map[string]int), unbonding: make(map[string][]Unbonding), slashed: make(map[string]bool), height: -1}
+}
+
+// Replay discards the current account state and rebuilds it from every block of the passed chain
+func (l *Ledger) Replay(chain []Block) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.balances = make(map[string]int)
+	l.nonces = make(map[string]int)
+	l.bonded = make(map[string]int)
+	l.unbonding = make(map[string][]Unbonding)
+	l.election = Election{}
+	l.missed = 0
+	l.slashed = make(map[string]bool)
+	l.allocated = 0
+	l.minted = 0
+	l.burned = 0
+	l.height = -1
+
+	for _, b := range chain {
+		l.applyBlock(b)
+	}
+}
+
+// ApplyBlock incrementally updates the account state with a block that was appended to the chain
+func (l *Ledger) ApplyBlock(b Block) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.applyBlock(b)
+}
+
+// Balance returns the balance of the account with the passed address
+func (l *Ledger) Balance(address string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.balance(address)
+}
+
+// NextNonce returns the nonce that the next transaction sent from the account with the passed address must carry,
+// which is the number of transactions the account has sent on the chain
+func (l *Ledger) NextNonce(address string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.nonces[address]
+}
+
+// CheckNonces checks that the nonces of the block's transactions continue on from the account state without reusing
+// or skipping a nonce, as if the block were appended next. The Ledger isn't changed
+func (l *Ledger) CheckNonces(b Block) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// A sender may have several transactions in one block, which must be in nonce order
+	next := make(map[string]int)
+	for i, d := range b.Data {
+		transaction, ok := d.(Transaction)
+		if !ok {
+			continue
+		}
+
+		expected, seen := next[transaction.From]
+		if !seen {
+			expected = l.nonces[transaction.From]
+		}
+
+		err := checkNonce(transaction, expected)
+		if err != nil {
+			return fmt.Errorf("transaction %d is invalid: %v", i, err)
+		}
+
+		next[transaction.From] = expected + 1
+	}
+
+	return nil
+}
+
+// CheckBalances checks that the block's transactions only transfer and bond what their senders can spend, and only
+// unbond stake that their senders have bonded, as if the block were appended next. The Ledger isn't changed
+func (l *Ledger) CheckBalances(b Block) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Earlier entries of the block change what later ones can bond, so they are applied to a copy of the state
+	state := l.clone()
+	state.release(b.Index)
+
+	for i, d := range b.Data {
+		transaction, ok := d.(Transaction)
+		if ok {
+			err := state.checkBalance(transaction)
+			if err != nil {
+				return fmt.Errorf("transaction %d is invalid: %v", i, err)
+			}
+		}
+
+		state.applyEntry(d, b)
+	}
+
+	return nil
+}
+
+// CheckElection checks the proof of stake election recorded in the block against the validator set, as if the block
+// were appended next. Once there are validators, the election must have an entry for every one of them, and no other
+// entries, so its producer can't leave out a validator whose entry might have won. An absent entry carries no
+// signature, so the entries revealed must also stake more than half of the bonded stake, or a validator could mark
+// every other validator absent and elect itself. Until there are validators, every entry must be revealed. Every
+// entry must stake what the validator set allows, see CheckElectionStake. The Ledger isn't changed
+func (l *Ledger) CheckElection(b Block) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	validators, bonded := 0, 0
+	for _, stake := range l.bonded {
+		if stake > 0 {
+			validators++
+			bonded += stake
+		}
+	}
+
+	for _, d := range b.Data {
+		election, ok := d.(Election)
+		if !ok {
+			continue
+		}
+
+		revealed := 0
+		for i, entry := range election.Entries {
+			if validators == 0 && entry.absent() {
+				return fmt.Errorf("election entry %d is absent, but there are no validators to record", i)
+			}
+
+			err := l.checkElectionStake(entry)
+			if err != nil {
+				return fmt.Errorf("election entry %d is invalid: %v", i, err)
+			}
+
+			if !entry.absent() {
+				revealed += entry.Stake
+			}
+		}
+
+		// Every entry is a different validator, so the entries only cover the validator set if there are as many
+		if validators > 0 && len(election.Entries) != validators {
+			return fmt.Errorf("election has %d entries, but there are %d validators", len(election.Entries), validators)
+		}
+
+		if validators > 0 && 2*revealed <= bonded {
+			return fmt.Errorf("election reveals %d of %d bonded stake, but more than half must be revealed", revealed, bonded)
+		}
+	}
+
+	return nil
+}
+
+// CheckElectionStake checks that an election entry stakes exactly the bonded stake of its address. While there are
+// no validators, any address may instead stake up to its balance
+func (l *Ledger) CheckElectionStake(entry ElectionEntry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.checkElectionStake(entry)
+}
+
+// CheckSlashing checks every piece of slashing evidence recorded in the block against the account state, as if the
+// block were appended next, see CheckEvidence. A block produced by a later round of its election must record the
+// missed slot of every earlier round. The Ledger isn't changed
+func (l *Ledger) CheckSlashing(b Block) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Earlier entries of the block can slash the same offence, or record the election a missed slot is checked against
+	state := l.clone()
+	state.release(b.Index)
+
+	for i, d := range b.Data {
+		evidence, ok := d.(SlashingEvidence)
+		if ok {
+			err := state.checkEvidence(evidence, b.Index)
+			if err != nil {
+				return fmt.Errorf("slashing evidence %d is invalid: %v", i, err)
+			}
+		}
+
+		state.applyEntry(d, b)
+	}
+
+	if state.election.Height == b.Index && state.missed != state.election.Round {
+		return fmt.Errorf("block was produced in round %d of its election, but records %d missed slots", state.election.Round, state.missed)
+	}
+
+	return nil
+}
+
+// CheckEvidence checks that slashing evidence can be recorded in the next block: its offence must not have been
+// slashed already, must be no more than UNBONDING_PERIOD blocks old and its offender must have stake to slash. A
+// missed slot can only be recorded by the block that a later round of its election produced, so it is never accepted
+// for the next block. Whether the evidence proves its offence is checked by SlashingEvidence.Verify
+func (l *Ledger) CheckEvidence(e SlashingEvidence) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.checkEvidence(e, l.height+1)
+}
+
+// Stake returns the bonded stake of the account with the passed address
+func (l *Ledger) Stake(address string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.bonded[address]
+}
+
+// Validator returns the bonded and unbonding stake of the account with the passed address
+func (l *Ledger) Validator(address string) Validator {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.validator(address)
+}
+
+// Validators returns the validator set, which is every account with bonded stake, in order of address
+func (l *Ledger) Validators() []Validator {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	validators := []Validator{}
+	for address, stake := range l.bonded {
+		if stake > 0 {
+			validators = append(validators, l.validator(address))
+		}
+	}
+
+	sort.Slice(validators, func(i, j int) bool { return validators[i].Address < validators[j].Address })
+
+	return validators
+}
+
+// Balances returns the balance of every account that appears on the chain
+func (l *Ledger) Balances() map[string]int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	balances := make(map[string]int)
+	for address := range l.balances {
+		balances[address] = l.balance(address)
+	}
+
+	return balances
+}
+
+// Supply returns the supply of currency according to the blocks that were applied to the Ledger
+func (l *Ledger) Supply() Supply {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return Supply{Height: l.height, Accounts: len(l.balances), Allocated: l.allocated, Minted: l.minted, Burned: l.burned, Circulating: l.allocated + l.minted - l.burned}
+}
+
+// Height returns the index of the last block that was applied to the Ledger
+func (l *Ledger) Height() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.height
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// balance returns the balance of an account, which is the sum of every change recorded on chain, starting with its
+// genesis allocation
+func (l *Ledger) balance(address string) int {
+	return l.balances[address]
+}
+
+// applyBlock releases the unbonded stake whose lock-up ends at the block, then applies each of the block's entries.
+// The block's election is only kept until the next block, as missed slots are only recorded by the block of the
+// election they were missed in
+func (l *Ledger) applyBlock(b Block) {
+
+	l.height = b.Index
+
+	// The genesis block only holds allocations, and has no coinbase or stake to release
+	if b.Index == 0 {
+		for _, d := range b.Data {
+			l.applyEntry(d, b)
+		}
+		return
+	}
+
+	l.release(b.Index)
+
+	l.election = Election{}
+	l.missed = 0
+
+	for _, d := range b.Data {
+		l.applyEntry(d, b)
+	}
+}
+
+// applyEntry moves the amount and fee of a transaction out of the sender's account and credits the recipient, or
+// bonds or unbonds the sender's stake, and advances the sender's nonce. An allocation or coinbase credits its recipient
+// with what it pays, an election is remembered along with the missed slots recorded after it, and slashing evidence
+// slashes its offender, see slash
+func (l *Ledger) applyEntry(d Data, b Block) {
+
+	switch entry := d.(type) {
+	case Transaction:
+		l.balances[entry.From] -= entry.cost()
+		l.nonces[entry.From]++
+
+		switch entry.Kind {
+		case TRANSACTION_STAKE:
+			l.bonded[entry.From] += entry.Amount
+		case TRANSACTION_UNSTAKE:
+			l.bonded[entry.From] -= entry.Amount
+			l.unbonding[entry.From] = append(l.unbonding[entry.From], Unbonding{Amount: entry.Amount, ReleaseHeight: b.Index + UNBONDING_PERIOD})
+		default:
+			l.balances[entry.To] += entry.Amount
+		}
+	case Allocation:
+		l.balances[entry.To] += entry.Amount
+		l.allocated += entry.Amount
+	case Coinbase:
+		l.balances[entry.To] += entry.Amount
+
+		// Fees were already in circulation, only the block reward is new currency
+		l.minted += entry.Amount - BlockFees(b.Data)
+	case Election:
+		l.election = entry
+		l.missed = 0
+	case SlashingEvidence:
+		l.slash(entry, b.Miner)
+		if entry.Offence == OFFENCE_MISSED_SLOT {
+			l.missed++
+		}
+	}
+}
+
+// slash takes the penalty of the evidence's offence out of the offender's bonded stake, and then out of its unbonding
+// stake, latest first. SLASH_REPORTER_PERCENT of the penalty is paid to the producer that recorded the evidence and
+// the rest is burned
+func (l *Ledger) slash(e SlashingEvidence, producer string) {
+
+	offender := e.Offender()
+	l.slashed[e.key()] = true
+
+	stake := l.slashable(offender)
+	penalty := stake * slashPercent(e.Offence) / 100
+	if penalty < 1 {
+		penalty = 1
+	}
+	if penalty > stake {
+		penalty = stake
+	}
+
+	taken := penalty
+	if taken > l.bonded[offender] {
+		taken = l.bonded[offender]
+	}
+	l.bonded[offender] -= taken
+
+	entries := l.unbonding[offender]
+	for i := len(entries) - 1; i >= 0 && taken < penalty; i-- {
+		amount := penalty - taken
+		if amount > entries[i].Amount {
+			amount = entries[i].Amount
+		}
+		entries[i].Amount -= amount
+		taken += amount
+	}
+
+	locked := []Unbonding{}
+	for _, u := range entries {
+		if u.Amount > 0 {
+			locked = append(locked, u)
+		}
+	}
+	if len(locked) == 0 {
+		delete(l.unbonding, offender)
+	} else {
+		l.unbonding[offender] = locked
+	}
+
+	reward := penalty * SLASH_REPORTER_PERCENT / 100
+	l.balances[producer] += reward
+	l.burned += penalty - reward
+}
+
+// release returns the unbonded stake whose lock-up ends at the passed height to the spendable balances
+func (l *Ledger) release(height int) {
+
+	for address, entries := range l.unbonding {
+		locked := []Unbonding{}
+		for _, u := range entries {
+			if u.ReleaseHeight <= height {
+				l.balances[address] += u.Amount
+			} else {
+				locked = append(locked, u)
+			}
+		}
+
+		if len(locked) == 0 {
+			delete(l.unbonding, address)
+		} else {
+			l.unbonding[address] = locked
+		}
+	}
+}
+
+// checkBalance returns an error describing why a transaction can't transfer, bond or unbond its amount, or nil if it can
+func (l *Ledger) checkBalance(t Transaction) error {
+
+	switch t.Kind {
+	case "":
+		if t.cost() > l.balance(t.From) {
+			return fmt.Errorf("%s can't transfer %d plus a fee of %d, its balance is %d", t.From, t.Amount, t.Fee, l.balance(t.From))
+		}
+	case TRANSACTION_STAKE:
+		if t.cost() > l.balance(t.From) {
+			return fmt.Errorf("%s can't bond %d plus a fee of %d, its balance is %d", t.From, t.Amount, t.Fee, l.balance(t.From))
+		}
+	case TRANSACTION_UNSTAKE:
+		if t.Amount > l.bonded[t.From] {
+			return fmt.Errorf("%s can't unbond %d, it has %d bonded", t.From, t.Amount, l.bonded[t.From])
+		}
+		if t.cost() > l.balance(t.From) {
+			return fmt.Errorf("%s can't pay a fee of %d, its balance is %d", t.From, t.Fee, l.balance(t.From))
+		}
+	}
+
+	return nil
+}
+
+// checkElectionStake checks an election entry's stake against the validator set. The mutex must be held
+func (l *Ledger) checkElectionStake(entry ElectionEntry) error {
+
+	if !l.hasValidators() {
+		balance := l.balance(entry.Address)
+		if entry.Stake > balance {
+			return fmt.Errorf("stakes %d, but %s only holds %d", entry.Stake, entry.Address, balance)
+		}
+		return nil
+	}
+
+	bonded := l.bonded[entry.Address]
+	if bonded <= 0 {
+		return fmt.Errorf("%s is not a validator", entry.Address)
+	}
+
+	if entry.Stake != bonded {
+		return fmt.Errorf("stakes %d, but %s has %d bonded", entry.Stake, entry.Address, bonded)
+	}
+
+	return nil
+}
+
+// checkEvidence checks slashing evidence against the account state, as if it were recorded in the block at the passed
+// height. The mutex must be held
+func (l *Ledger) checkEvidence(e SlashingEvidence, height int) error {
+
+	offender := e.Offender()
+	if offender == "" {
+		return errors.New("evidence has no offender")
+	}
+
+	if l.slashed[e.key()] {
+		return fmt.Errorf("%s has already been slashed for this offence", offender)
+	}
+
+	if e.Height() > height {
+		return fmt.Errorf("offence at height %d hasn't happened yet", e.Height())
+	}
+
+	if height-e.Height() > UNBONDING_PERIOD {
+		return fmt.Errorf("offence at height %d is too old to be slashed", e.Height())
+	}
+
+	if l.slashable(offender) < 1 {
+		return fmt.Errorf("%s has no stake to slash", offender)
+	}
+
+	if e.Offence != OFFENCE_MISSED_SLOT {
+		return nil
+	}
+
+	// A missed slot is recorded by the block that a later round of the same election produced, so it is checked
+	// against the election recorded earlier in the same block
+	if e.Election.Height != height || l.election.Height != height || l.election.PrevHash != e.Election.PrevHash {
+		return fmt.Errorf("missed slot at height %d can only be recorded by the block its election produced", e.Election.Height)
+	}
+
+	if !sameElection(l.election, *e.Election) {
+		return fmt.Errorf("evidence is not the election that produced the block at height %d", height)
+	}
+
+	// Every earlier round is recorded in order, so each missed slot is the round before the next one, and the last is
+	// the round before the one that produced the block
+	if e.Election.Round != l.missed || e.Election.Round >= l.election.Round {
+		return fmt.Errorf("the block at height %d was produced in round %d after %d missed slots, so round %d isn't the next missed slot", height, l.election.Round, l.missed, e.Election.Round)
+	}
+
+	return nil
+}
+
+// slashable returns the stake of an account that can be slashed, which is its bonded stake along with the stake it is
+// unbonding. The mutex must be held
+func (l *Ledger) slashable(address string) int {
+
+	stake := l.bonded[address]
+	for _, u := range l.unbonding[address] {
+		stake += u.Amount
+	}
+
+	return stake
+}
+
+// hasValidators returns true if any account has bonded stake. The mutex must be held
+func (l *Ledger) hasValidators() bool {
+	for _, stake := range l.bonded {
+		if stake > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validator returns the stake of an account. The mutex must be held
+func (l *Ledger) validator(address string) Validator {
+	return Validator{Address: address, Stake: l.bonded[address], Unbonding: append([]Unbonding{}, l.unbonding[address]...)}
+}
+
+// clone returns a copy of the Ledger's account state that can be changed without changing the Ledger. The mutex
+// must be held
+func (l *Ledger) clone() *Ledger {
+
+	c := NewLedger()
+	for address, balance := range l.balances {
+		c.balances[address] = balance
+	}
+	for address, nonce := range l.nonces {
+		c.nonces[address] = nonce
+	}
+	for address, stake := range l.bonded {
+		c.bonded[address] = stake
+	}
+	for address, entries := range l.unbonding {
+		c.unbonding[address] = append([]Unbonding{}, entries...)
+	}
+	c.election = l.election
+	c.missed = l.missed
+	for key := range l.slashed {
+		c.slashed[key] = true
+	}
+	c.allocated = l.allocated
+	c.minted = l.minted
+	c.burned = l.burned
+	c.height = l.height
+
+	return c
+}
+
+// checkNonce returns an error describing why the transaction's nonce isn't the expected next nonce of its sender, or
+// nil if it is. A lower nonce means the transaction, or another one with the same nonce, was already accepted
+func checkNonce(t Transaction, expected int) error {
+	if t.Nonce < expected {
+		return fmt.Errorf("nonce %d of %s has already been used, the next nonce is %d", t.Nonce, t.From, expected)
+	}
+	if t.Nonce > expected {
+		return fmt.Errorf("nonce %d of %s skips ahead, the next nonce is %d", t.Nonce, t.From, expected)
+	}
+	return nil
+}
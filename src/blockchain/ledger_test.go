@@ -0,0 +1,188 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+)
+
+var (
+	alice = strings.Repeat("a", 40)
+	bob   = strings.Repeat("b", 40)
+	carol = strings.Repeat("c", 40)
+)
+
+// stakingLedger returns a Ledger in which alice holds 100, bob holds 30 and has 50 bonded, and carol holds 10 and
+// has 20 bonded
+func stakingLedger() *Ledger {
+
+	l := NewLedger()
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 0}, Data: []Data{Allocation{To: alice, Amount: 100}, Allocation{To: bob, Amount: 80}, Allocation{To: carol, Amount: 30}}})
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 1}, Data: []Data{
+		Transaction{Kind: TRANSACTION_STAKE, From: bob, Amount: 50, Nonce: 0},
+		Transaction{Kind: TRANSACTION_STAKE, From: carol, Amount: 20, Nonce: 0}}})
+
+	return l
+}
+
+func TestLedgerCheckBalances(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		data  []Data
+		valid bool
+	}{
+		{"transfer of the whole balance", []Data{Transaction{From: alice, To: bob, Amount: 99, Fee: 1}}, true},
+		{"transfer beyond the balance", []Data{Transaction{From: alice, To: bob, Amount: 101}}, false},
+		{"fee beyond the balance", []Data{Transaction{From: alice, To: bob, Amount: 100, Fee: 1}}, false},
+		{"transfers that together overspend", []Data{
+			Transaction{From: alice, To: bob, Amount: 60},
+			Transaction{From: alice, To: carol, Amount: 60, Nonce: 1}}, false},
+		{"spending what an earlier transfer received", []Data{
+			Transaction{From: alice, To: carol, Amount: 50},
+			Transaction{From: carol, To: bob, Amount: 60, Nonce: 1}}, true},
+		{"bond within the balance", []Data{Transaction{Kind: TRANSACTION_STAKE, From: alice, Amount: 90, Fee: 10}}, true},
+		{"bond beyond the balance", []Data{Transaction{Kind: TRANSACTION_STAKE, From: bob, Amount: 31}}, false},
+		{"bonded stake isn't spendable", []Data{Transaction{From: bob, To: alice, Amount: 40}}, false},
+		{"transfer after bonding", []Data{
+			Transaction{Kind: TRANSACTION_STAKE, From: alice, Amount: 60},
+			Transaction{From: alice, To: bob, Amount: 50, Nonce: 1}}, false},
+		{"unbond within the stake", []Data{Transaction{Kind: TRANSACTION_UNSTAKE, From: bob, Amount: 50, Fee: 30}}, true},
+		{"unbond beyond the stake", []Data{Transaction{Kind: TRANSACTION_UNSTAKE, From: bob, Amount: 51}}, false},
+		{"unbond without stake", []Data{Transaction{Kind: TRANSACTION_UNSTAKE, From: alice, Amount: 1}}, false},
+		{"unbond fee beyond the balance", []Data{Transaction{Kind: TRANSACTION_UNSTAKE, From: carol, Amount: 10, Fee: 11}}, false},
+		{"unbonded stake isn't spendable yet", []Data{
+			Transaction{Kind: TRANSACTION_UNSTAKE, From: carol, Amount: 20},
+			Transaction{From: carol, To: alice, Amount: 11, Nonce: 1}}, false},
+		{"unbond twice", []Data{
+			Transaction{Kind: TRANSACTION_UNSTAKE, From: carol, Amount: 15},
+			Transaction{Kind: TRANSACTION_UNSTAKE, From: carol, Amount: 15, Nonce: 1}}, false},
+		{"other entries", []Data{Note{Text: "hello"}}, true},
+	}
+
+	for _, test := range tests {
+		l := stakingLedger()
+		err := l.CheckBalances(Block{BlockHeader: BlockHeader{Index: 2}, Data: test.data})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+
+		// Checking a block never changes the Ledger
+		if l.Balance(alice) != 100 || l.Balance(bob) != 30 || l.Stake(bob) != 50 || l.Stake(carol) != 20 {
+			t.Errorf("%s: checking the block changed the ledger", test.name)
+		}
+	}
+}
+
+func TestLedgerCheckNonces(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		data  []Data
+		valid bool
+	}{
+		{"next nonce", []Data{Transaction{From: bob, To: alice, Amount: 1, Nonce: 1}}, true},
+		{"first nonce of a new sender", []Data{Transaction{From: alice, To: bob, Amount: 1, Nonce: 0}}, true},
+		{"nonce already used", []Data{Transaction{From: bob, To: alice, Amount: 1, Nonce: 0}}, false},
+		{"nonce that skips ahead", []Data{Transaction{From: bob, To: alice, Amount: 1, Nonce: 2}}, false},
+		{"consecutive nonces", []Data{
+			Transaction{From: bob, To: alice, Amount: 1, Nonce: 1},
+			Transaction{From: bob, To: alice, Amount: 1, Nonce: 2}}, true},
+		{"same nonce twice", []Data{
+			Transaction{From: bob, To: alice, Amount: 1, Nonce: 1},
+			Transaction{From: bob, To: alice, Amount: 2, Nonce: 1}}, false},
+		{"nonces out of order", []Data{
+			Transaction{From: bob, To: alice, Amount: 1, Nonce: 2},
+			Transaction{From: bob, To: alice, Amount: 1, Nonce: 1}}, false},
+		{"senders counted separately", []Data{
+			Transaction{From: bob, To: alice, Amount: 1, Nonce: 1},
+			Transaction{From: carol, To: alice, Amount: 1, Nonce: 1}}, true},
+	}
+
+	for _, test := range tests {
+		err := stakingLedger().CheckNonces(Block{BlockHeader: BlockHeader{Index: 2}, Data: test.data})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestLedgerReleasesUnbondedStake(t *testing.T) {
+
+	l := stakingLedger()
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 2}, Data: []Data{Transaction{Kind: TRANSACTION_UNSTAKE, From: carol, Amount: 20, Nonce: 1}}})
+
+	spend := []Data{Transaction{From: carol, To: alice, Amount: 30, Nonce: 2}}
+
+	err := l.CheckBalances(Block{BlockHeader: BlockHeader{Index: 1 + UNBONDING_PERIOD}, Data: spend})
+	if err == nil {
+		t.Error("unbonded stake was spendable before the end of its unbonding period")
+	}
+
+	err = l.CheckBalances(Block{BlockHeader: BlockHeader{Index: 2 + UNBONDING_PERIOD}, Data: spend})
+	if err != nil {
+		t.Errorf("unbonded stake wasn't spendable after its unbonding period: %v", err)
+	}
+}
+
+// revealed returns an election entry that was revealed, which is all that the Ledger checks
+func revealed(address string, stake int) ElectionEntry {
+	return ElectionEntry{Height: 2, Address: address, Stake: stake, Commitment: "commitment", Secret: "secret"}
+}
+
+func TestLedgerCheckElection(t *testing.T) {
+
+	absent := ElectionEntry{Height: 2, Address: carol, Stake: 20}
+
+	tests := []struct {
+		name    string
+		entries []ElectionEntry
+		valid   bool
+	}{
+		{"every validator", []ElectionEntry{revealed(bob, 50), revealed(carol, 20)}, true},
+		{"absent validator", []ElectionEntry{revealed(bob, 50), absent}, true},
+		{"absent majority of the stake", []ElectionEntry{{Height: 2, Address: bob, Stake: 50}, revealed(carol, 20)}, false},
+		{"missing validator", []ElectionEntry{revealed(bob, 50)}, false},
+		{"no entries", []ElectionEntry{}, false},
+		{"stake below the bonded stake", []ElectionEntry{revealed(bob, 40), revealed(carol, 20)}, false},
+		{"stake above the bonded stake", []ElectionEntry{revealed(bob, 50), revealed(carol, 21)}, false},
+		{"absent entry with the wrong stake", []ElectionEntry{revealed(bob, 50), {Height: 2, Address: carol, Stake: 10}}, false},
+		{"entry that isn't a validator", []ElectionEntry{revealed(alice, 50), revealed(bob, 50), revealed(carol, 20)}, false},
+		{"entry instead of a validator", []ElectionEntry{revealed(alice, 20), revealed(bob, 50)}, false},
+	}
+
+	for _, test := range tests {
+		l := stakingLedger()
+		b := Block{BlockHeader: BlockHeader{Index: 2}, Data: []Data{Coinbase{Height: 2, To: bob}, Election{Height: 2, Entries: test.entries}}}
+
+		err := l.CheckElection(b)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestLedgerCheckElectionWithoutValidators(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		entries []ElectionEntry
+		valid   bool
+	}{
+		{"stake within the balance", []ElectionEntry{revealed(alice, 100), revealed(bob, 1)}, true},
+		{"stake beyond the balance", []ElectionEntry{revealed(alice, 101)}, false},
+		{"stake without a balance", []ElectionEntry{revealed(carol, 1)}, false},
+		{"absent entry", []ElectionEntry{revealed(alice, 50), {Height: 1, Address: bob, Stake: 1}}, false},
+	}
+
+	for _, test := range tests {
+		l := NewLedger()
+		l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 0}, Data: []Data{Allocation{To: alice, Amount: 100}, Allocation{To: bob, Amount: 80}}})
+
+		b := Block{BlockHeader: BlockHeader{Index: 1}, Data: []Data{Coinbase{Height: 1, To: alice}, Election{Height: 1, Entries: test.entries}}}
+
+		err := l.CheckElection(b)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ============================ Light Client ============================
+
+// proofRequest identifies an inclusion proof that a Peer asked for, by the leaf hash of the entry and the hash of the
+// block it should be included in. Only proofs that answer an outstanding request are checked, so a proof can't
+// claim the inclusion of an entry that nobody asked about, or in a block that has since been replaced
+type proofRequest struct {
+	leaf      string
+	blockHash string
+}
+
+// RequestInclusionProof checks that the entry with the passed leaf hash is included in the block at the passed
+// index. A full Peer builds and checks the proof from its own copy of the chain, while a light client asks the
+// full peers on the network for the proof and checks it against its stored header once it arrives
+func (p *Peer) RequestInclusionProof(blockIndex int, leaf string) error {
+
+	if !p.lightClient {
+		chain := p.GetChain()
+		if blockIndex < 0 || blockIndex >= len(chain) {
+			return errors.New("no block with that index on the chain")
+		}
+
+		proof, err := p.merkleProofFor(chain[blockIndex], leaf)
+		if err != nil {
+			return err
+		}
+
+		p.addProofRequest(proofRequest{leaf: leaf, blockHash: chain[blockIndex].Hash})
+		p.checkMerkleProof(proof)
+		return nil
+	}
+
+	headers := p.getHeaders()
+	if blockIndex < 0 || blockIndex >= len(headers) {
+		return errors.New("no header with that index has been synced yet")
+	}
+
+	p.addProofRequest(proofRequest{leaf: leaf, blockHash: p.headerHash(headers[blockIndex])})
+
+	toSend, err := p.communicationComponent.GenerateMessage("GET_MERKLE_PROOF", MerkleProofRequest{BlockIndex: blockIndex, Leaf: leaf})
+	if err != nil {
+		return err
+	}
+
+	log.Println("Requesting inclusion proof from full peers...")
+
+	return p.communicationComponent.BroadcastMsgToNetwork(toSend)
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// headersOf returns the headers of every block of the passed chain
+func headersOf(chain []Block) []BlockHeader {
+	headers := []BlockHeader{}
+	for _, b := range chain {
+		headers = append(headers, b.BlockHeader)
+	}
+	return headers
+}
+
+// headerBlocks returns a block without data for every passed header, whose hash is left for the consensus component to
+// recompute
+func headerBlocks(headers []BlockHeader) []Block {
+	blocks := []Block{}
+	for _, h := range headers {
+		blocks = append(blocks, Block{BlockHeader: h})
+	}
+	return blocks
+}
+
+// getHeaders returns a copy of the headers stored by this light client
+func (p *Peer) getHeaders() []BlockHeader {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	return append([]BlockHeader{}, p.headers...)
+}
+
+// handleHeaders adopts a received chain of headers if the consensus component prefers it over the stored one and it
+// is valid
+func (p *Peer) handleHeaders(headers []BlockHeader, from PeerAddress) {
+
+	if !p.consensusComponent.PreferChain(headerBlocks(p.getHeaders()), headerBlocks(headers)) {
+		return
+	}
+
+	err := ValidateHeaders(headers, p.consensusComponent)
+	if err != nil {
+		log.Printf("Rejected preferred chain of headers from %s: %v\n", from.String(), err)
+		return
+	}
+
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	// Another chain of headers may have been adopted while these were being validated
+	if !p.consensusComponent.PreferChain(headerBlocks(p.headers), headerBlocks(headers)) {
+		return
+	}
+
+	p.headers = headers
+	log.Printf("Recieved a preferred chain of headers, now at height %d\n", len(p.headers)-1)
+}
+
+// sendHeaders sends the headers of this Peer's chain to the light client that asked for them
+func (p *Peer) sendHeaders(to PeerAddress) {
+
+	toSend, err := p.communicationComponent.GenerateMessage("PEER_HEADERS", HeaderChain{Headers: headersOf(p.GetChain())})
+	if err != nil {
+		log.Printf("Error generating message: %v\n", err)
+		return
+	}
+
+	err = p.communicationComponent.SendMsgToPeer(toSend, to)
+	if err != nil {
+		log.Printf("Error sending headers to Peer: %v\n", err)
+	}
+}
+
+// sendMerkleProof serves an inclusion proof from this Peer's chain to the light client that asked for it
+func (p *Peer) sendMerkleProof(request MerkleProofRequest, to PeerAddress) {
+
+	chain := p.GetChain()
+	if request.BlockIndex < 0 || request.BlockIndex >= len(chain) {
+		log.Printf("Can't serve inclusion proof for unknown block %d\n", request.BlockIndex)
+		return
+	}
+
+	proof, err := p.merkleProofFor(chain[request.BlockIndex], request.Leaf)
+	if err != nil {
+		log.Printf("Can't serve inclusion proof: %v\n", err)
+		return
+	}
+
+	toSend, err := p.communicationComponent.GenerateMessage("MERKLE_PROOF", proof)
+	if err != nil {
+		log.Printf("Error generating message: %v\n", err)
+		return
+	}
+
+	err = p.communicationComponent.SendMsgToPeer(toSend, to)
+	if err != nil {
+		log.Printf("Error sending inclusion proof to Peer: %v\n", err)
+	}
+}
+
+// merkleProofFor finds the entry with the passed leaf hash in the block and produces its inclusion proof
+func (p *Peer) merkleProofFor(b Block, leaf string) (MerkleProof, error) {
+
+	for position, d := range b.Data {
+		if LeafHash(d) == leaf {
+			return NewMerkleProof(b, position)
+		}
+	}
+
+	return MerkleProof{}, fmt.Errorf("block %d does not contain %s", b.Index, leaf)
+}
+
+// checkMerkleProof checks a received inclusion proof against the Merkle root of the matching stored header. The proof
+// must answer an outstanding request for its leaf in that block, which is settled once the proof is verified, so
+// proofs that weren't asked for and further answers to the same request are ignored
+func (p *Peer) checkMerkleProof(proof MerkleProof) {
+
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	headers := p.headers
+	if !p.lightClient {
+		headers = headersOf(p.chain)
+	}
+
+	if proof.BlockIndex < 0 || proof.BlockIndex >= len(headers) {
+		log.Printf("Received inclusion proof for unknown block %d\n", proof.BlockIndex)
+		return
+	}
+	header := headers[proof.BlockIndex]
+
+	request := proofRequest{leaf: proof.Leaf, blockHash: p.headerHash(header)}
+	if !p.proofRequests[request] {
+		log.Printf("Ignoring inclusion proof for %s in block %d, which wasn't requested\n", proof.Leaf, proof.BlockIndex)
+		return
+	}
+
+	if !proof.Verify(header.MerkleRoot) {
+		log.Printf("Received an invalid inclusion proof for %s in block %d\n", proof.Leaf, proof.BlockIndex)
+		return
+	}
+
+	delete(p.proofRequests, request)
+	log.Printf("Verified that %s is included in block %d\n", proof.Leaf, proof.BlockIndex)
+}
+
+// addProofRequest records an inclusion proof that this Peer is waiting for
+func (p *Peer) addProofRequest(request proofRequest) {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	p.proofRequests[request] = true
+}
+
+// headerHash returns the hash of a stored header, which light clients don't store but recompute
+func (p *Peer) headerHash(h BlockHeader) string {
+	return p.consensusComponent.CalculateHash(Block{BlockHeader: h})
+}
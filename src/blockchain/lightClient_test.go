@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientVerifiesInclusionOfMinedEntry(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("a mining session takes more than 10 seconds")
+	}
+
+	middleware, peers, clients := startMemoryNetwork(t, 2, 1)
+	full, light := peers[:2], peers[2]
+
+	note := Note{Text: "proven to a light client"}
+	mineEntry(t, middleware, full, note)
+
+	index, _ := findEntry(full[0].GetChain(), note)
+
+	waitFor(t, 30*time.Second, "the light client to sync the mined header", func() bool {
+		return len(light.getHeaders()) > index
+	})
+
+	// The Client reaches the chain through the Peer it was initialized with, which must be the running Peer
+	for i, client := range clients {
+		if client.peer != peers[i] {
+			t.Fatalf("client %d doesn't hold the running peer", i)
+		}
+
+		err := client.peer.RequestInclusionProof(index, LeafHash(note))
+		if err != nil {
+			t.Fatalf("client %d couldn't request the inclusion proof: %v", i, err)
+		}
+
+		waitFor(t, 10*time.Second, "the inclusion proof to be verified", func() bool {
+			return outstandingProofs(client.peer) == 0
+		})
+	}
+}
+
+// outstandingProofs returns the number of inclusion proofs that the Peer is waiting for
+func outstandingProofs(p *Peer) int {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	return len(p.proofRequests)
+}
@@ -0,0 +1,300 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ============================ In-memory Communication ============================
+
+const (
+	// Ports that are dynamically assigned to nodes on a MemoryNetwork start from here
+	firstMemoryPort = 10000
+
+	// The number of messages that can wait to be received by a node before further messages to it are dropped
+	memoryInboxSize = 1024
+)
+
+// MemoryNetwork is a simulated network bus shared by the MemoryCommunicators of many Peers and a Middleware running
+// in one process, such as a test binary. No sockets or service discovery are needed, messages are encoded and decoded
+// just as they would be on a real network, and each node receives its messages in the order they were sent
+type MemoryNetwork struct {
+	nodes    map[int]*MemoryCommunicator
+	nextPort int
+	mutex    sync.Mutex
+}
+
+// NewMemoryNetwork creates and returns a new, empty MemoryNetwork
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{nodes: make(map[int]*MemoryCommunicator), nextPort: firstMemoryPort}
+}
+
+// join adds a node to the network on the passed port, or on the next free port if the passed port is 0, sets its
+// address and returns the addresses of every other node, which is what the node would discover on a real network
+func (n *MemoryNetwork) join(c *MemoryCommunicator, port int) ([]PeerAddress, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if port == 0 {
+		for n.nodes[n.nextPort] != nil {
+			n.nextPort++
+		}
+		port = n.nextPort
+		n.nextPort++
+	} else if n.nodes[port] != nil {
+		return nil, fmt.Errorf("port %d is already in use", port)
+	}
+
+	others := []PeerAddress{}
+	for _, node := range n.nodes {
+		others = append(others, PeerAddress{Address: node.self.Address, LastMessageTime: time.Now()})
+	}
+
+	c.self = PeerAddress{Address: net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}}
+	n.nodes[port] = c
+
+	return others, nil
+}
+
+// leave removes the node on the passed port from the network
+func (n *MemoryNetwork) leave(port int) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	delete(n.nodes, port)
+}
+
+// memoryDelivery is an encoded message waiting in a node's inbox, along with the address of the node that sent it
+type memoryDelivery struct {
+	encodedMessage []byte
+	from           net.UDPAddr
+}
+
+// deliver puts an encoded message from the node at one address into the inbox of the node at the other. Like an
+// unreliable network, the message is dropped if that node's inbox is full, but the sender is told about it
+func (n *MemoryNetwork) deliver(encodedMessage []byte, from net.UDPAddr, to net.UDPAddr) error {
+	n.mutex.Lock()
+	node := n.nodes[to.Port]
+	n.mutex.Unlock()
+
+	if node == nil {
+		return fmt.Errorf("no node is listening on port %d", to.Port)
+	}
+
+	select {
+	case node.inbox <- memoryDelivery{encodedMessage: encodedMessage, from: from}:
+		return nil
+	default:
+		return fmt.Errorf("inbox of the node on port %d is full", to.Port)
+	}
+}
+
+// MemoryCommunicator implements CommunicationComponent over a MemoryNetwork, which must be set before the
+// communicator is initialized. As with the Communicator, the Middleware is the node on MIDDLEWARE_PORT
+type MemoryCommunicator struct {
+	Network       *MemoryNetwork
+	inbox         chan memoryDelivery
+	peerAddresses []PeerAddress
+	peerMessage   chan Message
+	middleware    PeerAddress
+	self          PeerAddress
+	mutex         sync.Mutex
+}
+
+// GetMessageChannel is the interface retriever method that returns the channel that a message from a peer is put into upon read
+func (c *MemoryCommunicator) GetMessageChannel() chan Message {
+	return c.peerMessage
+}
+
+// GetPeerNodes is the interface retriever method that returns this node's list of peers
+func (c *MemoryCommunicator) GetPeerNodes() []PeerAddress {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]PeerAddress{}, c.peerAddresses...)
+}
+
+// GetMiddlewarePeer is the interface retriever method that returns the Middleware Peer's address
+func (c *MemoryCommunicator) GetMiddlewarePeer() PeerAddress {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.middleware
+}
+
+// GetSelfAddress is the interface retriever method that returns this Peer's adress
+func (c *MemoryCommunicator) GetSelfAddress() PeerAddress {
+	return c.self
+}
+
+// RecieveFromNetwork is the interface method that reads the next message from this node's inbox and puts it into
+// the message channel. Messages that can't be decoded are logged and dropped
+func (c *MemoryCommunicator) RecieveFromNetwork(withTimeout bool) error {
+
+	var delivery memoryDelivery
+	if withTimeout {
+		select {
+		case delivery = <-c.inbox:
+		case <-time.After(1 * time.Millisecond):
+			// There was nothing to be read
+			return nil
+		}
+	} else {
+		delivery = <-c.inbox
+	}
+
+	message := new(Message)
+
+	err := message.UnmarshalJSON(delivery.encodedMessage)
+	if err != nil {
+		// A malformed or foreign message is dropped, only a failure of this node's own transport is fatal
+		log.Printf("Dropping message that can't be decoded: %v\n", err)
+		return nil
+	}
+	message.source = &delivery.from
+
+	c.mutex.Lock()
+
+	// If the peer that sent the message is not a known peer, add it to the peerNodes list
+	if !knownPeer(c.peerAddresses, message.From) {
+		c.peerAddresses = append(c.peerAddresses, message.From)
+	}
+
+	// Update the known peer's LastMessage value
+	c.peerAddresses = updateLastMessage(c.peerAddresses, message.From)
+
+	// The Middleware is recognized by the port a message really came from, which, unlike From, can't be made up
+	if delivery.from.Port == MIDDLEWARE_PORT {
+		c.middleware = PeerAddress{Address: delivery.from, LastMessageTime: time.Now()}
+	}
+
+	c.mutex.Unlock()
+
+	c.peerMessage <- *message
+
+	return nil
+}
+
+// PingNetwork is the interface method that sends a ping to all known peer nodes
+func (c *MemoryCommunicator) PingNetwork() error {
+
+	if len(c.GetPeerNodes()) == 0 {
+		log.Println("No known peer nodes, not sending pings")
+		return nil
+	}
+
+	toSend, err := c.GenerateMessage("PING", nil)
+	if err != nil {
+		log.Printf("Error generating message: %v\n", err)
+		return err
+	}
+
+	return c.BroadcastMsgToNetwork(toSend)
+}
+
+// Initialize is the interface method that joins the network on the next free port
+func (c *MemoryCommunicator) Initialize() error {
+	return c.InitializeWithPort(0)
+}
+
+// InitializeWithPort is the interface method that joins the network on the passed port
+func (c *MemoryCommunicator) InitializeWithPort(port int) error {
+
+	if c.Network == nil {
+		return errors.New("no memory network configured")
+	}
+
+	c.inbox = make(chan memoryDelivery, memoryInboxSize)
+	c.peerMessage = make(chan Message)
+
+	others, err := c.Network.join(c, port)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.peerAddresses = others
+
+	for _, peer := range others {
+		if peer.Address.Port == MIDDLEWARE_PORT {
+			// If this peer is the Middleware, set it as the communicators Middleware node value
+			c.middleware = peer
+		}
+	}
+
+	return nil
+}
+
+// Terminate is the interface method that leaves the network
+func (c *MemoryCommunicator) Terminate() {
+	if c.Network != nil {
+		c.Network.leave(c.self.Address.Port)
+	}
+}
+
+// BroadcastMsgToNetwork is the interface method that sends the message to every known peer. A peer that can't be
+// reached doesn't stop the message from reaching the others, and the last error is returned
+func (c *MemoryCommunicator) BroadcastMsgToNetwork(m Message) error {
+
+	encodedMessage, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Error marshalling message: %v\n", err)
+		return err
+	}
+
+	var lastErr error
+	for _, peer := range c.GetPeerNodes() {
+		err = c.Network.deliver(encodedMessage, c.self.Address, peer.Address)
+		if err != nil {
+			log.Printf("Couldn't send message to peer during broadcast: %v\n", err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// SendMsgToPeer is the interface method that sends the message to one peer
+func (c *MemoryCommunicator) SendMsgToPeer(m Message, p PeerAddress) error {
+
+	encodedMessage, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Error marshalling message: %v\n", err)
+		return err
+	}
+
+	err = c.Network.deliver(encodedMessage, c.self.Address, p.Address)
+	if err != nil {
+		log.Printf("Error sending message to Peer: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// PrunePeerNodes is the interface method that removes nodes from the peerNodes list which have
+// not sent a message within the previous 75 seconds, as we assume that node to have gone down
+func (c *MemoryCommunicator) PrunePeerNodes() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, peer := range c.peerAddresses {
+		if time.Since(peer.LastMessageTime).Seconds() >= 75 {
+			log.Printf("Pruning peer node: %+v\n", peer)
+			c.peerAddresses = removeFromList(c.peerAddresses, peer, i)
+			return
+		}
+	}
+}
+
+// GenerateMessage uses the passed values to generate a new Message
+func (c *MemoryCommunicator) GenerateMessage(cmd string, data Data) (Message, error) {
+	return Message{Command: cmd, Data: data, From: PeerAddress{Address: c.self.Address, LastMessageTime: time.Now()}}, nil
+}
@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+// MEMORY_NETWORK_PEERS is the number of proof of work peers that the MemoryNetwork test runs next to its Middleware
+const MEMORY_NETWORK_PEERS = 3
+
+func TestMemoryNetworkConvergesOnValidatedChain(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("a mining session takes more than 10 seconds")
+	}
+
+	middleware, peers, _ := startMemoryNetwork(t, MEMORY_NETWORK_PEERS, 0)
+
+	note := Note{Text: "mined on a memory network"}
+	mineEntry(t, middleware, peers, note)
+
+	for i, peer := range peers {
+		chain := peer.GetChain()
+
+		err := ValidateChain(chain, &ProofOfWork{ProofDifficulty: 1}, &Client{})
+		if err != nil {
+			t.Errorf("chain of peer %d is invalid: %v", i, err)
+		}
+
+		if _, ok := findEntry(chain, note); !ok {
+			t.Errorf("chain of peer %d doesn't hold the submitted note", i)
+		}
+	}
+}
+
+func TestMemoryNetworkKnowsWhereMessagesCameFrom(t *testing.T) {
+
+	network := NewMemoryNetwork()
+	middleware, peer, forger := &MemoryCommunicator{Network: network}, &MemoryCommunicator{Network: network}, &MemoryCommunicator{Network: network}
+
+	err := middleware.InitializeWithPort(MIDDLEWARE_PORT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*MemoryCommunicator{middleware, peer, forger} {
+		if c != middleware {
+			err = c.Initialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Cleanup(c.Terminate)
+	}
+
+	// A node can claim to be the Middleware in its message, but not send the message from the Middleware's address
+	forged, _ := forger.GenerateMessage("BLOCK_ACCEPTED", nil)
+	forged.From = middleware.GetSelfAddress()
+
+	received := sendAndReceive(t, forger, peer, forged)
+	if received.sentBy(peer.GetMiddlewarePeer()) || !received.sentBy(forger.GetSelfAddress()) {
+		t.Error("forged message was taken to come from the Middleware")
+	}
+	if peer.GetMiddlewarePeer().String() != middleware.GetSelfAddress().String() {
+		t.Error("forged message changed the Middleware")
+	}
+
+	accepted, _ := middleware.GenerateMessage("BLOCK_ACCEPTED", nil)
+	if !sendAndReceive(t, middleware, peer, accepted).sentBy(peer.GetMiddlewarePeer()) {
+		t.Error("message from the Middleware wasn't taken to come from it")
+	}
+
+	// A message that was never received came from nobody
+	if accepted.sentBy(middleware.GetSelfAddress()) {
+		t.Error("message that wasn't received has a sender")
+	}
+}
+
+// sendAndReceive sends the message from one node to another and returns it as the other node received it
+func sendAndReceive(t *testing.T, from *MemoryCommunicator, to *MemoryCommunicator, m Message) Message {
+
+	err := from.SendMsgToPeer(m, to.GetSelfAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go to.RecieveFromNetwork(false)
+
+	select {
+	case received := <-to.GetMessageChannel():
+		return received
+	case <-time.After(time.Second):
+		t.Fatal("message wasn't received")
+		return Message{}
+	}
+}
+
+// startMemoryNetwork starts a Middleware followed by the passed numbers of full and light proof of work peers on a
+// new MemoryNetwork, which are stopped when the test ends. The light peers come after the full peers, and every peer
+// has a headless Client
+func startMemoryNetwork(t *testing.T, full int, light int) (*Middleware, []*Peer, []*Client) {
+
+	network := NewMemoryNetwork()
+
+	// The Middleware is created first, so that every peer finds it when joining the network
+	middleware, err := NewMiddleware(&MemoryCommunicator{Network: network}, &ProofOfWork{ProofDifficulty: 1}, MIDDLEWARE_PORT, 0, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go middleware.Run()
+	t.Cleanup(middleware.Stop)
+
+	peers := []*Peer{}
+	clients := []*Client{}
+	for i := 0; i < full+light; i++ {
+		client := &Client{Headless: true}
+
+		var peer *Peer
+		if i < full {
+			peer, err = NewPeer(&MemoryCommunicator{Network: network}, &ProofOfWork{ProofDifficulty: 1}, client, nil)
+		} else {
+			peer, err = NewLightPeer(&MemoryCommunicator{Network: network}, &ProofOfWork{ProofDifficulty: 1}, client)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go peer.Run()
+		t.Cleanup(peer.Stop)
+
+		peers = append(peers, peer)
+		clients = append(clients, client)
+	}
+
+	// Give the peers time to announce themselves, so that every one of them is sent the mining session
+	time.Sleep(time.Second)
+
+	return &middleware, peers, clients
+}
+
+// mineEntry submits an entry to the Middleware and waits until the passed full peers converge on a chain that holds it
+func mineEntry(t *testing.T, middleware *Middleware, peers []*Peer, d Data) {
+
+	err := middleware.SubmitData(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A session takes 5 seconds of validation and 5 seconds of consensus, so wait for a few of them at most
+	waitFor(t, 60*time.Second, "peers to converge on a chain holding the submitted entry", func() bool {
+		if !converged(peers) {
+			return false
+		}
+		_, ok := findEntry(peers[0].GetChain(), d)
+		return ok
+	})
+}
+
+// waitFor polls the condition until it holds, and fails the test if it doesn't hold before the timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// converged returns true if every peer has a chain with a mined block, and their chains end in the same block
+func converged(peers []*Peer) bool {
+
+	tip := ""
+	for _, peer := range peers {
+		chain := peer.GetChain()
+		if len(chain) < 2 {
+			return false
+		}
+
+		last := chain[len(chain)-1].Hash
+		if tip != "" && last != tip {
+			return false
+		}
+		tip = last
+	}
+
+	return true
+}
+
+// findEntry returns the index of the block of the chain that holds the entry
+func findEntry(chain []Block, d Data) (int, bool) {
+	for _, b := range chain {
+		for _, entry := range b.Data {
+			if LeafHash(entry) == LeafHash(d) {
+				return b.Index, true
+			}
+		}
+	}
+	return 0, false
+}
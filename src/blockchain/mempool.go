@@ -0,0 +1,487 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ============================ Mempool ============================
+
+const (
+	// DEFAULT_MEMPOOL_SIZE is the number of entries a Mempool holds if no MaxSize is set
+	DEFAULT_MEMPOOL_SIZE = 1000
+
+	// DEFAULT_MEMPOOL_EXPIRY is how long an entry is kept if no Expiry is set
+	DEFAULT_MEMPOOL_EXPIRY = time.Hour
+)
+
+// Mempool holds the transactions and other payloads that were submitted to the Middleware until they are mined. Every
+// entry is checked before it is admitted, so that a block built from the Mempool is one that peers will accept:
+// transactions must be signed by their sender, carry the sender's next nonce and be affordable from the sender's
+// balance once the sender's other waiting transactions are paid for. Entries are mined in order of their fee, highest
+// first, and in the order they were received when their fees are equal. Once the Mempool holds MaxSize entries, an
+// entry is only admitted if it pays a higher fee than the cheapest entry, which is then evicted, and entries that
+// haven't been mined after Expiry are dropped.
+type Mempool struct {
+	MaxSize  int
+	Expiry   time.Duration
+	ledger   *Ledger
+	entries  []*MempoolEntry
+	received int
+	mutex    sync.Mutex
+}
+
+// MempoolEntry is an entry waiting in the Mempool, as it is listed by the Middleware's /mempool endpoint
+type MempoolEntry struct {
+	Hash     string    `json:"hash"`
+	Type     string    `json:"type"`
+	Data     Data      `json:"data"`
+	Fee      int       `json:"fee"`
+	Received time.Time `json:"received"`
+	Mining   bool      `json:"mining"`
+	sequence int
+}
+
+// initialize prepares the Mempool to admit entries against the account state of the passed ledger
+func (mp *Mempool) initialize(ledger *Ledger) {
+
+	if mp.MaxSize <= 0 {
+		mp.MaxSize = DEFAULT_MEMPOOL_SIZE
+	}
+
+	if mp.Expiry <= 0 {
+		mp.Expiry = DEFAULT_MEMPOOL_EXPIRY
+	}
+
+	mp.ledger = ledger
+	mp.entries = []*MempoolEntry{}
+}
+
+// Add checks the passed transaction or other payload and, if it is valid, admits it to the Mempool. The returned
+// error explains why an entry wasn't admitted
+func (mp *Mempool) Add(d Data) error {
+
+	err := ValidatePayload(d)
+	if err != nil {
+		return err
+	}
+
+	switch d.(type) {
+	case Coinbase:
+		return errors.New("coinbase entries are only created by miners")
+	case Election:
+		return errors.New("elections are only recorded by block producers")
+	}
+
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mp.dropExpired()
+
+	entry := &MempoolEntry{Hash: LeafHash(d), Type: d.GetType(), Data: d, Received: time.Now(), sequence: mp.received}
+
+	for _, e := range mp.entries {
+		if e.Hash == entry.Hash {
+			return errors.New("entry is already in the mempool")
+		}
+	}
+
+	if transaction, ok := d.(Transaction); ok {
+		err = mp.checkTransaction(transaction)
+		if err != nil {
+			return err
+		}
+		entry.Fee = transaction.Fee
+	}
+
+	if evidence, ok := d.(SlashingEvidence); ok {
+		err = mp.checkEvidence(evidence)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(mp.entries) >= mp.MaxSize {
+		err = mp.evictFor(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	mp.entries = append(mp.entries, entry)
+	mp.received++
+
+	return nil
+}
+
+// NextNonce returns the nonce that the next transaction from the account with the passed address must carry, which
+// counts the account's transactions that are waiting in the Mempool
+func (mp *Mempool) NextNonce(address string) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	next, _ := mp.pendingState(address)
+	return next
+}
+
+// Len returns the number of entries that are waiting to be mined, not counting those in the current mining session
+func (mp *Mempool) Len() int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mp.dropExpired()
+
+	queued := 0
+	for _, e := range mp.entries {
+		if !e.Mining {
+			queued++
+		}
+	}
+
+	return queued
+}
+
+// Entries returns a copy of every entry in the Mempool, in the order they will be mined
+func (mp *Mempool) Entries() []MempoolEntry {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mp.dropExpired()
+
+	entries := []MempoolEntry{}
+	for _, e := range mp.entries {
+		entries = append(entries, *e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return higherPriority(&entries[i], &entries[j]) })
+
+	return entries
+}
+
+// PopBatch picks up to size entries to be mined into the next block, highest fee first, and marks them as being
+// mined. A sender's transactions are always picked in nonce order, so a transaction is only picked once the
+// transaction before it is. The entries stay in the Mempool until the chain shows that they were mined, see Update
+func (mp *Mempool) PopBatch(size int) DataBatch {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mp.dropExpired()
+
+	// The next nonce of every sender, counting the transactions that are already being mined
+	nextNonces := make(map[string]int)
+	nextNonce := func(address string) int {
+		if next, ok := nextNonces[address]; ok {
+			return next
+		}
+		next := mp.ledger.NextNonce(address)
+		for _, e := range mp.entries {
+			if t, ok := e.Data.(Transaction); ok && e.Mining && t.From == address && t.Nonce >= next {
+				next = t.Nonce + 1
+			}
+		}
+		nextNonces[address] = next
+		return next
+	}
+
+	batch := DataBatch{Entries: []Data{}}
+	for len(batch.Entries) < size {
+
+		var best *MempoolEntry
+		for _, e := range mp.entries {
+			if e.Mining {
+				continue
+			}
+			if t, ok := e.Data.(Transaction); ok && t.Nonce != nextNonce(t.From) {
+				continue
+			}
+			if best == nil || higherPriority(e, best) {
+				best = e
+			}
+		}
+
+		if best == nil {
+			break
+		}
+
+		best.Mining = true
+		batch.Entries = append(batch.Entries, best.Data)
+
+		if t, ok := best.Data.(Transaction); ok {
+			nextNonces[t.From] = t.Nonce + 1
+		}
+	}
+
+	return batch
+}
+
+// EndMining returns the entries of the mining session that just ended to the queue, so that entries whose block
+// didn't make it onto the chain are mined again. Call Update with the new chain first, so mined entries are removed
+func (mp *Mempool) EndMining() {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	for _, e := range mp.entries {
+		e.Mining = false
+	}
+}
+
+// Update removes the entries that are on the passed chain, which the Mempool's ledger must have been built from, and
+// every transaction that no longer fits onto it, for example because its nonce was used by another transaction, along
+// with slashing evidence whose offence was slashed or is too old
+func (mp *Mempool) Update(chain []Block) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mined := make(map[string]bool)
+	for _, b := range chain {
+		for _, d := range b.Data {
+			mined[LeafHash(d)] = true
+		}
+	}
+
+	kept := []*MempoolEntry{}
+	for _, e := range mp.entries {
+		if mined[e.Hash] {
+			continue
+		}
+		if evidence, ok := e.Data.(SlashingEvidence); ok && mp.ledger.CheckEvidence(evidence) != nil {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	mp.entries = kept
+
+	mp.dropExpired()
+
+	// Walk every sender's transactions in nonce order, keeping them for as long as they continue from the sender's
+	// account state and can be paid for
+	sort.SliceStable(mp.entries, func(i, j int) bool {
+		a, aOk := mp.entries[i].Data.(Transaction)
+		b, bOk := mp.entries[j].Data.(Transaction)
+		if aOk != bOk {
+			return bOk
+		}
+		if !aOk || a.From != b.From {
+			return aOk && a.From < b.From
+		}
+		return a.Nonce < b.Nonce
+	})
+
+	type account struct{ next, spendable, bonded int }
+	accounts := make(map[string]*account)
+
+	kept = []*MempoolEntry{}
+	for _, e := range mp.entries {
+		t, ok := e.Data.(Transaction)
+		if !ok {
+			kept = append(kept, e)
+			continue
+		}
+
+		a := accounts[t.From]
+		if a == nil {
+			a = &account{next: mp.ledger.NextNonce(t.From), spendable: mp.ledger.Balance(t.From), bonded: mp.ledger.Stake(t.From)}
+			accounts[t.From] = a
+		}
+
+		if t.Nonce != a.next || t.cost() > a.spendable || (t.Kind == TRANSACTION_UNSTAKE && t.Amount > a.bonded) {
+			continue
+		}
+
+		a.next++
+		a.spendable -= t.cost()
+		switch t.Kind {
+		case TRANSACTION_STAKE:
+			a.bonded += t.Amount
+		case TRANSACTION_UNSTAKE:
+			a.bonded -= t.Amount
+		}
+		kept = append(kept, e)
+	}
+
+	mp.entries = kept
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// checkTransaction checks that a transaction is signed by its sender, carries the sender's next nonce and can be
+// paid for. The mutex must be held
+func (mp *Mempool) checkTransaction(t Transaction) error {
+
+	err := VerifyTransaction(t)
+	if err != nil {
+		return err
+	}
+
+	next, spent := mp.pendingState(t.From)
+
+	err = checkNonce(t, next)
+	if err != nil {
+		return err
+	}
+
+	spendable := mp.ledger.Balance(t.From) - spent
+	if t.cost() > spendable {
+		return fmt.Errorf("%s can't pay %d, its balance after its waiting transactions is %d", t.From, t.cost(), spendable)
+	}
+
+	// Stake can only be unbonded once, so the stake that waiting transactions unbond can't be unbonded again
+	if t.Kind == TRANSACTION_UNSTAKE {
+		bonded := mp.ledger.Stake(t.From)
+		for _, e := range mp.entries {
+			if w, ok := e.Data.(Transaction); ok && w.From == t.From && w.Nonce >= mp.ledger.NextNonce(t.From) {
+				switch w.Kind {
+				case TRANSACTION_STAKE:
+					bonded += w.Amount
+				case TRANSACTION_UNSTAKE:
+					bonded -= w.Amount
+				}
+			}
+		}
+
+		if t.Amount > bonded {
+			return fmt.Errorf("%s can't unbond %d, its stake after its waiting transactions is %d", t.From, t.Amount, bonded)
+		}
+	}
+
+	return nil
+}
+
+// checkEvidence checks that slashing evidence can be recorded in the next block, and that no evidence of the same
+// offence is waiting already. The mutex must be held
+func (mp *Mempool) checkEvidence(e SlashingEvidence) error {
+
+	for _, entry := range mp.entries {
+		if waiting, ok := entry.Data.(SlashingEvidence); ok && waiting.key() == e.key() {
+			return errors.New("evidence of the offence is already in the mempool")
+		}
+	}
+
+	return mp.ledger.CheckEvidence(e)
+}
+
+// pendingState returns the next nonce of an account and the amount that its transactions in the Mempool spend,
+// including their fees. The mutex must be held
+func (mp *Mempool) pendingState(address string) (int, int) {
+
+	next := mp.ledger.NextNonce(address)
+	spent := 0
+
+	for _, e := range mp.entries {
+		t, ok := e.Data.(Transaction)
+		if !ok || t.From != address || t.Nonce < next {
+			continue
+		}
+		spent += t.cost()
+	}
+
+	// The Mempool only admits transactions that continue on from the one before, so they form an unbroken run
+	for _, e := range mp.entries {
+		if t, ok := e.Data.(Transaction); ok && t.From == address && t.Nonce >= next {
+			next = t.Nonce + 1
+		}
+	}
+
+	return next, spent
+}
+
+// evictFor makes room for the passed entry by evicting the cheapest entry that nothing else depends on, which
+// must pay a lower fee than the passed entry. The mutex must be held
+func (mp *Mempool) evictFor(entry *MempoolEntry) error {
+
+	// A sender's transaction can only be evicted if it is the sender's last, otherwise it would leave a nonce gap
+	last := make(map[string]int)
+	for _, e := range mp.entries {
+		if t, ok := e.Data.(Transaction); ok && t.Nonce >= last[t.From] {
+			last[t.From] = t.Nonce
+		}
+	}
+
+	victim := -1
+	for i, e := range mp.entries {
+		if e.Mining {
+			continue
+		}
+		if t, ok := e.Data.(Transaction); ok && t.Nonce != last[t.From] {
+			continue
+		}
+		if victim == -1 || higherPriority(mp.entries[victim], e) {
+			victim = i
+		}
+	}
+
+	if victim == -1 || entry.Fee <= mp.entries[victim].Fee {
+		return fmt.Errorf("mempool is full, a fee higher than %d is needed", mp.lowestFee())
+	}
+
+	// A transaction that continues on from the victim can't be admitted without it
+	if t, ok := entry.Data.(Transaction); ok {
+		if v, ok := mp.entries[victim].Data.(Transaction); ok && v.From == t.From {
+			return fmt.Errorf("mempool is full, a fee higher than %d is needed", mp.lowestFee())
+		}
+	}
+
+	mp.entries = append(mp.entries[:victim], mp.entries[victim+1:]...)
+
+	return nil
+}
+
+// lowestFee returns the lowest fee paid by any entry in the Mempool. The mutex must be held
+func (mp *Mempool) lowestFee() int {
+
+	lowest := 0
+	for i, e := range mp.entries {
+		if i == 0 || e.Fee < lowest {
+			lowest = e.Fee
+		}
+	}
+
+	return lowest
+}
+
+// dropExpired removes the entries that have waited longer than the Mempool's Expiry, along with any transaction
+// that continues on from an expired one, as it could never be mined. The mutex must be held
+func (mp *Mempool) dropExpired() {
+
+	// The lowest expired nonce of every sender. Entries that are being mined are kept until the session ends
+	expired := make(map[string]int)
+	for _, e := range mp.entries {
+		if e.Mining || time.Since(e.Received) <= mp.Expiry {
+			continue
+		}
+		t, ok := e.Data.(Transaction)
+		if lowest, seen := expired[t.From]; ok && (!seen || t.Nonce < lowest) {
+			expired[t.From] = t.Nonce
+		}
+	}
+
+	kept := []*MempoolEntry{}
+	for _, e := range mp.entries {
+		if e.Mining {
+			kept = append(kept, e)
+			continue
+		}
+		if time.Since(e.Received) > mp.Expiry {
+			continue
+		}
+		if t, ok := e.Data.(Transaction); ok {
+			if lowest, seen := expired[t.From]; seen && t.Nonce >= lowest {
+				continue
+			}
+		}
+		kept = append(kept, e)
+	}
+
+	mp.entries = kept
+}
+
+// higherPriority returns true if entry a is mined before entry b, as it pays a higher fee or was received first
+func higherPriority(a *MempoolEntry, b *MempoolEntry) bool {
+	if a.Fee != b.Fee {
+		return a.Fee > b.Fee
+	}
+	return a.sequence < b.sequence
+}
@@ -0,0 +1,186 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+// wallet is a key whose address is funded in the Ledger of a test
+type wallet struct {
+	key     *ecdsa.PrivateKey
+	address string
+}
+
+// newWallet generates a new wallet
+func newWallet(t *testing.T) wallet {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet{key: key, address: AddressFromPublicKey(&key.PublicKey)}
+}
+
+// send returns a signed transfer of 1 from the wallet with the passed nonce and fee
+func (w wallet) send(t *testing.T, nonce int, fee int) Transaction {
+	signed, err := SignTransaction(Transaction{From: w.address, To: bob, Amount: 1, Nonce: nonce, Fee: fee}, w.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// newMempool returns a Mempool of the passed size over a Ledger in which each of the passed wallets holds 10
+func newMempool(size int, wallets ...wallet) *Mempool {
+
+	allocations := []Data{}
+	for _, w := range wallets {
+		allocations = append(allocations, Allocation{To: w.address, Amount: 10})
+	}
+
+	l := NewLedger()
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 0}, Data: allocations})
+
+	mp := &Mempool{MaxSize: size}
+	mp.initialize(l)
+
+	return mp
+}
+
+// add adds every entry to the Mempool and fails the test if one isn't admitted
+func add(t *testing.T, mp *Mempool, entries ...Data) {
+	for _, d := range entries {
+		err := mp.Add(d)
+		if err != nil {
+			t.Fatalf("%s wasn't admitted: %v", d.ToString(), err)
+		}
+	}
+}
+
+// sameEntries fails the test if the passed entries aren't the expected ones, in order
+func sameEntries(t *testing.T, name string, entries []Data, expected []Data) {
+	if len(entries) != len(expected) {
+		t.Fatalf("%s: %d entries, expected %d", name, len(entries), len(expected))
+	}
+	for i := range entries {
+		if LeafHash(entries[i]) != LeafHash(expected[i]) {
+			t.Errorf("%s: entry %d is %s, expected %s", name, i, entries[i].ToString(), expected[i].ToString())
+		}
+	}
+}
+
+func TestMempoolOrdering(t *testing.T) {
+
+	a, b := newWallet(t), newWallet(t)
+	mp := newMempool(10, a, b)
+
+	first, second := Note{Text: "first"}, Note{Text: "second"}
+	a0, a1, b0 := a.send(t, 0, 1), a.send(t, 1, 5), b.send(t, 0, 3)
+
+	add(t, mp, first, a0, b0, second, a1)
+
+	// Entries are listed by fee, highest first, and in the order they were received when their fees are equal
+	listed := []Data{}
+	for _, e := range mp.Entries() {
+		listed = append(listed, e.Data)
+	}
+	sameEntries(t, "entries", listed, []Data{a1, b0, a0, first, second})
+
+	// A sender's transactions are mined in nonce order however high their fees are
+	batch := mp.PopBatch(4)
+	sameEntries(t, "batch", batch.Entries, []Data{b0, a0, a1, first})
+
+	if mp.Len() != 1 {
+		t.Errorf("%d entries are waiting, expected 1", mp.Len())
+	}
+
+	// Entries being mined are only picked again once the session ends
+	sameEntries(t, "next batch", mp.PopBatch(4).Entries, []Data{second})
+
+	mp.EndMining()
+	if mp.Len() != 5 {
+		t.Errorf("%d entries are waiting after the session ended, expected 5", mp.Len())
+	}
+}
+
+func TestMempoolEviction(t *testing.T) {
+
+	a, b, c := newWallet(t), newWallet(t), newWallet(t)
+	mp := newMempool(2, a, b, c)
+
+	note, a0, a1, b0, c0 := Note{Text: "cheap"}, a.send(t, 0, 2), a.send(t, 1, 3), b.send(t, 0, 1), c.send(t, 0, 6)
+	add(t, mp, note, a0)
+
+	tests := []struct {
+		name     string
+		entry    Data
+		admitted bool
+		evicted  Data
+	}{
+		{"same fee as the cheapest entry", b.send(t, 0, 0), false, nil},
+		{"higher fee than the cheapest entry", b0, true, note},
+		{"higher fee than another sender's transaction", a1, true, b0},
+		{"same fee as the last transaction of a sender", c.send(t, 0, 3), false, nil},
+		{"higher fee than the last transaction of a sender", c0, true, a1},
+		{"transaction that needs the cheapest entry", a.send(t, 1, 5), false, nil},
+	}
+
+	for _, test := range tests {
+		before := mp.Entries()
+
+		err := mp.Add(test.entry)
+		if (err == nil) != test.admitted {
+			t.Fatalf("%s: expected admitted %v, got %v", test.name, test.admitted, err)
+		}
+
+		after := mp.Entries()
+		if len(after) != 2 {
+			t.Fatalf("%s: mempool holds %d entries", test.name, len(after))
+		}
+
+		for _, e := range before {
+			kept := false
+			for _, other := range after {
+				kept = kept || other.Hash == e.Hash
+			}
+			evicted := test.evicted != nil && e.Hash == LeafHash(test.evicted)
+			if kept == evicted {
+				t.Errorf("%s: %s kept %v", test.name, e.Data.ToString(), kept)
+			}
+		}
+	}
+}
+
+func TestMempoolAdmission(t *testing.T) {
+
+	a := newWallet(t)
+
+	forged := a.send(t, 0, 0)
+	forged.Amount = 2
+
+	tests := []struct {
+		name    string
+		waiting []Data
+		entry   Data
+	}{
+		{"duplicate", []Data{Note{Text: "hello"}}, Note{Text: "hello"}},
+		{"coinbase", nil, Coinbase{Height: 1, To: a.address, Amount: 1}},
+		{"election", nil, Election{Height: 1, Entries: []ElectionEntry{{Height: 1, Address: a.address, Stake: 1, Commitment: "commitment", Secret: "secret"}}}},
+		{"invalid payload", nil, Note{}},
+		{"forged signature", nil, forged},
+		{"nonce already used", []Data{a.send(t, 0, 0)}, a.send(t, 0, 1)},
+		{"nonce gap", nil, a.send(t, 1, 0)},
+		{"overspend after waiting transactions", []Data{a.send(t, 0, 4), a.send(t, 1, 3)}, a.send(t, 2, 1)},
+	}
+
+	for _, test := range tests {
+		mp := newMempool(10, a)
+		add(t, mp, test.waiting...)
+
+		err := mp.Add(test.entry)
+		if err == nil {
+			t.Errorf("%s: entry was admitted", test.name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Leaves and the nodes above them are hashed with different prefixes, as in RFC 6962, so that a node can never be
+// passed off as a leaf or a leaf as a node
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// ============================ Merkle Tree ============================
+
+// MerkleRoot computes the root of the Merkle tree whose leaves are the hashes of the passed Data entries, in order.
+// When a level of the tree has an odd number of nodes, the last node is moved up to the next level unchanged rather
+// than paired with itself, so that no two lists of entries share a root. The root of an empty list is the empty string
+func MerkleRoot(data []Data) string {
+
+	if len(data) == 0 {
+		return ""
+	}
+
+	level := merkleLeaves(data)
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+
+	return hex.EncodeToString(level[0])
+}
+
+// LeafHash returns the hex encoded hash of a Data entry, which is how the entry is identified in the Merkle tree.
+// The entry's type tag is hashed along with its contents, so entries of different types can never share a leaf, see
+// LeafHashingBytes
+func LeafHash(d Data) string {
+	hashed := sha256.Sum256(append([]byte{merkleLeafPrefix}, LeafHashingBytes(d)...))
+	return hex.EncodeToString(hashed[:])
+}
+
+// NewMerkleProof produces the Merkle branch that proves the Data entry at the passed position is included in the block
+func NewMerkleProof(b Block, position int) (MerkleProof, error) {
+
+	if position < 0 || position >= len(b.Data) {
+		return MerkleProof{}, errors.New("position is outside of the block's data")
+	}
+
+	proof := MerkleProof{BlockIndex: b.Index, Leaf: LeafHash(b.Data[position]), Position: position, Leaves: len(b.Data), Branch: []string{}}
+
+	// Walk up the tree, remembering the sibling of the node on the path from the leaf to the root at every level. A
+	// node without a sibling is moved up unchanged, so nothing is remembered for it
+	level := merkleLeaves(b.Data)
+	index := position
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Branch = append(proof.Branch, hex.EncodeToString(level[sibling]))
+		}
+
+		level = merkleParents(level)
+		index = index / 2
+	}
+
+	return proof, nil
+}
+
+// Verify recomputes the root from the proof's leaf and branch and checks that it matches the passed Merkle root
+func (m MerkleProof) Verify(merkleRoot string) bool {
+
+	if m.Position < 0 || m.Position >= m.Leaves {
+		return false
+	}
+
+	node, err := hex.DecodeString(m.Leaf)
+	if err != nil {
+		return false
+	}
+
+	// The number of leaves tells us at which levels our node has no sibling and is moved up unchanged
+	index := m.Position
+	size := m.Leaves
+	branch := m.Branch
+	for size > 1 {
+		if index^1 < size {
+			if len(branch) == 0 {
+				return false
+			}
+
+			sibling, err := hex.DecodeString(branch[0])
+			if err != nil {
+				return false
+			}
+			branch = branch[1:]
+
+			// The position's bit at this level tells us whether our node is the left or right child
+			if index%2 == 0 {
+				node = hashPair(node, sibling)
+			} else {
+				node = hashPair(sibling, node)
+			}
+		}
+
+		index = index / 2
+		size = (size + 1) / 2
+	}
+
+	return len(branch) == 0 && hex.EncodeToString(node) == merkleRoot
+}
+
+// checkDistinctEntries returns an error if two of the passed Data entries are the same, which would give them the
+// same leaf hash and make the block's data ambiguous
+func checkDistinctEntries(data []Data) error {
+
+	seen := make(map[string]int)
+	for i, d := range data {
+		leaf := LeafHash(d)
+		if first, ok := seen[leaf]; ok {
+			return fmt.Errorf("data entries %d and %d are the same", first, i)
+		}
+		seen[leaf] = i
+	}
+
+	return nil
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// merkleLeaves hashes every Data entry to produce the bottom level of the tree
+func merkleLeaves(data []Data) [][]byte {
+
+	leaves := [][]byte{}
+	for _, d := range data {
+		leaf, _ := hex.DecodeString(LeafHash(d))
+		leaves = append(leaves, leaf)
+	}
+
+	return leaves
+}
+
+// merkleParents hashes each pair of nodes of a level to produce the level above it. The last node of a level with an
+// odd number of nodes is moved up unchanged
+func merkleParents(level [][]byte) [][]byte {
+
+	parents := [][]byte{}
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			parents = append(parents, level[i])
+			continue
+		}
+		parents = append(parents, hashPair(level[i], level[i+1]))
+	}
+
+	return parents
+}
+
+// hashPair hashes the concatenation of two nodes, after the prefix that marks it as a node above the leaves
+func hashPair(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
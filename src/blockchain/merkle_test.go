@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMerkleRootDependsOnOrderAndCount(t *testing.T) {
+
+	a, b, c := Note{Text: "a"}, Note{Text: "b"}, Note{Text: "c"}
+
+	if MerkleRoot([]Data{}) != "" {
+		t.Error("root of no entries isn't empty")
+	}
+
+	if MerkleRoot([]Data{a}) != LeafHash(a) {
+		t.Error("root of one entry isn't its leaf")
+	}
+
+	roots := map[string]string{}
+	for name, data := range map[string][]Data{"ab": {a, b}, "ba": {b, a}, "abc": {a, b, c}, "abcc": {a, b, c, c}} {
+		root := MerkleRoot(data)
+		if other, ok := roots[root]; ok {
+			t.Errorf("%s and %s share a root", name, other)
+		}
+		roots[root] = name
+	}
+}
+
+// notes returns a block holding the passed number of different notes
+func notes(count int) Block {
+	data := []Data{}
+	for i := 0; i < count; i++ {
+		data = append(data, Note{Text: fmt.Sprintf("note %d", i)})
+	}
+	return Block{BlockHeader: BlockHeader{Index: 1, MerkleRoot: MerkleRoot(data)}, Data: data}
+}
+
+func TestMerkleProofVerifiesEveryPosition(t *testing.T) {
+
+	for _, leaves := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 16, 17} {
+		b := notes(leaves)
+
+		for position := 0; position < leaves; position++ {
+			proof, err := NewMerkleProof(b, position)
+			if err != nil {
+				t.Fatalf("%d leaves, position %d: %v", leaves, position, err)
+			}
+
+			if proof.Leaf != LeafHash(b.Data[position]) || proof.Leaves != leaves {
+				t.Errorf("%d leaves, position %d: proof doesn't describe the entry", leaves, position)
+			}
+
+			if !proof.Verify(b.MerkleRoot) {
+				t.Errorf("%d leaves, position %d: proof was rejected", leaves, position)
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejectsTampering(t *testing.T) {
+
+	b := notes(5)
+	other := notes(6)
+
+	proof, err := NewMerkleProof(b, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(m MerkleProof) MerkleProof
+		root   string
+	}{
+		{"other root", func(m MerkleProof) MerkleProof { return m }, other.MerkleRoot},
+		{"empty root", func(m MerkleProof) MerkleProof { return m }, ""},
+		{"other leaf", func(m MerkleProof) MerkleProof { m.Leaf = LeafHash(b.Data[3]); return m }, b.MerkleRoot},
+		{"malformed leaf", func(m MerkleProof) MerkleProof { m.Leaf = "zz"; return m }, b.MerkleRoot},
+		{"other position", func(m MerkleProof) MerkleProof { m.Position = 3; return m }, b.MerkleRoot},
+		{"negative position", func(m MerkleProof) MerkleProof { m.Position = -1; return m }, b.MerkleRoot},
+		{"position past the leaves", func(m MerkleProof) MerkleProof { m.Position = 5; return m }, b.MerkleRoot},
+		{"other number of leaves", func(m MerkleProof) MerkleProof { m.Leaves = 4; return m }, b.MerkleRoot},
+		{"changed sibling", func(m MerkleProof) MerkleProof {
+			m.Branch = append([]string{LeafHash(b.Data[0])}, m.Branch[1:]...)
+			return m
+		}, b.MerkleRoot},
+		{"missing sibling", func(m MerkleProof) MerkleProof { m.Branch = m.Branch[:len(m.Branch)-1]; return m }, b.MerkleRoot},
+		{"extra sibling", func(m MerkleProof) MerkleProof { m.Branch = append(m.Branch, m.Branch[0]); return m }, b.MerkleRoot},
+	}
+
+	for _, test := range tests {
+		branch := append([]string{}, proof.Branch...)
+		tampered := test.tamper(MerkleProof{BlockIndex: proof.BlockIndex, Leaf: proof.Leaf, Position: proof.Position, Leaves: proof.Leaves, Branch: branch})
+
+		if tampered.Verify(test.root) {
+			t.Errorf("%s: proof was accepted", test.name)
+		}
+	}
+}
+
+func TestNewMerkleProofRejectsPositionsOutsideTheBlock(t *testing.T) {
+
+	b := notes(3)
+
+	for _, position := range []int{-1, 3, 10} {
+		_, err := NewMerkleProof(b, position)
+		if err == nil {
+			t.Errorf("position %d: proof was produced", position)
+		}
+	}
+}
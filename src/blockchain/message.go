@@ -4,185 +4,98 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net"
-	"time"
 )
 
-// Message is the struct that is marshalled/demarshalled between peers to communicate
+// PROTOCOL_VERSION is the version of the message envelope. Nodes refuse messages that use a different version
+const PROTOCOL_VERSION = 1
+
+// Message is the struct that is marshalled/demarshalled between peers to communicate. From is filled in by the
+// sender, so it only says where replies should go. The address that a received message actually arrived from is
+// kept by the communication component, see sentBy
 type Message struct {
 	From    PeerAddress `json:"from"`
 	Command string      `json:"command"`
 	Data    Data        `json:"data,omitempty"`
+	source  *net.UDPAddr
 }
 
-// UnmarshalJSON is a custom JSON unmarshaller
-func (m *Message) UnmarshalJSON(bytes []byte) error {
+// envelope is the form a Message takes on the network. The Data is tagged with its type, so the receiver can
+// look up the decoder that was registered for it
+type envelope struct {
+	Version int             `json:"version"`
+	From    PeerAddress     `json:"from"`
+	Command string          `json:"command"`
+	Type    string          `json:"type,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
 
-	var result map[string]interface{}
-	err := json.Unmarshal(bytes, &result)
-	if err != nil {
-		log.Printf("Error unmarshalling message: %v\n", err)
-		return err
-	}
-	// fmt.Printf("DEBUG - Unmarshal result is: %+v\n", result)
-
-	// Unmarshal the data of the Peer who sent the message
-	from := result["from"].(map[string]interface{})
-	address := from["address"].(map[string]interface{})
-	ip := net.ParseIP(address["IP"].(string))
-	port := int(address["Port"].(float64))
-	newAddress := net.UDPAddr{IP: ip, Port: port}
-	lastMessageTime := from["lastMessageTime"].(string)
-	parsedLastMessageTime, err := time.Parse(time.RFC3339, lastMessageTime)
-	if err != nil {
-		log.Println("Failed to parse time:", err.Error())
+// MarshalJSON is a custom JSON marshaller that wraps the Message in a versioned envelope
+func (m Message) MarshalJSON() ([]byte, error) {
+
+	e := envelope{Version: PROTOCOL_VERSION, From: m.From, Command: m.Command}
+
+	if m.Data != nil {
+		data, err := json.Marshal(m.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Type = m.Data.GetType()
+		e.Data = data
 	}
 
-	newPeer := PeerAddress{Address: newAddress, LastMessageTime: parsedLastMessageTime}
+	return json.Marshal(e)
+}
 
-	// Umarshall the command
-	command := result["command"].(string)
+// UnmarshalJSON is a custom JSON unmarshaller that unwraps the Message from its envelope and decodes the
+// Data with the decoder registered for its type. The command must be registered, and the Data must be of a type that
+// the command carries, see RegisterCommand
+func (m *Message) UnmarshalJSON(bytes []byte) error {
 
-	// Unmarshal the data
-	data := result["data"]
+	var e envelope
+	err := json.Unmarshal(bytes, &e)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling message envelope: %v", err)
+	}
+
+	if e.Version != PROTOCOL_VERSION {
+		return fmt.Errorf("unsupported protocol version %d, expected %d", e.Version, PROTOCOL_VERSION)
+	}
 
-	var dataStruct Data
+	if e.Command == "" {
+		return errors.New("message has no command")
+	}
 
-	if data != nil {
+	err = checkCommand(e.Command, e.Type)
+	if err != nil {
+		return err
+	}
 
-		dataObject := data.(map[string]interface{})
-		if val, ok := dataObject["from"]; ok {
-
-			// Then the data is a transaction, so unmarshal into a Transaction struct
-			from := val.(string)
-			to := dataObject["to"].(string)
-			amount := int(dataObject["amount"].(float64))
-			signature := dataObject["signature"].(string)
-			dataStruct = Transaction{From: from, To: to, Amount: amount, Signature: signature}
-
-		} else if val, ok := dataObject["chainCopy"]; ok {
-			// Then the data is a chain copy, so unmarshal into a ChainCopy struct
-			list := val.([]interface{})
-			newChain := Chain{ChainCopy: []Block{}}
-
-			//Umarshal the chain
-			for _, block := range list {
-				blockMap := block.(map[string]interface{})
-				dataMap := blockMap["Data"].(map[string]interface{})
-
-				// We can assume that the Data will be of type Transaction, for now
-				from := dataMap["from"].(string)
-				to := dataMap["to"].(string)
-				amount := int(dataMap["amount"].(float64))
-				signature := dataMap["signature"].(string)
-				newTransaction := Transaction{From: from, To: to, Amount: amount, Signature: signature}
-
-				// Umarshal the rest of the block
-				index := int(blockMap["Index"].(float64))
-				timestamp := blockMap["Timestamp"].(string)
-				prevHash := blockMap["PrevHash"].(string)
-				hash := blockMap["Hash"].(string)
-				nonce := int(blockMap["Nonce"].(float64))
-				newBlock := Block{Data: newTransaction, Index: index, Timestamp: timestamp, PrevHash: prevHash, Hash: hash, Nonce: nonce}
-				newChain.ChainCopy = append(newChain.ChainCopy, newBlock)
-			}
-
-			dataStruct = newChain
-
-		} else if val, ok := dataObject["list"]; ok {
-			// Then the data is a list of peer chains, so unmarshal into a PeerChains struct
-
-			if val != nil {
-				newList := PeerChains{List: [][]Block{}}
-				list := val.([]interface{})
-
-				for _, chain := range list {
-					tempList := []Block{}
-
-					//Umarshal the chain
-					for _, block := range chain.([]interface{}) {
-						blockMap := block.(map[string]interface{})
-
-						dataMap := blockMap["Data"].(map[string]interface{})
-
-						// We can assume that the Data will be of type Transaction, for now
-						from := dataMap["from"].(string)
-						to := dataMap["to"].(string)
-						amount := int(dataMap["amount"].(float64))
-						signature := dataMap["signature"].(string)
-						newTransaction := Transaction{From: from, To: to, Amount: amount, Signature: signature}
-
-						// Umarshal the rest of the block
-						index := int(blockMap["Index"].(float64))
-						timestamp := blockMap["Timestamp"].(string)
-						prevHash := blockMap["PrevHash"].(string)
-						hash := blockMap["Hash"].(string)
-						nonce := int(blockMap["Nonce"].(float64))
-						newBlock := Block{Data: newTransaction, Index: index, Timestamp: timestamp, PrevHash: prevHash, Hash: hash, Nonce: nonce}
-						tempList = append(tempList, newBlock)
-					}
-
-					newList.List = append(newList.List, tempList)
-
-				}
-
-				dataStruct = newList
-
-			} else {
-				// Else if temp is nil, the Middlware sent an empty list, thus there are no existing peer chains, return
-				// an empty PeerChains struct
-				fmt.Println("No existing peer chains.")
-				dataStruct = PeerChains{}
-			}
-		} else if val, ok := dataObject["stake"]; ok {
-
-			// Then the data is a lottery entry, so unmarshal into a LotteryEntry struct
-			stake := int(val.(float64))
-			dataStruct = LotteryEntry{Stake: stake, Peer: newPeer}
-
-		} else if val, ok := dataObject["block"]; ok {
-
-			// Then the data is a candidate, so unmarshal into a CandidateBlock struct
-			blockMap := val.(map[string]interface{})
-
-			dataMap := blockMap["Data"].(map[string]interface{})
-
-			// We can assume that the Data will be of type Transaction, for now
-			from := dataMap["from"].(string)
-			to := dataMap["to"].(string)
-			amount := int(dataMap["amount"].(float64))
-			signature := dataMap["signature"].(string)
-			newTransaction := Transaction{From: from, To: to, Amount: amount, Signature: signature}
-
-			index := int(blockMap["Index"].(float64))
-			timestamp := blockMap["Timestamp"].(string)
-			prevHash := blockMap["PrevHash"].(string)
-			hash := blockMap["Hash"].(string)
-			nonce := int(blockMap["Nonce"].(float64))
-			candidateBlock := Block{Data: newTransaction, Index: index, Timestamp: timestamp, PrevHash: prevHash, Hash: hash, Nonce: nonce}
-			dataStruct = CandidateBlock{Block: candidateBlock, Miner: newPeer}
-
-		} else if val, ok := dataObject["x"]; ok {
-
-			// Then the data is a lottery entry, so unmarshal into a LotteryEntry struct
-			x := val.(string)
-			y := dataObject["y"].(string)
-			dataStruct = PublicKey{X: x, Y: y}
-
-		} else {
-			// Else the data is of an unsupported type
-			err := errors.New("error unmarshalling Data object: unsupported type")
+	var data Data
+	if e.Type != "" {
+		data, err = DecodeData(e.Type, e.Data)
+		if err != nil {
 			return err
 		}
 	}
 
-	m.Command = command
-	m.From = newPeer
-	m.Data = dataStruct
+	m.From = e.From
+	m.Command = e.Command
+	m.Data = data
 
 	return nil
 }
 
-// TODO: Lot's of duplicate code here.
-// Create helper functions that can be called and reused in different data cases. Including unmarshalling a transaction, a block, and a chain
+// sentBy returns true if the message was received from the node at the passed address, as seen by the transport that
+// received it, which another node can't choose the way it can choose From. The TCP transport sends every message over
+// a new connection from a port of its own, so a port of 0 means that only the IP address is known, and is compared.
+// A message that wasn't received from the network was sent by nobody
+func (m Message) sentBy(p PeerAddress) bool {
+
+	if m.source == nil || !m.source.IP.Equal(p.Address.IP) {
+		return false
+	}
+
+	return m.source.Port == 0 || m.source.Port == p.Address.Port
+}
@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+
+	messages := []Message{
+		{Command: "PING"},
+		{Command: "MINE", Data: DataBatch{Entries: []Data{Note{Text: "hello"}}}},
+		{Command: "REVEAL", Data: Election{Height: 1, Entries: []ElectionEntry{{Height: 1, Address: alice, Stake: 1}}}},
+		{Command: "REVEAL", Data: ElectionReveal{Height: 1, Address: alice, Secret: "secret"}},
+	}
+
+	for _, m := range messages {
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("%s: %v", m.Command, err)
+		}
+
+		var decoded Message
+		err = json.Unmarshal(encoded, &decoded)
+		if err != nil {
+			t.Errorf("%s: message was refused: %v", m.Command, err)
+			continue
+		}
+
+		if decoded.Command != m.Command || !reflect.DeepEqual(decoded.Data, m.Data) {
+			t.Errorf("%s: decoded %+v, expected %+v", m.Command, decoded, m)
+		}
+	}
+}
+
+func TestMessageRefusesUnexpectedEnvelopes(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		envelope string
+	}{
+		{"no version", `{"command": "PING"}`},
+		{"older version", `{"version": 0, "command": "PING"}`},
+		{"newer version", `{"version": 2, "command": "PING"}`},
+		{"no command", `{"version": 1}`},
+		{"unregistered command", `{"version": 1, "command": "SHUTDOWN"}`},
+		{"data for a command without data", `{"version": 1, "command": "PING", "type": "peerList", "data": {"peers": []}}`},
+		{"no data for a command with data", `{"version": 1, "command": "PEERS"}`},
+		{"data of another command", `{"version": 1, "command": "PEERS", "type": "dataBatch", "data": {"entries": []}}`},
+		{"data of a type that the command doesn't carry", `{"version": 1, "command": "WINNER", "type": "electionReveal", "data": {}}`},
+		{"unregistered data type", `{"version": 1, "command": "PEERS", "type": "peerMap", "data": {}}`},
+		{"malformed data", `{"version": 1, "command": "PEERS", "type": "peerList", "data": {"peers": 1}}`},
+		{"malformed envelope", `{"version": "1", "command": "PING"}`},
+	}
+
+	for _, test := range tests {
+		var m Message
+		err := json.Unmarshal([]byte(test.envelope), &m)
+		if err == nil {
+			t.Errorf("%s: message was accepted", test.name)
+		}
+	}
+}
+
+func TestMessageSentBy(t *testing.T) {
+
+	node := PeerAddress{Address: net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: MIDDLEWARE_PORT}}
+
+	tests := []struct {
+		name   string
+		source *net.UDPAddr
+		sentBy bool
+	}{
+		{"same address", &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: MIDDLEWARE_PORT}, true},
+		{"same address in IPv6 form", &net.UDPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: MIDDLEWARE_PORT}, true},
+		{"other port", &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: MIDDLEWARE_PORT + 1}, false},
+		{"other IP address", &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: MIDDLEWARE_PORT}, false},
+		{"same IP address over TCP", &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1)}, true},
+		{"other IP address over TCP", &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2)}, false},
+		{"not received", nil, false},
+	}
+
+	for _, test := range tests {
+		m := Message{From: node, Command: "BLOCK_ACCEPTED", source: test.source}
+		if m.sentBy(node) != test.sentBy {
+			t.Errorf("%s: expected sent by the node %v", test.name, test.sentBy)
+		}
+	}
+}
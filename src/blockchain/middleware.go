@@ -2,36 +2,60 @@ package blockchain
 
 import (
 	"container/list"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
-	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
-	"reflect"
+	"sort"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
+)
+
+const (
+	// ELECTION_COMMIT_WINDOW is how long the Middleware accepts proof of stake election entries after the first one
+	ELECTION_COMMIT_WINDOW = 10 * time.Second
 
-	"github.com/mroth/weightedrand"
+	// ELECTION_REVEAL_WINDOW is how long peers have to reveal their secrets once election entries are closed
+	ELECTION_REVEAL_WINDOW = 5 * time.Second
+
+	// ELECTION_PRODUCE_WINDOW is how long the leader of an election has to send its block before it misses its slot
+	ELECTION_PRODUCE_WINDOW = 10 * time.Second
 )
 
 // Middleware is the Middleware object
 type Middleware struct {
 	communicationComponent CommunicationComponent
-	transactionQueue       *list.List
+	consensusComponent     ConsensusComponent
+	mempool                *Mempool
 	newTransaction         chan Transaction
 	lotteryPool            []LotteryEntry
+	lotteryClosed          bool
+	electionRound          int
+	election               Election
+	lotteryMutex           *sync.Mutex
+	watcher                *blockWatcher
 	candidateBlockQueue    *list.List
 	blockValidators        int
 	blockValid             bool
 	proofFound             bool
+	blockSize              int
+	ledger                 *Ledger
+	chain                  []Block
+	chainMutex             *sync.Mutex
+	miningStats            map[string][]MiningStats
+	statsMutex             *sync.Mutex
+	server                 *http.Server
+	stop                   chan struct{}
 }
 
-const REWARD_AMOUNT = 5
-
-// example request: curl -X POST -d 'from=jerry&to=bob&amount=10' localhost:8090/newTransaction
+// example request: curl -X POST -d 'from=<address>&to=<address>&amount=10&fee=1&nonce=0&publicKey=<key>&signature=<signature>' localhost:8090/newTransaction
+// example request: curl -X POST -d 'kind=stake&from=<address>&amount=10&fee=1&nonce=0&publicKey=<key>&signature=<signature>' localhost:8090/newTransaction
 
 func (m *Middleware) handleNewTransaction(w http.ResponseWriter, r *http.Request) {
 
@@ -41,8 +65,10 @@ func (m *Middleware) handleNewTransaction(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	kind := r.FormValue("kind")
 	from := r.FormValue("from")
 	to := r.FormValue("to")
+	publicKey := r.FormValue("publicKey")
 	signature := r.FormValue("signature")
 
 	amount, err := strconv.Atoi(r.FormValue("amount"))
@@ -52,22 +78,171 @@ func (m *Middleware) handleNewTransaction(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	nonce, err := strconv.Atoi(r.FormValue("nonce"))
+	if err != nil {
+		http.Error(w, "Invalid transaction: nonce must be a number", http.StatusBadRequest)
+		return
+	}
+
+	// The fee is optional
+	fee := 0
+	if r.FormValue("fee") != "" {
+		fee, err = strconv.Atoi(r.FormValue("fee"))
+		if err != nil {
+			http.Error(w, "Invalid transaction: fee must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Transform into a Transaction struct
-	newTransaction := Transaction{From: from, To: to, Amount: amount, Signature: signature}
+	newTransaction := Transaction{Kind: kind, From: from, To: to, Amount: amount, Nonce: nonce, Fee: fee, PublicKey: publicKey, Signature: signature}
 
-	// Add it the the queue of transactions to be sent out
-	m.transactionQueue.PushBack(newTransaction)
+	// Refuse transactions that no peer would accept in a block, otherwise add it the the queue of transactions to be sent out
+	err = m.SubmitData(newTransaction)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid transaction: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// Notify the client that the transaction was successfully processed
 	fmt.Fprintf(w, "Transaction processed succesfully!\n\n")
 
 }
 
-// NewMiddleware creates and returns a new Middleware
-func NewMiddleware(com CommunicationComponent, udpPort int, serverPort int) (Middleware, error) {
+// example request: curl localhost:8090/nonce?address=<address>
+
+func (m *Middleware) handleNonce(w http.ResponseWriter, r *http.Request) {
+
+	address := r.URL.Query().Get("address")
+	if !ValidAddress(address) {
+		http.Error(w, "address is not a wallet address", http.StatusBadRequest)
+		return
+	}
+
+	// Respond with the nonce that the account's next transaction must carry
+	fmt.Fprintf(w, "%d", m.mempool.NextNonce(address))
+}
+
+// example request: curl localhost:8090/mempool
+
+func (m *Middleware) handleMempool(w http.ResponseWriter, r *http.Request) {
+
+	// Respond with every entry waiting to be mined, in the order they will be mined
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(m.mempool.Entries())
+	if err != nil {
+		log.Printf("Error encoding mempool: %v\n", err)
+	}
+}
+
+// example request: curl localhost:8090/stats?peer=127.0.0.1:10001
+
+func (m *Middleware) handleStats(w http.ResponseWriter, r *http.Request) {
+
+	m.statsMutex.Lock()
+	defer m.statsMutex.Unlock()
+
+	// Respond with the mining sessions of every peer, or only of the requested peer
+	stats := m.miningStats
+	if peer := r.URL.Query().Get("peer"); peer != "" {
+		stats = map[string][]MiningStats{peer: append([]MiningStats{}, m.miningStats[peer]...)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		log.Printf("Error encoding mining statistics: %v\n", err)
+	}
+}
+
+// example request: curl localhost:8090/validators?address=<address>
+
+func (m *Middleware) handleValidators(w http.ResponseWriter, r *http.Request) {
+
+	// Respond with the validator set, or only with the stake of the requested address
+	validators := m.ledger.Validators()
+	if address := r.URL.Query().Get("address"); address != "" {
+		if !ValidAddress(address) {
+			http.Error(w, "address is not a wallet address", http.StatusBadRequest)
+			return
+		}
+		validators = []Validator{m.ledger.Validator(address)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(validators)
+	if err != nil {
+		log.Printf("Error encoding validators: %v\n", err)
+	}
+}
+
+// example request: curl -X POST -d 'type=note&data={"text":"hello"}' localhost:8090/newData
+
+func (m *Middleware) handleNewData(w http.ResponseWriter, r *http.Request) {
+
+	// Receive the tagged payload from client
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("ParseForm() err: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Any payload type that has been registered can be submitted, without the Middleware knowing about it
+	newData, err := DecodeData(r.FormValue("type"), json.RawMessage(r.FormValue("data")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate it and add it the the queue of entries to be sent out
+	err = m.SubmitData(newData)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Notify the client that the payload was successfully processed
+	fmt.Fprintf(w, "Payload processed succesfully!\n\n")
+}
+
+// SubmitData validates a transaction or other payload and admits it to the mempool to be mined, exactly as if it had
+// been submitted over HTTP. See Mempool for the checks a transaction must pass
+func (m *Middleware) SubmitData(d Data) error {
+	return m.mempool.Add(d)
+}
+
+// GetMempool is the retriever method that returns the Middleware's mempool
+func (m *Middleware) GetMempool() *Mempool {
+	return m.mempool
+}
+
+// Register the commands of a mining session that carry no Data
+func init() {
+	RegisterCommand("BLOCK_VALID")
+	RegisterCommand("BLOCK_ACCEPTED")
+	RegisterCommand("CONSENSUS")
+}
+
+// NewMiddleware creates and returns a new Middleware, which batches up to blockSize entries from the passed mempool
+// into each block. If the mempool is nil, one with the default size and expiry is used. The consensus component must
+// be the one the peers use, with the same settings, as the Middleware checks copies of the chain with it
+func NewMiddleware(com CommunicationComponent, consensus ConsensusComponent, udpPort int, serverPort int, blockSize int, mempool *Mempool) (Middleware, error) {
+
+	if blockSize < 1 {
+		return Middleware{}, errors.New("block size must be at least 1")
+	}
 
 	// Define a new Middleware with the passed component value
-	newMiddleware := Middleware{communicationComponent: com}
+	if mempool == nil {
+		mempool = &Mempool{}
+	}
+
+	// Until a peer sends its copy of the chain, the account state is that of the network's genesis block
+	genesis := NetworkGenesis().Block()
+	ledger := NewLedger()
+	ledger.ApplyBlock(genesis)
+
+	// Define a new Middleware with the passed component value
+	newMiddleware := Middleware{communicationComponent: com, consensusComponent: consensus, blockSize: blockSize, mempool: mempool, ledger: ledger, chain: []Block{genesis}, lotteryMutex: &sync.Mutex{}, watcher: newBlockWatcher(), chainMutex: &sync.Mutex{}, miningStats: make(map[string][]MiningStats), statsMutex: &sync.Mutex{}, stop: make(chan struct{})}
 
 	// Initialize the Middleware
 	err := newMiddleware.Initialize(udpPort, serverPort)
@@ -83,15 +258,22 @@ func NewMiddleware(com CommunicationComponent, udpPort int, serverPort int) (Mid
 // initializing its components and serving itself on the network
 func (m *Middleware) Initialize(udpPort int, serverPort int) error {
 
+	// The consensus component only checks chains, but its settings must still be valid
+	err := m.consensusComponent.Initialize()
+	if err != nil {
+		fmt.Printf("Error initializing consensus component: %+v\n", err)
+		return err
+	}
+
 	// Intialize communication component
-	err := m.communicationComponent.InitializeWithPort(udpPort)
+	err = m.communicationComponent.InitializeWithPort(udpPort)
 	if err != nil {
 		fmt.Printf("Error initializing communication component: %+v\n", err)
 		return err
 	}
 
-	// Initialize Transaction queue
-	m.transactionQueue = list.New()
+	// Initialize the mempool, which admits entries against the chain's account state
+	m.mempool.initialize(m.ledger)
 
 	// Initialize Transaction channel
 	m.newTransaction = make(chan Transaction)
@@ -108,11 +290,30 @@ func (m *Middleware) Initialize(udpPort int, serverPort int) error {
 	// Initialize valid block boolean to false
 	m.blockValid = false
 
+	// Each Middleware has its own request handlers, so that more than one can be created in a process
+	mux := http.NewServeMux()
+
 	// Initialize newTransaction request handler
-	http.HandleFunc("/newTransaction", m.handleNewTransaction)
+	mux.HandleFunc("/newTransaction", m.handleNewTransaction)
+
+	// Initialize newData request handler
+	mux.HandleFunc("/newData", m.handleNewData)
+
+	// Initialize nonce request handler
+	mux.HandleFunc("/nonce", m.handleNonce)
+
+	// Initialize mempool request handler
+	mux.HandleFunc("/mempool", m.handleMempool)
+
+	// Initialize mining statistics request handler
+	mux.HandleFunc("/stats", m.handleStats)
+
+	// Initialize validator set request handler
+	mux.HandleFunc("/validators", m.handleValidators)
 
 	// Serve the http server
-	go http.ListenAndServe(fmt.Sprintf(":%d", serverPort), nil)
+	m.server = &http.Server{Addr: fmt.Sprintf(":%d", serverPort), Handler: mux}
+	go m.server.ListenAndServe()
 
 	return nil
 }
@@ -124,13 +325,17 @@ func (m *Middleware) Run() {
 	//When Run() concludes, terminate() will be called to clean up the different Blockchain components
 	defer m.terminate()
 
-	// Sets done equal to true if the user exits the program with ctrl+c, which will case the loop to finish and Run() to exit,
-	// which will cause terminate() to run
-	c := make(chan os.Signal)
+	// Sets done equal to true if the user exits the program with ctrl+c or Stop() is called, which will case the loop to
+	// finish and Run() to exit, which will cause terminate() to run
+	c := make(chan os.Signal, 1)
 	done := false
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
+		select {
+		case <-c:
+		case <-m.stop:
+		}
+		signal.Stop(c)
 		done = true
 	}()
 
@@ -165,11 +370,29 @@ func (m *Middleware) Run() {
 			switch peerMsg.Command {
 			case "PING":
 				log.Printf("Recieved a ping from %s\n", peerMsg.From.String())
-			case "GET_CHAIN", "PEER_CHAIN", "PUBLIC_KEYS":
+			case "PEER_CHAIN":
+				// The Middleware follows the chain with the most work to know which entries were mined and what every account can spend
+				go m.handlePeerChain(peerMsg.Data.(Chain).ChainCopy, peerMsg.From)
+			case "GET_CHAIN", "GET_HEADERS", "PEER_HEADERS", "GET_MERKLE_PROOF", "MERKLE_PROOF":
 				// Ignore, this is only a peer-relevant command but since Middleware is a part of the network it will get the messages
 			case "PROOF":
 				go func() {
+					// The block was mined by the peer that sent it
 					candidateBlock := peerMsg.Data.(CandidateBlock)
+					candidateBlock.Miner = peerMsg.From
+
+					// A producer that signs two blocks at the same height is slashed, whichever of them is accepted
+					evidence, conflict := m.watcher.observe(candidateBlock.Block.BlockHeader)
+					if conflict {
+						log.Printf("%s signed two blocks at height %d, submitting evidence...\n", evidence.Offender(), evidence.Height())
+						m.submitEvidence(evidence)
+					}
+
+					if !m.isElected(candidateBlock.Block) {
+						log.Printf("Ignoring proof from %s, which wasn't elected to produce the block\n", peerMsg.From.String())
+						return
+					}
+
 					// We push every candidate block we receive on the queue
 					// in case the initial proof fails validation
 					m.candidateBlockQueue.PushBack(candidateBlock)
@@ -190,29 +413,71 @@ func (m *Middleware) Run() {
 					}
 				}()
 
+			case "MINING_STATS":
+				go m.recordMiningStats(peerMsg.Data.(MiningStats), peerMsg.From)
+
 			case "STAKE":
 				go func() {
 
+					// The stake belongs to the peer that sent it
 					newLotteryEntry := peerMsg.Data.(LotteryEntry)
+					newLotteryEntry.Peer = peerMsg.From
+
+					first, err := m.addLotteryEntry(newLotteryEntry)
+					if err != nil {
+						log.Printf("Ignoring lottery entry from %s: %v\n", peerMsg.From.String(), err)
+						return
+					}
 
-					if len(m.lotteryPool) == 0 {
-						log.Println("Running lottery in 10 seconds...")
-						time.AfterFunc(10*time.Second, func() {
-							err := m.runLottery()
+					log.Printf("Received lottery entry: %+v\n", newLotteryEntry)
+
+					if first {
+						log.Printf("Closing lottery entries in %v...\n", ELECTION_COMMIT_WINDOW)
+						time.AfterFunc(ELECTION_COMMIT_WINDOW, func() {
+							err := m.closeLotteryEntries()
 							if err != nil {
-								// This would be a fatal error because if we cannot run the lottery
-								// then no new transactions are going to be mined
-								log.Printf("Fatal error running lottery: %v\n", err)
+								// This would be a fatal error because if the peers can't reveal their secrets
+								// then the lottery can't be run
+								log.Printf("Fatal error closing lottery entries: %v\n", err)
 								done = true
+								return
 							}
 
+							log.Printf("Running lottery in %v...\n", ELECTION_REVEAL_WINDOW)
+							time.AfterFunc(ELECTION_REVEAL_WINDOW, func() {
+								err := m.runLottery()
+								if err != nil {
+									// This would be a fatal error because if we cannot run the lottery
+									// then no new transactions are going to be mined
+									log.Printf("Fatal error running lottery: %v\n", err)
+									done = true
+								}
+							})
 						})
 					}
-					log.Printf("Received lottery entry: %+v\n", newLotteryEntry)
+				}()
 
-					m.lotteryPool = append(m.lotteryPool, newLotteryEntry)
+			case "REVEAL":
+				go func() {
+					reveal, ok := peerMsg.Data.(ElectionReveal)
+					if !ok {
+						log.Printf("Ignoring election from %s, which only the Middleware sends\n", peerMsg.From.String())
+						return
+					}
+
+					err := m.revealLotteryEntry(reveal, peerMsg.From)
+					if err != nil {
+						log.Printf("Ignoring election secret from %s: %v\n", peerMsg.From.String(), err)
+						return
+					}
+
+					log.Printf("Received election secret of %s\n", reveal.Address)
 				}()
 
+			case "EVIDENCE":
+				// Any peer can submit evidence of a validator's offence, which is checked like any other payload
+				go m.submitEvidence(peerMsg.Data.(SlashingEvidence))
+
 			case "BLOCK_VALID":
 				go func() {
 
@@ -227,14 +492,14 @@ func (m *Middleware) Run() {
 			time.Sleep(5 * time.Millisecond)
 		}
 
-		// If we aren't already in a mining session and there is at least one transaction to be mined, pop a transaction
-		// from the queue and broacast to network, starting a new mining session
-		if !peersMining && m.transactionQueue.Len() > 0 && len(m.communicationComponent.GetPeerNodes()) > 0 {
+		// If we aren't already in a mining session and there is at least one transaction to be mined, pop a batch of
+		// transactions from the mempool and broacast to network, starting a new mining session
+		if !peersMining && m.mempool.Len() > 0 && len(m.communicationComponent.GetPeerNodes()) > 0 {
 
 			log.Println("Beginning a new mining session...")
 
-			// Pop a Message from the transactionQueue
-			toMine := m.popTransaction()
+			// Pop a batch of up to blockSize entries from the mempool, highest fee first
+			toMine := m.mempool.PopBatch(m.blockSize)
 
 			toSend, err := m.communicationComponent.GenerateMessage("MINE", toMine)
 			if err != nil {
@@ -261,29 +526,14 @@ func (m *Middleware) Run() {
 
 			go func() {
 
-				// If the lottery pool isn't empty, that means the network is using Proof of Stake,
-				// so return the peers' stakes that they sent for the lottery
-				if len(m.lotteryPool) > 0 {
-					for _, entry := range m.lotteryPool {
-
-						toSend, err := m.communicationComponent.GenerateMessage("STAKE", entry)
-						if err != nil {
-							// This would be a fatal error
-							log.Printf("Fatal error generating message: %v\n", err)
-							done = true
-						}
-
-						err = m.communicationComponent.SendMsgToPeer(toSend, entry.Peer)
-						if err != nil {
-							// This would be a fatal error
-							log.Printf("Error sending message to peer: %v", err)
-							done = true
-						}
-
-					}
-					// Reset the state
-					m.lotteryPool = nil
-				}
+				// If the lottery pool isn't empty, that means the network is using Proof of Stake, so reset the
+				// lottery. Stakes are bonded on the chain, so there is nothing to return
+				m.lotteryMutex.Lock()
+				m.lotteryPool = nil
+				m.lotteryClosed = false
+				m.electionRound = 0
+				m.election = Election{}
+				m.lotteryMutex.Unlock()
 
 				// Else if proofFound, conclude the current mining session by broadcasting a CONSENSUS message to the peers
 				// to halt mining and cause consensus to be run so every peer gets a copy of the new longest chain
@@ -316,6 +566,9 @@ func (m *Middleware) Run() {
 				m.blockValid = false
 				m.candidateBlockQueue.Init()
 
+				// Entries whose block didn't make it onto the chain are mined again in the next session
+				m.mempool.EndMining()
+
 				log.Println("Mining session concluded.")
 
 			}()
@@ -338,6 +591,16 @@ func (m *Middleware) Run() {
 	}
 }
 
+// Stop makes Run() return and clean up the Middleware's components, as if the program had been exited with ctrl+c
+func (m *Middleware) Stop() {
+	select {
+	case <-m.stop:
+		// Already stopped
+	default:
+		close(m.stop)
+	}
+}
+
 // terminate calls all of the interface-defined component clean-up methods
 func (m Middleware) terminate() {
 
@@ -345,22 +608,50 @@ func (m Middleware) terminate() {
 
 	m.communicationComponent.Terminate()
 
+	err := m.server.Close()
+	if err != nil {
+		log.Printf("Error closing http server: %v\n", err)
+	}
+
 	fmt.Println("Exiting Middleware...")
 }
 
-// Pops a message of the Middleware's transactionQueue and returns it
-func (m *Middleware) popTransaction() Transaction {
+// handlePeerChain replaces the Middleware's account state with a received chain if the consensus component prefers it
+// over the chain the state was built from, and it is valid. The chain is checked just as a peer checks it, including
+// its proofs, signatures and genesis block, so a forged chain can't change which entries the Middleware admits
+func (m *Middleware) handlePeerChain(chain []Block, from PeerAddress) {
 
-	// Get element from the front of the list
-	poppedElement := m.transactionQueue.Front()
+	// Copies of the chain arrive from every peer at once, so they are handled one at a time
+	m.chainMutex.Lock()
+	defer m.chainMutex.Unlock()
 
-	// Remove the element, essentially "popping" it
-	m.transactionQueue.Remove(poppedElement)
+	if !m.consensusComponent.PreferChain(m.chain, chain) {
+		return
+	}
 
-	//Convert the popped element, which is of type *Element, to *Message
-	toMine := poppedElement.Value.(Transaction)
+	err := ValidateChain(chain, m.consensusComponent, &Client{})
+	if err != nil {
+		log.Printf("Ignoring invalid copy of the chain from %s: %v\n", from.String(), err)
+		return
+	}
 
-	return toMine
+	m.ledger.Replay(chain)
+	m.chain = chain
+
+	// Drop the entries that were mined, and those that no longer fit onto the chain
+	m.mempool.Update(chain)
+}
+
+// recordMiningStats adds the statistics of a peer's mining session to that peer's history
+func (m *Middleware) recordMiningStats(stats MiningStats, from PeerAddress) {
+
+	m.statsMutex.Lock()
+	defer m.statsMutex.Unlock()
+
+	peer := from.String()
+	m.miningStats[peer] = appendMiningStats(m.miningStats[peer], stats)
+
+	log.Printf("Mining session of %s: %s\n", peer, stats.String())
 }
 
 // Pops a message of the Middleware's transactionQueue and returns it
@@ -378,30 +669,209 @@ func (m *Middleware) popCandidateBlock() CandidateBlock {
 	return toMine
 }
 
-// Picks the winner of the proof of stake lottery and sends them the transaction data to mine
+// addLotteryEntry checks a peer's signed election entry and adds it to the lottery pool. Every entry must be for the
+// same block as the first one, and must stake what the validator set allows. Returns true if the entry is the first
+// of a new lottery
+func (m *Middleware) addLotteryEntry(entry LotteryEntry) (bool, error) {
+
+	m.lotteryMutex.Lock()
+	defer m.lotteryMutex.Unlock()
+
+	if m.lotteryClosed {
+		return false, errors.New("lottery entries are closed")
+	}
+
+	err := VerifyElectionEntry(entry.Entry)
+	if err != nil {
+		return false, err
+	}
+
+	if entry.Entry.Stake < 1 {
+		return false, errors.New("stake must be at least 1")
+	}
+
+	err = m.ledger.CheckElectionStake(entry.Entry)
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range m.lotteryPool {
+		if e.Entry.Height != entry.Entry.Height || e.Entry.PrevHash != entry.Entry.PrevHash {
+			return false, errors.New("entry is for another block than the lottery being held")
+		}
+		if e.Entry.Address == entry.Entry.Address {
+			return false, errors.New("address has already entered the lottery")
+		}
+	}
+
+	// Secrets are only accepted once every entry is in
+	entry.Entry.Secret = ""
+	m.lotteryPool = append(m.lotteryPool, entry)
+
+	return len(m.lotteryPool) == 1, nil
+}
+
+// closeLotteryEntries stops accepting lottery entries and broadcasts the election's entries, so that the peers that
+// entered reveal their secrets
+func (m *Middleware) closeLotteryEntries() error {
+
+	m.lotteryMutex.Lock()
+	m.lotteryClosed = true
+	election := m.lotteryElection(false)
+	m.lotteryMutex.Unlock()
+
+	log.Printf("Lottery entries closed with %d entries, waiting for secrets...\n", len(election.Entries))
+
+	toSend, err := m.communicationComponent.GenerateMessage("REVEAL", election)
+	if err != nil {
+		log.Printf("Error generating message: %v\n", err)
+		return err
+	}
+
+	err = m.communicationComponent.BroadcastMsgToNetwork(toSend)
+	if err != nil {
+		log.Printf("Error broadcasting message: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// revealLotteryEntry records the secret of the lottery entry of the peer that sent it, if it matches the entry's commitment
+func (m *Middleware) revealLotteryEntry(reveal ElectionReveal, from PeerAddress) error {
+
+	m.lotteryMutex.Lock()
+	defer m.lotteryMutex.Unlock()
+
+	for i, e := range m.lotteryPool {
+		if e.Entry.Address != reveal.Address || e.Peer.String() != from.String() {
+			continue
+		}
+
+		if e.Entry.Height != reveal.Height || ElectionCommitment(reveal.Secret) != e.Entry.Commitment {
+			return errors.New("secret does not match the commitment of the entry")
+		}
+
+		m.lotteryPool[i].Entry.Secret = reveal.Secret
+		return nil
+	}
+
+	return errors.New("peer has no entry in the lottery")
+}
+
+// lotteryElection returns the election held among the entries of the lottery pool, in order of address. If revealed
+// is true, only the entries whose secrets were revealed are included, along with an absent entry for every other
+// validator, otherwise secrets are left out. The lottery mutex must be held
+func (m *Middleware) lotteryElection(revealed bool) Election {
+
+	election := Election{Round: m.electionRound, Entries: []ElectionEntry{}}
+
+	entered := make(map[string]bool)
+	for _, e := range m.lotteryPool {
+		entry := e.Entry
+		if revealed && entry.Secret == "" {
+			continue
+		}
+		if !revealed {
+			entry.Secret = ""
+		}
+
+		election.Height = entry.Height
+		election.PrevHash = entry.PrevHash
+		election.Entries = append(election.Entries, entry)
+		entered[entry.Address] = true
+	}
+
+	// Peers reject an election that leaves out any validator, so the ones that can't be elected are recorded as absent
+	if revealed && len(election.Entries) > 0 {
+		for _, v := range m.ledger.Validators() {
+			if !entered[v.Address] {
+				election.Entries = append(election.Entries, ElectionEntry{Height: election.Height, PrevHash: election.PrevHash, Address: v.Address, Stake: v.Stake})
+			}
+		}
+	}
+
+	sort.Slice(election.Entries, func(i, j int) bool { return election.Entries[i].Address < election.Entries[j].Address })
+
+	return election
+}
+
+// Runs the proof of stake election among the lottery entries whose secrets were revealed, and sends the election to
+// the winner so that it can produce the block. Every peer checks the election again when it validates the block, so
+// the Middleware can't choose the winner
 func (m *Middleware) runLottery() error {
 
 	log.Println("Running lottery...")
 
-	entries := []weightedrand.Choice{}
+	m.lotteryMutex.Lock()
+	election := m.lotteryElection(true)
+	m.lotteryMutex.Unlock()
+
+	if len(election.Entries) == 0 {
+		return errors.New("no lottery entries had their secrets revealed")
+	}
 
-	for _, entry := range m.lotteryPool {
-		newChoice := weightedrand.NewChoice(entry.Peer, uint(entry.Stake))
-		entries = append(entries, newChoice)
+	err := ValidatePayload(election)
+	if err != nil {
+		return err
 	}
 
-	rand.Seed(time.Now().UTC().UnixNano())
+	// Peers reject an election that reveals too little of the bonded stake, so there is no point in electing a leader
+	err = m.ledger.CheckElection(Block{BlockHeader: BlockHeader{Index: election.Height}, Data: []Data{election}})
+	if err != nil {
+		log.Printf("The block can't be produced: %v\n", err)
+		return nil
+	}
 
-	c, err := weightedrand.NewChooser(entries...)
+	leader, err := election.Leader()
 	if err != nil {
 		log.Printf("Error choosing lottery winner: %+v\n", err)
 		return err
 	}
 
-	lotteryWinner := c.Pick().(PeerAddress)
-	log.Printf("Lottery winner: %+v\n", lotteryWinner)
+	m.lotteryMutex.Lock()
+	var lotteryWinner PeerAddress
+	for _, e := range m.lotteryPool {
+		if e.Entry.Address == leader {
+			lotteryWinner = e.Peer
+		}
+	}
+	m.lotteryMutex.Unlock()
+
+	log.Printf("Lottery winner of round %d: %s (%+v)\n", election.Round, leader, lotteryWinner)
+
+	m.lotteryMutex.Lock()
+	m.election = election
+	m.lotteryMutex.Unlock()
 
-	toSend, err := m.communicationComponent.GenerateMessage("WINNER", nil)
+	// If the leader doesn't send its block in time, it missed its slot, and the next round is held without it
+	time.AfterFunc(ELECTION_PRODUCE_WINDOW, func() {
+		m.lotteryMutex.Lock()
+		missed := !m.proofFound && sameElectionRound(m.election, election)
+		pooled := 0
+		if missed {
+			pooled = m.skipLeader()
+		}
+		m.lotteryMutex.Unlock()
+
+		if !missed {
+			return
+		}
+
+		log.Printf("%s didn't produce its block within %v, it missed its slot\n", leader, ELECTION_PRODUCE_WINDOW)
+
+		if pooled == 0 {
+			log.Println("No lottery entries left, the block can't be produced")
+			return
+		}
+
+		err := m.runLottery()
+		if err != nil {
+			log.Printf("Error running lottery: %v\n", err)
+		}
+	})
+
+	toSend, err := m.communicationComponent.GenerateMessage("WINNER", election)
 	if err != nil {
 		log.Printf("Eror generating message: %v\n", err)
 		return err
@@ -418,8 +888,9 @@ func (m *Middleware) runLottery() error {
 }
 
 // Checks if the candidate block got enough validation from the network. If not,
-// applies penalty to the malicious peer who submitted the block and restarts the
-// process with the next candidate block in the queue
+// restarts the process with the next candidate block in the queue, or for proof of stake
+// with the next round of the election. A proof of stake leader whose block was rejected
+// missed its slot, and is slashed by the block of the later round
 func (m *Middleware) runValidation() (err error) {
 
 	m.blockValidators = 0
@@ -448,13 +919,10 @@ func (m *Middleware) runValidation() (err error) {
 		//If the block got enough validation (At least 50% of the network)
 		if m.blockValidators >= int(math.Round(float64(len(m.communicationComponent.GetPeerNodes()))/2.0)) {
 			log.Println("Validation successful. Ending current mining session...")
-			// Send a reward to the successful miner, which will tell them to add the mined block to their chain,
-			// which will become the new global chain once consensus is run
-			// fmt.Printf("DEBUG - from: '%+v', to: '%+v'\n", m.communicationComponent.GetSelfAddress().String(), candidateBlock.Miner.String())
-
-			newData := Transaction{From: m.communicationComponent.GetSelfAddress().String(), To: candidateBlock.Miner.String(), Amount: REWARD_AMOUNT}
-
-			toSend, msg_err := m.communicationComponent.GenerateMessage("TRANSACTION", newData)
+			// Tell the successful miner that its block was accepted, which will tell them to add the mined block to their
+			// chain, which will become the new global chain once consensus is run. The miner's reward is paid by the
+			// block's coinbase
+			toSend, msg_err := m.communicationComponent.GenerateMessage("BLOCK_ACCEPTED", nil)
 			if msg_err != nil {
 				log.Printf("Fatal error generating message: %v\n", err)
 				err = msg_err
@@ -462,27 +930,28 @@ func (m *Middleware) runValidation() (err error) {
 
 			msg_err = m.communicationComponent.SendMsgToPeer(toSend, candidateBlock.Miner)
 			if msg_err != nil {
-				// This would be a fatal error because if a peer doesn't recieve the reward,
+				// This would be a fatal error because if a peer doesn't recieve the message,
 				// it wont add the new block to its chain, and the block will get lost if the next session begins
-				log.Printf("Fatal Error sending reward to peer: %v", err)
+				log.Printf("Fatal Error sending accepted block message to peer: %v", err)
 				err = msg_err
 			}
 
 			m.blockValid = true
 
 		} else {
-			// If the validation is unsuccessful and we're doing PoS (lotteryPool len > 0), then remove the
-			// lottery winner from the lottery pool so they don't receive  a stake refund
+			// If the validation is unsuccessful and we're doing PoS (lotteryPool len > 0), then the
+			// lottery winner missed its slot, see skipLeader
+			m.lotteryMutex.Lock()
+			pooled := 0
 			if len(m.lotteryPool) > 0 {
-				entryIndex := indexOf(candidateBlock.Miner, m.lotteryPool)
-				m.lotteryPool[entryIndex] = m.lotteryPool[len(m.lotteryPool)-1]
-				m.lotteryPool = m.lotteryPool[:len(m.lotteryPool)-1]
+				pooled = m.skipLeader()
 			}
+			m.lotteryMutex.Unlock()
 
 			// We do not call this method again for proof of stake because when we run the lottery again, a new user is gonna send
 			// the proof which is gonna cause this function to be run again anyway. We dont need to re-run ourself,
 			// unlike for proof of work
-			if len(m.lotteryPool) == 0 {
+			if pooled == 0 {
 				// Reattempt validation
 				m.runValidation()
 			} else {
@@ -496,12 +965,54 @@ func (m *Middleware) runValidation() (err error) {
 	return err
 }
 
-func indexOf(entry PeerAddress, entries []LotteryEntry) int {
-	for i, e := range entries {
-		if reflect.DeepEqual(e.Peer, entry) {
-			return i
+// skipLeader records that the leader of the election being held missed its slot and moves on to the next round of
+// the election, which changes its seed and draws without the leaders of the earlier rounds. Returns the number of
+// revealed entries that can still be elected. The lottery mutex must be held
+func (m *Middleware) skipLeader() int {
+
+	m.electionRound++
+
+	revealed := 0
+	for _, e := range m.lotteryPool {
+		if e.Entry.Secret != "" {
+			revealed++
 		}
 	}
-	// Return -1 if not find
-	return -1
+
+	if revealed < m.electionRound {
+		return 0
+	}
+	return revealed - m.electionRound
+}
+
+// isElected returns true if the candidate block was produced by the leader of the election being held. Proof of work
+// holds no elections, so any peer may produce the block
+func (m *Middleware) isElected(b Block) bool {
+
+	m.lotteryMutex.Lock()
+	defer m.lotteryMutex.Unlock()
+
+	if len(m.election.Entries) == 0 {
+		return true
+	}
+
+	leader, err := m.election.Leader()
+	return err == nil && b.Miner == leader
+}
+
+// submitEvidence admits evidence of a validator's offence to the mempool, so that it is recorded in the next block
+func (m *Middleware) submitEvidence(e SlashingEvidence) {
+
+	err := m.SubmitData(e)
+	if err != nil {
+		log.Printf("Ignoring evidence that %s committed %s: %v\n", e.Offender(), e.Offence, err)
+		return
+	}
+
+	log.Printf("Evidence that %s committed %s at height %d was added to the mempool\n", e.Offender(), e.Offence, e.Height())
+}
+
+// sameElectionRound returns true if both elections are the same round of the election of the same block
+func sameElectionRound(a Election, b Election) bool {
+	return a.Height == b.Height && a.PrevHash == b.PrevHash && a.Round == b.Round && len(a.Entries) > 0
 }
@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ============================ Mining Statistics ============================
+
+// MINING_STATS_HISTORY is the number of mining sessions whose statistics are kept, by a Peer for itself and by the
+// Middleware for every Peer
+const MINING_STATS_HISTORY = 100
+
+// MiningStats describes the work done in one proof of work mining session, whether the session found a block or was
+// stopped because another block was accepted first. Elapsed is encoded in JSON as a number of nanoseconds, and
+// HashRate is the number of hashes tried per second
+type MiningStats struct {
+	Height     int           `json:"height"`
+	Miner      string        `json:"miner"`
+	Target     string        `json:"target"`
+	Difficulty float64       `json:"difficulty"`
+	Workers    int           `json:"workers"`
+	Started    time.Time     `json:"started"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Hashes     int64         `json:"hashes"`
+	HashRate   float64       `json:"hashRate"`
+	Found      bool          `json:"found"`
+	Nonce      int           `json:"nonce"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (s MiningStats) GetData() Data {
+	return s
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (s MiningStats) GetType() string {
+	return "miningStats"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (s MiningStats) ToString() string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and the commands whose messages carry it
+func init() {
+	RegisterDataType(MiningStats{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var s MiningStats
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	})
+
+	RegisterCommand("MINING_STATS", MiningStats{}.GetType())
+}
+
+// String describes the session for people
+func (s MiningStats) String() string {
+
+	outcome := "stopped"
+	if s.Found {
+		outcome = fmt.Sprintf("found nonce %d", s.Nonce)
+	}
+
+	return fmt.Sprintf("height=%d, difficulty=%.0f, hashes=%d, elapsed=%v, rate=%s, workers=%d, %s",
+		s.Height, s.Difficulty, s.Hashes, s.Elapsed.Round(time.Microsecond), FormatHashRate(s.HashRate), s.Workers, outcome)
+}
+
+// FormatHashRate writes a number of hashes per second with a unit that keeps it short, such as 2.41 MH/s
+func FormatHashRate(rate float64) string {
+
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s"}
+	unit := 0
+	for rate >= 1000 && unit < len(units)-1 {
+		rate /= 1000
+		unit++
+	}
+
+	return fmt.Sprintf("%.2f %s", rate, units[unit])
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// appendMiningStats adds a session to a history, dropping the oldest sessions once it holds MINING_STATS_HISTORY
+func appendMiningStats(history []MiningStats, s MiningStats) []MiningStats {
+
+	history = append(history, s)
+	if len(history) > MINING_STATS_HISTORY {
+		history = history[len(history)-MINING_STATS_HISTORY:]
+	}
+
+	return history
+}
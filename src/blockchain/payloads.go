@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ============================ Payloads ============================
+// Data types that aren't currency transfers, but can be mined into blocks alongside transactions
+
+// MAX_NOTE_LENGTH is the longest text that a Note can carry
+const MAX_NOTE_LENGTH = 280
+
+// =========== Notarization ===========
+
+// Notarization records the SHA-256 hash of a document on the chain. The timestamp of the block that holds it
+// proves that the document existed at that time, without publishing the document itself
+type Notarization struct {
+	DocumentHash string `json:"documentHash"`
+	Description  string `json:"description"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (n Notarization) GetData() Data {
+	return n
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (n Notarization) GetType() string {
+	return "notarization"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (n Notarization) ToString() string {
+	b, err := json.Marshal(n)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and allow it to be carried in blocks
+func init() {
+	RegisterDataType(Notarization{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var n Notarization
+		err := json.Unmarshal(raw, &n)
+		return n, err
+	})
+
+	RegisterPayloadType(Notarization{}.GetType(), func(d Data) error {
+		hash, err := hex.DecodeString(d.(Notarization).DocumentHash)
+		if err != nil || len(hash) != 32 {
+			return errors.New("document hash must be a hex encoded SHA-256 hash")
+		}
+		return nil
+	}, canonicalNotarization)
+}
+
+// =========== Note ===========
+
+// Note is a short public text message recorded on the chain
+type Note struct {
+	Text string `json:"text"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (n Note) GetData() Data {
+	return n
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (n Note) GetType() string {
+	return "note"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (n Note) ToString() string {
+	b, err := json.Marshal(n)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object, and allow it to be carried in blocks
+func init() {
+	RegisterDataType(Note{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var n Note
+		err := json.Unmarshal(raw, &n)
+		return n, err
+	})
+
+	RegisterPayloadType(Note{}.GetType(), func(d Data) error {
+		text := d.(Note).Text
+		if text == "" || len(text) > MAX_NOTE_LENGTH {
+			return fmt.Errorf("note text must be between 1 and %d characters", MAX_NOTE_LENGTH)
+		}
+		return nil
+	}, canonicalNote)
+}
@@ -1,30 +1,60 @@
 package blockchain
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
 // ============================ Peer ============================
 
-// Peer is the Peer object
+// GENESIS_HASH is the hash of every genesis block, which is created locally by each Peer rather than mined
+const GENESIS_HASH = "0"
+
+// Peer is the Peer object. Messages are handled on their own goroutines, so the chain, the headers of a light client,
+// the ledger, storage and the outstanding inclusion proof requests are only changed while holding chainMutex, and the
+// chain is read through GetChain
 type Peer struct {
 	communicationComponent CommunicationComponent
 	consensusComponent     ConsensusComponent
 	clientComponent        ClientComponent
+	storageComponent       StorageComponent
 	chain                  []Block
-	wallet                 int
+	ledger                 *Ledger
+	lightClient            bool
+	headers                []BlockHeader
+	proofRequests          map[proofRequest]bool
+	chainMutex             *sync.Mutex
+	tip                    *chainTip
+	stop                   chan struct{}
+	stopOnce               *sync.Once
+}
+
+// chainTip hands out contexts that are cancelled as soon as the tip of a Peer's chain changes, so that work that
+// builds on the tip, such as mining, can stop right away
+type chainTip struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.Mutex
 }
 
-//ConsensusComponent standardizes methods for any Peer consensus component
+//ConsensusComponent standardizes methods for any Peer consensus component. PreferChain is the fork choice rule,
+// which decides whether a received copy of the chain should replace the current one. Light clients only pass it
+// blocks without data, see headerBlocks
 type ConsensusComponent interface {
-	ValidateBlock(b Block) bool
+	ValidateBlock(b Block, prev []BlockHeader) bool
+	PreferChain(current []Block, candidate []Block) bool
+	CalculateHash(b Block) string
 	HandleCommand(msg Message, p *Peer) error
 	GetCandidateBlock() Block
+	GetRewardSchedule() RewardSchedule
+	GetMiningStats() []MiningStats
 	Initialize() error
 	Terminate()
 }
@@ -50,16 +80,54 @@ type CommunicationComponent interface {
 type ClientComponent interface {
 	Initialize(com CommunicationComponent, p *Peer) error
 	Terminate()
+	GetAddress() string
+	GetPublicKey() string
 	Verify(t Transaction) bool
 	Sign(t Transaction) (Transaction, error)
+	SignBlock(b Block) (Block, error)
+	SignElectionEntry(e ElectionEntry) (ElectionEntry, error)
 	HandleCommand(msg Message, com CommunicationComponent) (err error)
 }
 
-// NewPeer creates and returns a new Peer, with the Genesis Block and Components initialized
-func NewPeer(c CommunicationComponent, p ConsensusComponent, cl ClientComponent) (Peer, error) {
+// StorageComponent standardizes methods for any Peer storage component
+type StorageComponent interface {
+	Initialize() error
+	Terminate()
+	LoadChain() ([]Block, error)
+	AppendBlock(b Block) error
+	ReplaceChain(chain []Block) error
+}
+
+// Register the commands that ask a full peer for its chain, which carry no Data
+func init() {
+	RegisterCommand("GET_CHAIN")
+	RegisterCommand("GET_HEADERS")
+}
+
+// NewPeer creates and returns a new Peer, with its chain loaded from storage (or the Genesis Block) and Components initialized.
+// The components are handed the returned Peer, so it must be run and used through the returned pointer rather than a copy
+func NewPeer(c CommunicationComponent, p ConsensusComponent, cl ClientComponent, s StorageComponent) (*Peer, error) {
+	return newPeer(c, p, cl, s, false)
+}
+
+// NewLightPeer creates and returns a new light client Peer, which stores only block headers and checks that
+// transactions are on the chain using Merkle proofs served by full peers. Light clients keep their headers in memory.
+// Only proof of work is supported, as a proof of stake header can't be checked without the election in its block
+func NewLightPeer(c CommunicationComponent, p ConsensusComponent, cl ClientComponent) (*Peer, error) {
+
+	switch p.(type) {
+	case *ProofOfStake:
+		return nil, errors.New("light clients don't support proof of stake")
+	}
+
+	return newPeer(c, p, cl, nil, true)
+}
+
+// newPeer creates and initializes a new Peer in either full or light client mode
+func newPeer(c CommunicationComponent, p ConsensusComponent, cl ClientComponent, s StorageComponent, lightClient bool) (*Peer, error) {
 
 	// Define a new Peer with the passed componenet values
-	newPeer := Peer{communicationComponent: c, consensusComponent: p, clientComponent: cl}
+	newPeer := &Peer{communicationComponent: c, consensusComponent: p, clientComponent: cl, storageComponent: s, ledger: NewLedger(), lightClient: lightClient, proofRequests: make(map[proofRequest]bool), chainMutex: &sync.Mutex{}, tip: newChainTip(), stop: make(chan struct{}), stopOnce: &sync.Once{}}
 
 	// Initialize the Peer
 	err := newPeer.initialize()
@@ -68,7 +136,7 @@ func NewPeer(c CommunicationComponent, p ConsensusComponent, cl ClientComponent)
 	if err != nil {
 		fmt.Printf("Error initializing Peer peer: %+v\n", err)
 		newPeer.terminate()
-		return Peer{}, err
+		return nil, err
 	}
 
 	return newPeer, nil
@@ -95,23 +163,23 @@ func (p *Peer) initialize() error {
 		return err
 	}
 
-	p.wallet = 10
-
 	return nil
 }
 
-// createGenesisBlock initializes and adds a genesis block to the Peer
+// createGenesisBlock initializes and adds the genesis block of the network's Genesis to the Peer
 func (p *Peer) createGenesisBlock() {
 
-	genesisBlock := Block{}
-	genesisBlock.Index = 0
-	genesisBlock.Timestamp = time.Now().String()
-	genesisBlock.Data = Transaction{}
-	genesisBlock.PrevHash = ""
-	genesisBlock.Nonce = 0
-	genesisBlock.Hash = "0"
+	genesisBlock := NetworkGenesis().Block()
+
+	// A light client only ever keeps the header
+	if p.lightClient {
+		p.chainMutex.Lock()
+		p.headers = append(p.headers, genesisBlock.BlockHeader)
+		p.chainMutex.Unlock()
+		return
+	}
 
-	p.chain = append(p.chain, genesisBlock)
+	p.appendBlock(genesisBlock)
 }
 
 // Run utilizes the Peer components to run this Peer peer by sending/recieving
@@ -121,14 +189,17 @@ func (p *Peer) Run() {
 	//When Run() concludes, terminate() will be called to clean up the different Peer components
 	defer p.terminate()
 
-	// Sets done equal to true if the user exits the program with ctrl+c, which will case the loop to finish and Run() to exit,
+	// Calls Stop() if the user exits the program with ctrl+c, which will case the loop to finish and Run() to exit,
 	// which will cause terminate() to run
-	c := make(chan os.Signal)
-	done := false
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
-		done = true
+		select {
+		case <-c:
+			p.Stop()
+		case <-p.stop:
+		}
+		signal.Stop(c)
 	}()
 
 	fmt.Println("\nRunning Peer...")
@@ -144,14 +215,14 @@ func (p *Peer) Run() {
 	}()
 	fmt.Println()
 
-	for !done {
+	for !p.stopped() {
 
 		// Get message from peers
 		go func() {
 			err := p.communicationComponent.RecieveFromNetwork(true)
 			if err != nil {
 				log.Printf("Fatal Error recieving from network: %+v\n", err)
-				done = true
+				p.Stop()
 			}
 		}()
 
@@ -164,57 +235,113 @@ func (p *Peer) Run() {
 			case "PEER_CHAIN":
 				go func() {
 					peerChain := peerMsg.Data.(Chain).ChainCopy
+
+					// Light clients keep only the headers of the chains that are distributed on the network
+					if p.lightClient {
+						p.handleHeaders(headersOf(peerChain), peerMsg.From)
+						return
+					}
+
 					// fmt.Printf("\n\nDEBUG - Chain before consensus: %+v\n\n\n", p.chain)
-					// If the received chain is longer than the current chain, use the received chain as this peer's new chain copy, and broadcast our copy again
-					if len(peerChain) > len(p.chain) {
-						p.chain = peerChain
-						log.Println("Recieved a longer copy of the chain, setting it as new local copy")
+					// If the consensus component prefers the received chain over the current chain, use the received chain as this peer's new chain copy, and broadcast our copy again
+					if p.consensusComponent.PreferChain(p.GetChain(), peerChain) {
+
+						// Never adopt a chain that we can't verify block by block, as a single malicious peer could otherwise
+						// replace the history of the whole network
+						err := ValidateChain(peerChain, p.consensusComponent, p.clientComponent)
+						if err != nil {
+							log.Printf("Rejected preferred copy of the chain from %s: %v\n", peerMsg.From.String(), err)
+							return
+						}
+
+						// Another copy of the chain may have been adopted while this one was being validated
+						if !p.replaceChain(peerChain) {
+							return
+						}
+						log.Println("Recieved a preferred copy of the chain, setting it as new local copy")
 
 						p.broadcastChainCopy()
 					}
 					// fmt.Printf("\n\nDEBUG - Chain after consensus: %+v\n\n\n", p.chain)
 				}()
 			case "GET_CHAIN":
-				go p.broadcastChainCopy()
+				if !p.lightClient {
+					go p.broadcastChainCopy()
+				}
 
-			case "TRANSACTION":
-				go func() {
+			case "GET_HEADERS":
+				if !p.lightClient {
+					go p.sendHeaders(peerMsg.From)
+				}
 
-					amount := peerMsg.Data.(Transaction).Amount
+			case "PEER_HEADERS":
+				if p.lightClient {
+					go p.handleHeaders(peerMsg.Data.(HeaderChain).Headers, peerMsg.From)
+				}
 
-					// Determine whether this is a transaction from a fellow Peer or a reward from the Middleware
-					if peerMsg.From.String() == p.communicationComponent.GetMiddlewarePeer().String() {
-						// If this peer was the first peer to successfully mine the block, append the candidate block to this peer's Peer
-						// so that other nodes will get the block when consensus occurs
-						p.chain = append(p.chain, p.consensusComponent.GetCandidateBlock())
+			case "GET_MERKLE_PROOF":
+				if !p.lightClient {
+					go p.sendMerkleProof(peerMsg.Data.(MerkleProofRequest), peerMsg.From)
+				}
 
-						log.Println("Recieved a reward, adding amount to wallet and appending new mined block to local chain")
-					} else {
-						sender := peerMsg.Data.(Transaction).From
-						log.Printf("Recieved a transaction from: %v with amount: %d\n", sender, amount)
+			case "MERKLE_PROOF":
+				go p.checkMerkleProof(peerMsg.Data.(MerkleProof))
+
+			case "BLOCK_ACCEPTED":
+				go func() {
 
+					// Only the Middleware decides which candidate block is accepted. The sender is checked by the address
+					// the message arrived from rather than its From, which any node could set to the Middleware's address
+					if !peerMsg.sentBy(p.communicationComponent.GetMiddlewarePeer()) {
+						log.Printf("Ignoring accepted block message from %s, which isn't the Middleware\n", peerMsg.From.String())
+						return
 					}
 
-					// Whether it's a reward or not, add the amount to this Peer's wallet
-					p.wallet += amount
+					// This peer was the first peer to successfully mine the block, so append the candidate block to this peer's
+					// chain so that other nodes will get the block when consensus occurs. Its coinbase pays this peer's reward
+					candidateBlock := p.consensusComponent.GetCandidateBlock()
+					if len(candidateBlock.Data) == 0 {
+						log.Println("Accepted block holds no coinbase, not appending it to local chain")
+						return
+					}
 
-					log.Printf("Updated balance: %d\n", p.wallet)
+					coinbase, ok := candidateBlock.Data[0].(Coinbase)
+					if !ok {
+						log.Println("Accepted block doesn't start with a coinbase, not appending it to local chain")
+						return
+					}
 
+					// The chain may have changed since the block was mined, in which case it no longer extends the chain
+					err := p.appendMinedBlock(candidateBlock)
+					if err != nil {
+						log.Printf("Not appending accepted block to local chain: %v\n", err)
+						return
+					}
+
+					log.Printf("Mined block was accepted with a reward of %d, appending it to local chain\n", coinbase.Amount)
+					log.Printf("Updated balance: %d\n", p.balance())
 				}()
 
 			case "VALIDATE":
 				go func() {
 					candidateBlock := peerMsg.Data.(CandidateBlock).Block
 
-					if candidateBlock.Data.(Transaction).From != p.communicationComponent.GetSelfAddress().String() {
+					if p.lightClient {
+						log.Println("Received candidate block, but light clients don't take part in validation.")
+					} else if !p.hasOwnTransaction(candidateBlock) {
 						// Tell the middleware if the received block is valid or not
 						log.Println("Received candidate block from Middleware, validating...")
 
-						validHash := p.consensusComponent.ValidateBlock(candidateBlock)
-
-						validSignature := p.clientComponent.Verify(candidateBlock.Data.(Transaction))
+						err := p.validateCandidate(candidateBlock)
+						if err != nil {
+							log.Printf("Received candidate block is invalid: %v\n", err)
 
-						if validHash && validSignature {
+							// If the block's producer signed it, what is wrong with it may be enough to slash the producer
+							evidence, evidenceErr := NewInvalidBlockEvidence(candidateBlock)
+							if evidenceErr == nil {
+								p.submitEvidence(evidence)
+							}
+						} else {
 							log.Println("Verified received candidate block is valid")
 							toSend, err := p.communicationComponent.GenerateMessage("BLOCK_VALID", nil)
 							if err != nil {
@@ -227,7 +354,7 @@ func (p *Peer) Run() {
 							}
 						}
 					} else {
-						log.Println("Received candidate block for own transaction, not participating in validation.")
+						log.Println("Received candidate block containing own transaction, not participating in validation.")
 
 					}
 				}()
@@ -237,18 +364,21 @@ func (p *Peer) Run() {
 			default:
 				handled := false
 
-				err := p.consensusComponent.HandleCommand(peerMsg, p)
-				if err != nil {
-					if err.Error() != "command not supported" {
+				// Light clients don't take part in mining, so they never hand commands to the consensus component
+				if !p.lightClient {
+					err := p.consensusComponent.HandleCommand(peerMsg, p)
+					if err != nil {
+						if err.Error() != "command not supported" {
+							handled = true
+							log.Printf("Consensus component had error when handling message: %+v\n", err)
+						}
+					} else {
 						handled = true
-						log.Printf("Consensus component had error when handling message: %+v\n", err)
 					}
-				} else {
-					handled = true
 				}
 
 				if !handled {
-					err = p.clientComponent.HandleCommand(peerMsg, p.communicationComponent)
+					err := p.clientComponent.HandleCommand(peerMsg, p.communicationComponent)
 					if err != nil {
 						if err.Error() != "command not supported" {
 							handled = true
@@ -259,7 +389,8 @@ func (p *Peer) Run() {
 					}
 				}
 
-				if !handled {
+				// Light clients quietly drop the consensus commands that are broadcast to every node
+				if !handled && !p.lightClient {
 					log.Println("Warning: Command \"" + peerMsg.Command + "\" not supported")
 				}
 			}
@@ -285,6 +416,30 @@ func (p *Peer) Run() {
 	}
 }
 
+// Stop makes Run() return and clean up the Peer's components, as if the program had been exited with ctrl+c, which
+// lets many Peers be started and stopped in one process
+func (p *Peer) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// stopped returns true once Stop has been called
+func (p *Peer) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetChain is the retriever method that returns a copy of this Peer's chain
+func (p *Peer) GetChain() []Block {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	return append([]Block{}, p.chain...)
+}
+
 // terminate calls all of the interface-defined component clean-up methods
 func (p *Peer) terminate() {
 	fmt.Println("\nTerminating Peer components...")
@@ -292,6 +447,9 @@ func (p *Peer) terminate() {
 	p.communicationComponent.Terminate()
 	p.consensusComponent.Terminate()
 	p.clientComponent.Terminate()
+	if p.storageComponent != nil {
+		p.storageComponent.Terminate()
+	}
 	fmt.Println("Exiting Blockchain Peer...")
 }
 
@@ -323,16 +481,36 @@ func (p *Peer) initializeComponents() error {
 		return err
 	}
 
+	// Initialize the storage component, which light clients don't have
+	if p.storageComponent != nil {
+		err = p.storageComponent.Initialize()
+
+		// If there was an error initializing the storage component
+		if err != nil {
+			fmt.Printf("Error initializing Peer storage component: %+v", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (p *Peer) initializeChain() error {
 
-	// Create the genesis block in case we are the first peer on the network
-	p.createGenesisBlock()
+	// Load the chain that was stored the last time this Peer ran, or create the genesis block in case
+	// we are the first peer on the network
+	loaded := p.loadStoredChain()
+	if !loaded {
+		p.createGenesisBlock()
+	}
 
-	// Get peer chains in case we are not the first peer on the network
-	toSend, err := p.communicationComponent.GenerateMessage("GET_CHAIN", nil)
+	// Get peer chains in case we are not the first peer on the network. Light clients only need the headers
+	command := "GET_CHAIN"
+	if p.lightClient {
+		command = "GET_HEADERS"
+	}
+
+	toSend, err := p.communicationComponent.GenerateMessage(command, nil)
 	if err != nil {
 		log.Printf("Error generating message: %v\n", err)
 	}
@@ -347,7 +525,7 @@ func (p *Peer) initializeChain() error {
 
 func (p *Peer) broadcastChainCopy() {
 	// Broadcast this peer's copy of the chain so that the new chain can be distributed
-	data := Chain{ChainCopy: p.chain}
+	data := Chain{ChainCopy: p.GetChain()}
 
 	toSend, err := p.communicationComponent.GenerateMessage("PEER_CHAIN", data)
 	if err != nil {
@@ -359,3 +537,195 @@ func (p *Peer) broadcastChainCopy() {
 		log.Printf("Error broadcasting message: %v\n", err)
 	}
 }
+
+// loadStoredChain sets this Peer's chain to the chain in storage and returns true, or returns false if
+// there is no stored chain or it isn't a valid chain
+func (p *Peer) loadStoredChain() bool {
+
+	if p.storageComponent == nil {
+		return false
+	}
+
+	storedChain, err := p.storageComponent.LoadChain()
+	if err != nil {
+		log.Printf("Error loading stored chain: %v\n", err)
+		return false
+	}
+
+	if len(storedChain) == 0 {
+		return false
+	}
+
+	// The stored chain may have been changed on disk, so it is validated just like a chain received from a peer
+	err = ValidateChain(storedChain, p.consensusComponent, p.clientComponent)
+	if err != nil {
+		log.Printf("Discarding stored chain as it is invalid: %v\n", err)
+		return false
+	}
+
+	p.chainMutex.Lock()
+	p.chain = storedChain
+	p.ledger.Replay(storedChain)
+	p.chainMutex.Unlock()
+
+	log.Printf("Loaded stored chain with %d blocks\n", len(storedChain))
+
+	return true
+}
+
+// appendBlock appends a block to this Peer's chain, applies it to the ledger and writes it to storage
+func (p *Peer) appendBlock(b Block) {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	p.addBlock(b)
+}
+
+// appendMinedBlock appends a block that this Peer mined to its chain like appendBlock, but only if the block links to
+// the tip of the chain, and returns an error if it doesn't
+func (p *Peer) appendMinedBlock(b Block) error {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	if len(p.chain) == 0 {
+		return errors.New("this peer holds no chain")
+	}
+
+	tip := p.chain[len(p.chain)-1]
+	if b.Index != tip.Index+1 || b.PrevHash != tip.Hash {
+		return fmt.Errorf("block %d does not link to the tip of the chain at height %d", b.Index, tip.Index)
+	}
+
+	p.addBlock(b)
+
+	return nil
+}
+
+// addBlock appends a block to this Peer's chain, applies it to the ledger and writes it to storage. The chain mutex
+// must be held
+func (p *Peer) addBlock(b Block) {
+
+	p.chain = append(p.chain, b)
+	p.ledger.ApplyBlock(b)
+	p.tip.advance()
+
+	if p.storageComponent != nil {
+		// The genesis block replaces whatever was stored, as it starts a new chain
+		var err error
+		if b.Index == 0 {
+			err = p.storageComponent.ReplaceChain(p.chain)
+		} else {
+			err = p.storageComponent.AppendBlock(b)
+		}
+
+		if err != nil {
+			log.Printf("Error writing block to storage: %v\n", err)
+		}
+	}
+}
+
+// replaceChain replaces this Peer's chain with the passed chain, rebuilds the ledger from it and writes it to storage.
+// The chain is only replaced if the consensus component still prefers it over the current chain, and false is
+// returned if it doesn't
+func (p *Peer) replaceChain(chain []Block) bool {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	if !p.consensusComponent.PreferChain(p.chain, chain) {
+		return false
+	}
+
+	p.chain = chain
+	p.ledger.Replay(chain)
+	p.tip.advance()
+
+	if p.storageComponent != nil {
+		err := p.storageComponent.ReplaceChain(chain)
+		if err != nil {
+			log.Printf("Error writing chain to storage: %v\n", err)
+		}
+	}
+
+	return true
+}
+
+// validateCandidate checks that a candidate block is valid and follows on from this Peer's chain, so that it can't
+// replay an already mined transaction
+func (p *Peer) validateCandidate(b Block) error {
+	p.chainMutex.Lock()
+	defer p.chainMutex.Unlock()
+
+	err := validateLinkedBlock(b, p.chain[len(p.chain)-1], headersOf(p.chain), p.consensusComponent, p.clientComponent)
+	if err != nil {
+		return err
+	}
+
+	return validateBlockState(b, p.ledger)
+}
+
+// tipContext returns a context that is cancelled once the tip of this Peer's chain changes, because a block was
+// appended or the chain was replaced. Consensus components mine under it, so work on a stale tip is abandoned
+func (p *Peer) tipContext() context.Context {
+	return p.tip.context()
+}
+
+// newChainTip returns a chainTip for a chain that hasn't changed yet
+func newChainTip() *chainTip {
+	t := &chainTip{}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	return t
+}
+
+// context returns the context of the current tip
+func (t *chainTip) context() context.Context {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.ctx
+}
+
+// advance cancels the context of the current tip and starts a new one
+func (t *chainTip) advance() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cancel()
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+}
+
+// address returns this Peer's wallet address, which is derived from its client component's key
+func (p *Peer) address() string {
+	return p.clientComponent.GetAddress()
+}
+
+// balance returns this Peer's wallet balance according to the ledger
+func (p *Peer) balance() int {
+	return p.ledger.Balance(p.address())
+}
+
+// submitEvidence sends evidence of a validator's offence to the Middleware, which adds it to the mempool so that it is
+// recorded in the next block
+func (p *Peer) submitEvidence(e SlashingEvidence) {
+
+	log.Printf("Submitting evidence that %s committed %s at height %d...\n", e.Offender(), e.Offence, e.Height())
+
+	toSend, err := p.communicationComponent.GenerateMessage("EVIDENCE", e)
+	if err != nil {
+		log.Printf("Error generating message: %v\n", err)
+		return
+	}
+
+	err = p.communicationComponent.SendMsgToPeer(toSend, p.communicationComponent.GetMiddlewarePeer())
+	if err != nil {
+		log.Printf("Error sending message to Middleware: %v\n", err)
+	}
+}
+
+// hasOwnTransaction returns true if any of the block's transactions was sent by this Peer
+func (p *Peer) hasOwnTransaction(b Block) bool {
+	self := p.address()
+	for _, d := range b.Data {
+		if transaction, ok := d.(Transaction); ok && transaction.From == self {
+			return true
+		}
+	}
+	return false
+}
@@ -5,33 +5,50 @@ import (
 	"encoding/hex"
 	"errors"
 	"log"
-	"strconv"
-	"time"
+	"sync"
 )
 
-// ============================ Proof of Work ============================
+// ============================ Proof of Stake ============================
 
 // ProofOfStake algorithm used in mining blocks
 type ProofOfStake struct {
-	StakeAmount    int
-	CandidateBlock Block
-	toMine         Transaction
+	FinalityDepth  int
+	Rewards        RewardSchedule
+	candidateBlock Block
+	toMine         []Data
+	entry          ElectionEntry
+	mutex          sync.Mutex
 }
 
 // Initialize is the interface method that calls this component's initialize method
-func (p ProofOfStake) Initialize() error {
-	// No initialization needed for this implementation
-	return nil
+func (p *ProofOfStake) Initialize() error {
+	// The only thing to check is that the reward schedule can be used
+	return p.Rewards.Validate()
 }
 
 // Terminate is the interface method that calls this component's cleanup method
-func (p ProofOfStake) Terminate() {
+func (p *ProofOfStake) Terminate() {
 	// No clean-up needed for this implementation
 }
 
-// Terminate is the interface method that calls this component's cleanup method
-func (p ProofOfStake) GetCandidateBlock() Block {
-	return p.CandidateBlock
+// GetCandidateBlock is the interface method that returns the block this Peer most recently produced, which is empty
+// until it wins an election
+func (p *ProofOfStake) GetCandidateBlock() Block {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.candidateBlock
+}
+
+// GetRewardSchedule is the interface method that returns the schedule of the block rewards paid to miners
+func (p *ProofOfStake) GetRewardSchedule() RewardSchedule {
+	return p.Rewards
+}
+
+// GetMiningStats is the interface method that returns the statistics of this Peer's most recent mining sessions.
+// Blocks are created without any hashing, so there are none
+func (p *ProofOfStake) GetMiningStats() []MiningStats {
+	return []MiningStats{}
 }
 
 // HandleCommand is the interface method that handles the passed message
@@ -40,17 +57,49 @@ func (p *ProofOfStake) HandleCommand(msg Message, peer *Peer) (err error) {
 	switch msg.Command {
 	case "MINE":
 		go func() {
-			// Start a new mining session by sending stake to middleware
+			// Start a new mining session by entering the election of the next block's producer
 			log.Println("Starting new mining session, entering lottery...")
 
 			// Mine the new block
-			p.toMine = msg.Data.(Transaction)
+			p.mutex.Lock()
+			p.toMine = msg.Data.(DataBatch).Entries
+			p.entry = ElectionEntry{}
+			p.mutex.Unlock()
+
+			// Enter the lottery with this peer's bonded stake, see stakeFor
+			stake := p.stakeFor(peer)
+			if stake < 1 {
+				log.Println("This peer isn't a validator, not entering lottery. Bond stake with the 'stake' command to produce blocks")
+				return
+			}
 
-			// Enter the lottery with a stake of currency (equal to 50% of the current wallet amount, rounded to an int
-			stake := int(peer.wallet / 2)
-			peer.wallet -= stake
+			// Commit to a secret that is only revealed once every entry is in, so no one can predict the draw
+			secret, commitment, err := NewElectionSecret()
+			if err != nil {
+				log.Printf("Error generating election secret: %v\n", err)
+				return
+			}
 
-			data := LotteryEntry{Stake: stake}
+			chain := peer.GetChain()
+			entry := ElectionEntry{
+				Height:     len(chain),
+				PrevHash:   chain[len(chain)-1].Hash,
+				Address:    peer.address(),
+				Stake:      stake,
+				Commitment: commitment}
+
+			entry, err = peer.clientComponent.SignElectionEntry(entry)
+			if err != nil {
+				log.Printf("Error signing election entry: %v\n", err)
+				return
+			}
+
+			data := LotteryEntry{Entry: entry}
+
+			entry.Secret = secret
+			p.mutex.Lock()
+			p.entry = entry
+			p.mutex.Unlock()
 
 			toSend, err := peer.communicationComponent.GenerateMessage("STAKE", data)
 			if err != nil {
@@ -58,6 +107,46 @@ func (p *ProofOfStake) HandleCommand(msg Message, peer *Peer) (err error) {
 				return
 			}
 
+			err = peer.communicationComponent.SendMsgToPeer(toSend, peer.communicationComponent.GetMiddlewarePeer())
+			if err != nil {
+				log.Printf("Error sending message to Middleware: %v\n", err)
+				return
+			}
+		}()
+	case "REVEAL":
+		go func() {
+			// Entries are closed, so reveal this peer's secret if its entry made it into the election
+			election, ok := msg.Data.(Election)
+			if !ok {
+				log.Println("Ignoring election secret, which only peers send")
+				return
+			}
+
+			p.mutex.Lock()
+			ownEntry := p.entry
+			p.mutex.Unlock()
+
+			entered := false
+			for _, entry := range election.Entries {
+				if entry.Address == ownEntry.Address && entry.Commitment == ownEntry.Commitment {
+					entered = true
+				}
+			}
+
+			if !entered {
+				return
+			}
+
+			log.Println("Revealing election secret to Middleware...")
+
+			data := ElectionReveal{Height: ownEntry.Height, Address: ownEntry.Address, Secret: ownEntry.Secret}
+
+			toSend, err := peer.communicationComponent.GenerateMessage("REVEAL", data)
+			if err != nil {
+				log.Printf("Fatal error generating message: %v\n", err)
+				return
+			}
+
 			err = peer.communicationComponent.SendMsgToPeer(toSend, peer.communicationComponent.GetMiddlewarePeer())
 			if err != nil {
 				log.Printf("Error sending message to Middleware: %v\n", err)
@@ -66,29 +155,70 @@ func (p *ProofOfStake) HandleCommand(msg Message, peer *Peer) (err error) {
 		}()
 	case "WINNER":
 		go func() {
-			p.CandidateBlock = Block{}
-			log.Println("Won the lottery and recieved a new transaction, beginning new mining session...")
+			p.mutex.Lock()
+			p.candidateBlock = Block{}
+			toMine := p.toMine
+			p.mutex.Unlock()
+
+			// The Middleware only passes the election on, so check the draw ourselves before producing the block
+			election := msg.Data.(Election)
+
+			leader, err := election.Leader()
+			if err != nil || leader != peer.address() {
+				log.Println("Received lottery win, but this peer wasn't elected, ignoring...")
+				return
+			}
+
+			log.Println("Won the lottery, beginning new mining session...")
+
+			// The leaders of the earlier rounds missed their slot, which the block records to show its round
+			missed, err := election.MissedSlots()
+			if err != nil {
+				log.Printf("Error recording missed slots: %v\n", err)
+				return
+			}
+
+			// The block starts with the coinbase that pays this peer if its block is accepted, followed by the
+			// election that shows every peer that this peer was elected to produce it
+			entries := []Data{election}
+			for _, evidence := range missed {
+				entries = append(entries, evidence)
+			}
+
+			chain := peer.GetChain()
+			newEntries := withCoinbase(len(chain), peer.address(), append(entries, toMine...), p.Rewards)
 
 			//Create a new block
 			newBlock := Block{
-				Index:     len(peer.chain),
-				Timestamp: time.Now().String(),
-				Data:      p.toMine,
-				PrevHash:  peer.chain[len(peer.chain)-1].Hash,
-				Hash:      "",
-				Nonce:     0}
-
-			//Calculate this block's proof
+				BlockHeader: BlockHeader{
+					Index:      len(chain),
+					Timestamp:  newTimestamp(),
+					PrevHash:   chain[len(chain)-1].Hash,
+					MerkleRoot: MerkleRoot(newEntries),
+					Nonce:      0,
+					Miner:      peer.address(),
+					PublicKey:  peer.clientComponent.GetPublicKey()},
+				Data: newEntries,
+				Hash: ""}
+
+			//Calculate this block's proof, and sign it as the elected producer
 			newBlock.Hash = p.CalculateHash(newBlock)
 
+			newBlock, err = peer.clientComponent.SignBlock(newBlock)
+			if err != nil {
+				log.Printf("Error signing block: %v\n", err)
+				return
+			}
+
 			log.Println("Block mined successfully")
 
-			p.CandidateBlock = newBlock
+			p.mutex.Lock()
+			p.candidateBlock = newBlock
+			p.mutex.Unlock()
 			data := CandidateBlock{Block: newBlock}
 
 			log.Println("Sending proof to Middleware...")
 
-			// TODO: Would need to send the proposed block here for validation to occur
 			toSend, err := peer.communicationComponent.GenerateMessage("PROOF", data)
 			if err != nil {
 				log.Printf("Fatal error generating message: %v\n", err)
@@ -106,7 +236,7 @@ func (p *ProofOfStake) HandleCommand(msg Message, peer *Peer) (err error) {
 		go func() {
 
 			// Broadcast this peer's copy of the chain so that the new chain can be distributed
-			data := Chain{ChainCopy: peer.chain}
+			data := Chain{ChainCopy: peer.GetChain()}
 
 			toSend, err := peer.communicationComponent.GenerateMessage("PEER_CHAIN", data)
 			if err != nil {
@@ -119,16 +249,6 @@ func (p *ProofOfStake) HandleCommand(msg Message, peer *Peer) (err error) {
 			}
 
 		}()
-	case "STAKE":
-		go func() {
-
-			// Accept the stake refund from the middleware, add staked amount back into wallet
-			data := msg.Data.(LotteryEntry)
-			peer.wallet += data.Stake
-			log.Println("Received stake back from Middleware, new wallet balance: ", peer.wallet)
-
-		}()
-
 	default:
 		err = errors.New("command not supported")
 	}
@@ -137,16 +257,134 @@ func (p *ProofOfStake) HandleCommand(msg Message, peer *Peer) (err error) {
 
 }
 
-// ValidateBlock is an interface method that verifies that the proof generated by this component's proof method is a valid proof for the block
-func (p ProofOfStake) ValidateBlock(b Block) bool {
-	return b.Hash == p.CalculateHash(b)
+// PreferChain is the interface method that decides whether to replace the current chain with a candidate. Blocks
+// take no work to create, so chain length alone would let any staker rewrite history by building a longer chain in
+// private. Instead, the blocks of both chains after the point where they fork are weighed by the stake of the
+// validators that endorse them. Every election entry is signed for the block it follows, so every validator endorses
+// the chain that holds its latest entry, see endorsements, and the candidate is only preferred if the validators
+// endorsing it have more stake. Once FinalityDepth blocks have been built on top of a block it is final, and a
+// candidate that doesn't keep every final block of the current chain is never preferred. Every peer creates its own
+// genesis block, so the genesis block is never compared
+func (p *ProofOfStake) PreferChain(current []Block, candidate []Block) bool {
+
+	fork := 1
+	for fork < len(current) && fork < len(candidate) && sameBlock(current[fork], candidate[fork]) {
+		fork++
+	}
+
+	// A candidate that is the current chain, or only a part of it, adds nothing
+	if fork >= len(candidate) {
+		return false
+	}
+
+	finalHeight := len(current) - 1 - p.finalityDepth()
+	if fork <= finalHeight {
+		return false
+	}
+
+	currentVotes := p.endorsements(current, fork)
+	candidateVotes := p.endorsements(candidate, fork)
+
+	return endorsedStake(candidateVotes, currentVotes) > endorsedStake(currentVotes, candidateVotes)
+}
+
+// ValidateBlock is an interface method that verifies that the proof generated by this component's proof method is a valid proof for the block.
+// The block must be signed by its producer, and must record an election that its producer won, see checkElection.
+// A header alone doesn't say who was elected, so a block without data is rejected, which is why light clients don't
+// support proof of stake. The proof doesn't depend on the blocks before it, so the passed headers aren't needed
+func (p *ProofOfStake) ValidateBlock(b Block, prev []BlockHeader) bool {
+
+	if b.Hash != p.CalculateHash(b) {
+		return false
+	}
+
+	err := VerifyBlockSignature(b)
+	if err != nil {
+		log.Printf("Signature of block %d is invalid: %v\n", b.Index, err)
+		return false
+	}
+
+	if len(b.Data) == 0 {
+		log.Printf("Block %d holds no election\n", b.Index)
+		return false
+	}
+
+	err = checkElection(b)
+	if err != nil {
+		log.Printf("Election of block %d is invalid: %v\n", b.Index, err)
+		return false
+	}
+
+	return true
 }
 
 // CalculateHash is the interface method that calculates a hash given some data
-func (p ProofOfStake) CalculateHash(b Block) string {
-	record := strconv.Itoa(b.Index) + b.Timestamp + b.Data.ToString() + b.PrevHash + strconv.Itoa(b.Nonce)
+func (p *ProofOfStake) CalculateHash(b Block) string {
+	record := b.BlockHeader.ToString()
 	h := sha256.New()
 	h.Write([]byte(record))
 	hashed := h.Sum(nil)
 	return hex.EncodeToString(hashed)
 }
+
+// endorsements returns the latest revealed election entry of every validator in the blocks of the chain from the
+// passed index on. Only blocks that link to the block before them, are signed by their producer and record a valid
+// election that their producer won are counted, and the blocks after one that doesn't aren't counted either. The
+// stakes of the entries are only checked against the validator set when the chain is validated, see
+// Ledger.CheckElection, which is done before a preferred chain is adopted
+func (p *ProofOfStake) endorsements(chain []Block, from int) map[string]ElectionEntry {
+
+	votes := make(map[string]ElectionEntry)
+	for i := from; i < len(chain); i++ {
+		b := chain[i]
+		if b.PrevHash != chain[i-1].Hash || b.Hash != p.CalculateHash(b) || VerifyBlockSignature(b) != nil || checkElection(b) != nil {
+			break
+		}
+
+		for _, entry := range b.Data[1].(Election).Entries {
+			if !entry.absent() {
+				votes[entry.Address] = entry
+			}
+		}
+	}
+
+	return votes
+}
+
+// stakeFor returns the stake that the peer enters elections with, which is its bonded stake. Until any stake is
+// bonded there are no validators, so the peer stakes half of its balance instead, rounded down, which lets a new
+// network produce the blocks that bond its first stake
+func (p *ProofOfStake) stakeFor(peer *Peer) int {
+	if len(peer.ledger.Validators()) == 0 {
+		return peer.balance() / 2
+	}
+	return peer.ledger.Stake(peer.address())
+}
+
+// finalityDepth returns the number of blocks built on top of a block that make it final
+func (p *ProofOfStake) finalityDepth() int {
+	if p.FinalityDepth <= 0 {
+		return DEFAULT_FINALITY_DEPTH
+	}
+	return p.FinalityDepth
+}
+
+// endorsedStake returns the stake of the validators whose latest entry in votes is later than their latest entry in
+// rival. An entry at the same height in both was made for the block both chains fork from, so it endorses neither
+func endorsedStake(votes map[string]ElectionEntry, rival map[string]ElectionEntry) int {
+
+	stake := 0
+	for address, entry := range votes {
+		other, ok := rival[address]
+		if !ok || other.Height < entry.Height {
+			stake += entry.Stake
+		}
+	}
+
+	return stake
+}
+
+// sameBlock returns true if both blocks have the same header and hash
+func sameBlock(a Block, b Block) bool {
+	return a.BlockHeader == b.BlockHeader && a.Hash == b.Hash
+}
@@ -1,38 +1,94 @@
 package blockchain
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"log"
-	"strconv"
-	"strings"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ============================ Proof of Work ============================
 
-// ProofOfWork algorithm used in mining blocks
+// Checking whether mining was cancelled takes longer than hashing, so every worker only checks after this many hashes
+const miningCheckInterval = 1024
+
+// ProofOfWork algorithm used in mining blocks. The hash of every block must meet the target in its header, see
+// difficulty.go. The first block's target is met by hashes starting with ProofDifficulty zero hex characters. If
+// RetargetInterval is set, the target is adjusted after every RetargetInterval blocks, using the timestamps of
+// those blocks, so that blocks are found every TargetBlockTime on average. Otherwise every block uses the first
+// block's target. Like the reward schedule, these settings are consensus rules that every Peer must share. Blocks
+// are mined by Workers goroutines at once, one per CPU by default, and the statistics of every mining session are
+// kept and reported to the Middleware
 type ProofOfWork struct {
-	ProofDifficulty int
-	CandidateBlock  Block
-	mining          bool
+	ProofDifficulty  int
+	TargetBlockTime  time.Duration
+	RetargetInterval int
+	Workers          int
+	Rewards          RewardSchedule
+	candidateBlock   Block
+	cancelMining     context.CancelFunc
+	session          int
+	stats            []MiningStats
+	mutex            sync.Mutex
 }
 
 // Initialize is the interface method that calls this component's initialize method
-func (p ProofOfWork) Initialize() error {
-	// No initialization needed for this implementation
-	return nil
+func (p *ProofOfWork) Initialize() error {
+
+	if p.ProofDifficulty < 0 || p.ProofDifficulty > 63 {
+		return errors.New("proof difficulty must be between 0 and 63")
+	}
+
+	// The time between the first and last block of an interval is measured, so an interval needs at least 2 blocks
+	if p.RetargetInterval < 0 || p.RetargetInterval == 1 {
+		return errors.New("retarget interval must be 0, to disable retargeting, or at least 2")
+	}
+
+	if p.RetargetInterval > 0 && p.TargetBlockTime <= 0 {
+		return errors.New("target block time must be set when retargeting")
+	}
+
+	if p.Workers < 0 {
+		return errors.New("number of mining workers must not be negative")
+	}
+
+	return p.Rewards.Validate()
 }
 
 // Terminate is the interface method that calls this component's cleanup method
-func (p ProofOfWork) Terminate() {
-	// No clean-up needed for this implementation
+func (p *ProofOfWork) Terminate() {
+	p.stopMining(0)
 }
 
-// Terminate is the interface method that calls this component's cleanup method
-func (p ProofOfWork) GetCandidateBlock() Block {
-	return p.CandidateBlock
+// GetCandidateBlock is the interface method that returns the block this Peer most recently mined, which is empty
+// while a mining session is running
+func (p *ProofOfWork) GetCandidateBlock() Block {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.candidateBlock
+}
+
+// GetRewardSchedule is the interface method that returns the schedule of the block rewards paid to miners
+func (p *ProofOfWork) GetRewardSchedule() RewardSchedule {
+	return p.Rewards
+}
+
+// GetMiningStats is the interface method that returns the statistics of this Peer's most recent mining sessions,
+// oldest first
+func (p *ProofOfWork) GetMiningStats() []MiningStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]MiningStats{}, p.stats...)
 }
 
 // HandleCommand is the interface method that handles the passed message
@@ -40,62 +96,78 @@ func (p *ProofOfWork) HandleCommand(msg Message, peer *Peer) (err error) {
 
 	switch msg.Command {
 	case "MINE":
+		// The session is abandoned as soon as the chain tip changes, as its block would no longer extend the chain
+		ctx, session := p.startMining(peer.tipContext())
+
 		go func() {
 			// Start a new mining session
-			newTransaction := msg.Data.(Transaction)
-			p.mining = true
-			p.CandidateBlock = Block{}
-			log.Println("Recieved a new transaction, beginning new mining session...")
+			newEntries := msg.Data.(DataBatch).Entries
+			log.Printf("Recieved %d new entries, beginning new mining session...\n", len(newEntries))
+
+			// The block starts with the coinbase that pays this peer if its block is accepted
+			chain := peer.GetChain()
+			newEntries = withCoinbase(len(chain), peer.address(), newEntries, p.Rewards)
 
 			//Create a new block
 			newBlock := Block{
-				Index:     len(peer.chain),
-				Timestamp: time.Now().String(),
-				Data:      newTransaction,
-				PrevHash:  peer.chain[len(peer.chain)-1].Hash,
-				Hash:      "",
-				Nonce:     0}
+				BlockHeader: BlockHeader{
+					Index:      len(chain),
+					Timestamp:  newTimestamp(),
+					PrevHash:   chain[len(chain)-1].Hash,
+					MerkleRoot: MerkleRoot(newEntries),
+					Nonce:      0,
+					Miner:      peer.address(),
+					Target:     p.NextTarget(headersOf(chain))},
+				Data: newEntries,
+				Hash: ""}
 
 			//Calculate this block's proof
-			newBlock = p.proofOfWork(newBlock, p.mining)
+			newBlock, stats, err := p.mine(ctx, newBlock)
+			p.stopMining(session)
 
-			if p.mining {
-				p.mining = false
+			// Sessions that were stopped are reported too, as their work counts towards how hard blocks are to find
+			if stats.Hashes > 0 {
+				p.recordStats(stats, peer)
 			}
 
-			// If the new block's hash isnt empty, then this peer successfully mined the block
-			if newBlock.Hash != "" {
-				log.Println("Block mined successfully")
+			if errors.Is(err, context.Canceled) {
+				log.Println("Mining session was stopped, as another block was accepted or the chain changed")
+				return
+			} else if err != nil {
+				log.Printf("Error mining block: %v\n", err)
+				return
+			}
 
-				p.CandidateBlock = newBlock
-				data := CandidateBlock{Block: newBlock}
+			log.Println("Block mined successfully")
 
-				log.Println("Sending proof to Middleware for validation...")
+			if !p.setCandidateBlock(session, newBlock) {
+				log.Println("Mining session was replaced by a newer one, discarding its block")
+				return
+			}
+			data := CandidateBlock{Block: newBlock}
 
-				toSend, err := peer.communicationComponent.GenerateMessage("PROOF", data)
-				if err != nil {
-					log.Printf("Fatal error generating message: %v\n", err)
-					return
-				}
+			log.Println("Sending proof to Middleware for validation...")
 
-				err = peer.communicationComponent.SendMsgToPeer(toSend, peer.communicationComponent.GetMiddlewarePeer())
-				if err != nil {
-					log.Printf("Error sending message to Middleware: %v\n", err)
-					return
-				}
+			toSend, err := peer.communicationComponent.GenerateMessage("PROOF", data)
+			if err != nil {
+				log.Printf("Fatal error generating message: %v\n", err)
+				return
+			}
+
+			err = peer.communicationComponent.SendMsgToPeer(toSend, peer.communicationComponent.GetMiddlewarePeer())
+			if err != nil {
+				log.Printf("Error sending message to Middleware: %v\n", err)
+				return
 			}
 		}()
 
 	case "CONSENSUS":
 		go func() {
-			if p.mining {
-				// Set mining to false which will end the mining session
-				// as another peer has already successfully mined the block
-				p.mining = false
-			}
+			// End the mining session, as another peer has already successfully mined the block
+			p.stopMining(0)
 
 			// Broadcast this peer's copy of the chain so that the new chain can be distributed
-			data := Chain{ChainCopy: peer.chain}
+			data := Chain{ChainCopy: peer.GetChain()}
 
 			toSend, err := peer.communicationComponent.GenerateMessage("PEER_CHAIN", data)
 			if err != nil {
@@ -117,32 +189,241 @@ func (p *ProofOfWork) HandleCommand(msg Message, peer *Peer) (err error) {
 
 }
 
-// ValidateBlock is an interface method that verifies that the proof generated by this component's proof method is a valid proof for the block
-func (p ProofOfWork) ValidateBlock(b Block) bool {
-	if len(b.Hash) < p.ProofDifficulty {
-		return false
+// ValidateBlock is an interface method that verifies that the proof generated by this component's proof method is a valid proof for the block.
+// The block must carry the target that follows from the headers of the chain it extends, and its hash must meet it
+func (p *ProofOfWork) ValidateBlock(b Block, prev []BlockHeader) bool {
+	return b.Target == p.NextTarget(prev) && HashMeetsTarget(b.Hash, b.Target) && b.Hash == p.CalculateHash(b)
+}
+
+// PreferChain is the interface method that decides whether to replace the current chain with a candidate. The chain
+// with the most work wins, even if it has fewer blocks, as it took the most hashing power to build. If both have the
+// same work the current chain is kept. A header's target is only a claim, so only the work that is proven by the
+// headers is compared, see provenWork. Only the headers are needed, so the blocks may have no data
+func (p *ProofOfWork) PreferChain(current []Block, candidate []Block) bool {
+	return p.provenWork(headersOf(candidate)).Cmp(p.provenWork(headersOf(current))) > 0
+}
+
+// NextTarget returns the target that the block following the passed chain of headers must meet. Blocks keep the
+// target of the block before them, except for the first block of every retarget interval, whose target is scaled by
+// how long the previous interval took compared to TargetBlockTime
+func (p *ProofOfWork) NextTarget(prev []BlockHeader) string {
+
+	height := len(prev)
+	if height <= 1 {
+		return TargetFromDifficulty(p.ProofDifficulty)
 	}
 
-	return b.Hash[:p.ProofDifficulty] == strings.Repeat("0", p.ProofDifficulty) && b.Hash == p.CalculateHash(b)
+	last := prev[height-1]
+	if p.RetargetInterval == 0 || (height-1)%p.RetargetInterval != 0 {
+		return last.Target
+	}
+
+	target, err := ParseTarget(last.Target)
+	if err != nil {
+		return last.Target
+	}
 
+	// The genesis block is created whenever a peer starts, so the interval is measured from its first block to its
+	// last, which spans one block time fewer than the interval holds
+	first := prev[height-p.RetargetInterval]
+	firstTime, err := first.Time()
+	if err != nil {
+		return last.Target
+	}
+	lastTime, err := last.Time()
+	if err != nil {
+		return last.Target
+	}
+
+	actual := lastTime.Sub(firstTime)
+	expected := time.Duration(p.RetargetInterval-1) * p.TargetBlockTime
+
+	return encodeTarget(retarget(target, actual, expected))
 }
 
 // CalculateHash is the interface method that calculates a hash given some data
-func (p ProofOfWork) CalculateHash(b Block) string {
-	record := strconv.Itoa(b.Index) + b.Timestamp + b.Data.ToString() + b.PrevHash + strconv.Itoa(b.Nonce)
+func (p *ProofOfWork) CalculateHash(b Block) string {
+	record := b.BlockHeader.ToString()
 	h := sha256.New()
 	h.Write([]byte(record))
 	hashed := h.Sum(nil)
 	return hex.EncodeToString(hashed)
 }
 
-// proofOfWork is the consensus algorithm that computes a satisfactory hash for the passed block
-func (p ProofOfWork) proofOfWork(b Block, m bool) Block {
+// ==================== Non-interface, helper methods ========================
+
+// provenWork returns the work of the passed headers up to the first one whose proof doesn't hold, which is a header
+// that doesn't link to the recomputed hash of the header before it, doesn't carry the target that follows from the
+// headers before it, or whose recomputed hash doesn't meet that target. Headers after it don't extend a proven chain,
+// so they count for nothing either
+func (p *ProofOfWork) provenWork(headers []BlockHeader) *big.Int {
+
+	if len(headers) == 0 {
+		return new(big.Int)
+	}
+
+	proven := 0
+	prevHash := GENESIS_HASH
+	for i := 1; i < len(headers); i++ {
+		h := headers[i]
+		hash := p.CalculateHash(Block{BlockHeader: h})
+
+		if h.PrevHash != prevHash || h.Target != p.NextTarget(headers[:i]) || !HashMeetsTarget(hash, h.Target) {
+			break
+		}
+
+		proven = i
+		prevHash = hash
+	}
+
+	return ChainWork(headers[:proven+1])
+}
+
+// mine is the consensus algorithm that computes a satisfactory hash for the passed block. The search is split across
+// the configured number of workers, each of which tries its own range of nonces, and every worker stops as soon as
+// one of them finds a hash that meets the block's target. If the context is cancelled first, its error is returned.
+// The statistics of the session are returned either way
+func (p *ProofOfWork) mine(ctx context.Context, b Block) (Block, MiningStats, error) {
+
+	stats := MiningStats{Height: b.Index, Miner: b.Miner, Target: b.Target, Difficulty: TargetDifficulty(b.Target), Started: time.Now()}
+
+	target, err := ParseTarget(b.Target)
+	if err != nil {
+		return Block{}, stats, err
+	}
+	targetBytes := target.FillBytes(make([]byte, 32))
+
+	workers := p.workers()
+	stats.Workers = workers
+	span := math.MaxInt / workers
+
+	search, stop := context.WithCancel(ctx)
+	defer stop()
+
+	found := make(chan Block, workers)
+	var hashes int64
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(candidate Block, start int) {
+			defer wg.Done()
+
+			nonce := start
+			defer func() { atomic.AddInt64(&hashes, int64(nonce-start)) }()
+
+			for ; nonce < start+span; nonce++ {
+				if (nonce-start)%miningCheckInterval == 0 && search.Err() != nil {
+					return
+				}
+
+				// The same hash as CalculateHash, compared as bytes so that no hex encoding is needed per attempt
+				candidate.Nonce = nonce
+				hash := sha256.Sum256([]byte(candidate.BlockHeader.ToString()))
+				if bytes.Compare(hash[:], targetBytes) <= 0 {
+					nonce++
+					candidate.Hash = hex.EncodeToString(hash[:])
+					found <- candidate
+					stop()
+					return
+				}
+			}
+		}(b, w*span)
+	}
+
+	wg.Wait()
+
+	stats.Elapsed = time.Since(stats.Started)
+	stats.Hashes = hashes
+	if stats.Elapsed > 0 {
+		stats.HashRate = float64(stats.Hashes) / stats.Elapsed.Seconds()
+	}
+
+	// A block found for a tip that has since changed is of no use
+	if ctx.Err() != nil {
+		return Block{}, stats, ctx.Err()
+	}
+
+	select {
+	case mined := <-found:
+		stats.Found = true
+		stats.Nonce = mined.Nonce
+		return mined, stats, nil
+	default:
+		return Block{}, stats, errors.New("no nonce gives a hash that meets the target")
+	}
+}
+
+// recordStats adds the statistics of a mining session to this component's history, and reports them to the
+// Middleware so that the work of every Peer can be compared
+func (p *ProofOfWork) recordStats(stats MiningStats, peer *Peer) {
+
+	p.mutex.Lock()
+	p.stats = appendMiningStats(p.stats, stats)
+	p.mutex.Unlock()
+
+	log.Printf("Mining session statistics: %s\n", stats.String())
+
+	toSend, err := peer.communicationComponent.GenerateMessage("MINING_STATS", stats)
+	if err != nil {
+		log.Printf("Error generating message: %v\n", err)
+		return
+	}
+
+	err = peer.communicationComponent.SendMsgToPeer(toSend, peer.communicationComponent.GetMiddlewarePeer())
+	if err != nil {
+		log.Printf("Error sending message to Middleware: %v\n", err)
+	}
+}
+
+// startMining ends the current mining session, if there is one, and starts a new session that also ends when the
+// passed context does. The block of the previous session is cleared. It returns the session's context and number
+func (p *ProofOfWork) startMining(parent context.Context) (context.Context, int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cancelMining != nil {
+		p.cancelMining()
+	}
+	p.candidateBlock = Block{}
+
+	ctx, cancel := context.WithCancel(parent)
+	p.cancelMining = cancel
+	p.session++
+
+	return ctx, p.session
+}
+
+// stopMining ends the mining session with the passed number if it is still running, or whichever session is running
+// if 0 is passed
+func (p *ProofOfWork) stopMining(session int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cancelMining != nil && (session == 0 || session == p.session) {
+		p.cancelMining()
+		p.cancelMining = nil
+	}
+}
+
+// setCandidateBlock records the block mined by the session with the passed number, unless a newer session has been
+// started since. It returns whether the block was recorded
+func (p *ProofOfWork) setCandidateBlock(session int, b Block) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if session != p.session {
+		return false
+	}
+
+	p.candidateBlock = b
+	return true
+}
 
-	b.Nonce = 0
-	for !p.ValidateBlock(b) && m {
-		b.Nonce++
-		b.Hash = p.CalculateHash(b)
+// workers returns the number of goroutines that mine at once
+func (p *ProofOfWork) workers() int {
+	if p.Workers <= 0 {
+		return runtime.NumCPU()
 	}
-	return b
+	return p.Workers
 }
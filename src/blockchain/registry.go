@@ -0,0 +1,198 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ============================ Data Registry ============================
+
+// DataDecoder decodes the JSON encoding of a Data implementation
+type DataDecoder func(raw json.RawMessage) (Data, error)
+
+var dataDecoders = make(map[string]DataDecoder)
+var dataDecodersMutex sync.RWMutex
+
+// RegisterDataType registers the decoder for the Data implementation whose GetType method returns the passed tag.
+// Every Data implementation must be registered before a Message carrying it can be received, which is usually done
+// in an init function next to the implementation
+func RegisterDataType(tag string, decoder DataDecoder) {
+	dataDecodersMutex.Lock()
+	defer dataDecodersMutex.Unlock()
+
+	if _, ok := dataDecoders[tag]; ok {
+		panic(fmt.Sprintf("Data type %q is already registered", tag))
+	}
+
+	dataDecoders[tag] = decoder
+}
+
+// DecodeData decodes the raw JSON of a Data implementation using the decoder registered for the passed tag
+func DecodeData(tag string, raw json.RawMessage) (Data, error) {
+	dataDecodersMutex.RLock()
+	decoder, ok := dataDecoders[tag]
+	dataDecodersMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("error unmarshalling Data object: unsupported type %q", tag)
+	}
+
+	data, err := decoder(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling Data object of type %q: %v", tag, err)
+	}
+
+	return data, nil
+}
+
+// ============================ Payload Registry ============================
+
+// PayloadValidator checks that a Data entry is well-formed before it is mined into, or accepted as part of, a block
+type PayloadValidator func(d Data) error
+
+// PayloadEncoder returns the canonical encoding of a Data entry, which its Merkle leaf is hashed over, see
+// LeafHashingBytes. It must write every field of the entry in a fixed order, in a way that no two different entries
+// share an encoding, such as the encoding described by canonicalEncoder
+type PayloadEncoder func(d Data) []byte
+
+// payloadType is how a type of Data that blocks can carry was registered
+type payloadType struct {
+	validator PayloadValidator
+	encoder   PayloadEncoder
+}
+
+var payloadTypes = make(map[string]payloadType)
+var payloadTypesMutex sync.RWMutex
+
+// RegisterPayloadType allows the Data implementation with the passed tag to be carried in blocks, with the validator
+// that checks its entries and the encoder that produces their canonical encoding. Its decoder must also be registered
+// with RegisterDataType
+func RegisterPayloadType(tag string, validator PayloadValidator, encoder PayloadEncoder) {
+	payloadTypesMutex.Lock()
+	defer payloadTypesMutex.Unlock()
+
+	if _, ok := payloadTypes[tag]; ok {
+		panic(fmt.Sprintf("payload type %q is already registered", tag))
+	}
+
+	payloadTypes[tag] = payloadType{validator: validator, encoder: encoder}
+}
+
+// ValidatePayload checks that the Data entry is of a type that blocks can carry, and runs its validator
+func ValidatePayload(d Data) error {
+	payloadTypesMutex.RLock()
+	registered, ok := payloadTypes[d.GetType()]
+	payloadTypesMutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("blocks can't carry Data of type %q", d.GetType())
+	}
+
+	return registered.validator(d)
+}
+
+// ============================ Command Registry ============================
+
+var commandDataTypes = make(map[string][]string)
+var commandDataTypesMutex sync.RWMutex
+
+// RegisterCommand allows messages with the passed command to be received, carrying Data with any of the passed type
+// tags. A command registered without tags carries no Data. A command that carries more than one type of Data can be
+// registered again next to each of them, which adds to the tags it may carry. Messages with any other command or
+// Data are refused when they are decoded, so a handler can rely on the type of its message's Data
+func RegisterCommand(command string, dataTypes ...string) {
+	commandDataTypesMutex.Lock()
+	defer commandDataTypesMutex.Unlock()
+
+	registered := commandDataTypes[command]
+	for _, t := range dataTypes {
+		for _, other := range registered {
+			if t == other {
+				panic(fmt.Sprintf("command %q already carries Data type %q", command, t))
+			}
+		}
+		registered = append(registered, t)
+	}
+
+	commandDataTypes[command] = registered
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// checkCommand returns an error describing why a message with the command can't carry Data with the passed type tag,
+// or nil if it can. An empty tag means the message carries no Data
+func checkCommand(command string, dataType string) error {
+	commandDataTypesMutex.RLock()
+	dataTypes, ok := commandDataTypes[command]
+	commandDataTypesMutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("command %q is not supported", command)
+	}
+
+	if len(dataTypes) == 0 {
+		if dataType != "" {
+			return fmt.Errorf("%s messages carry no data, but found %q", command, dataType)
+		}
+		return nil
+	}
+
+	for _, t := range dataTypes {
+		if t == dataType {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s messages can't carry data of type %q", command, dataType)
+}
+
+// encodePayload returns the canonical encoding of a Data entry using the encoder registered for its type, or false if
+// blocks can't carry entries of its type
+func encodePayload(d Data) ([]byte, bool) {
+	payloadTypesMutex.RLock()
+	registered, ok := payloadTypes[d.GetType()]
+	payloadTypesMutex.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	return registered.encoder(d), true
+}
+
+// taggedData is the form a Data entry takes inside a list, tagged with its type so that lists can mix types
+type taggedData struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// encodeDataList tags every Data entry of the list with its type
+func encodeDataList(list []Data) ([]taggedData, error) {
+
+	tagged := []taggedData{}
+	for _, d := range list {
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		tagged = append(tagged, taggedData{Type: d.GetType(), Data: raw})
+	}
+
+	return tagged, nil
+}
+
+// decodeDataList decodes every tagged Data entry of the list with the decoder registered for its type
+func decodeDataList(tagged []taggedData) ([]Data, error) {
+
+	list := []Data{}
+	for _, t := range tagged {
+		d, err := DecodeData(t.Type, t.Data)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,184 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ============================ Reward Schedule ============================
+
+// RewardSchedule decides how much new currency the coinbase of each block creates, which is part of the network's
+// consensus rules, so every Peer on a network must use the same schedule. The reward of the first block is
+// InitialReward, which is REWARD_AMOUNT if it isn't set, and may be 0 for a network without block rewards. If
+// HalvingInterval is set, the reward halves, rounding down, after every HalvingInterval blocks, but never falls below
+// TailReward, so a TailReward keeps currency being created forever. If SupplyCap is set, no more than SupplyCap is
+// ever created by block rewards, and the reward of the block that reaches the cap is cut short. Amounts that would
+// be larger than the largest int are capped at it. Some common schedules, with reward set to 50, are:
+//
+//	Default:        RewardSchedule{}
+//	Halving:        RewardSchedule{InitialReward: &reward, HalvingInterval: 100}
+//	Tail emission:  RewardSchedule{InitialReward: &reward, HalvingInterval: 100, TailReward: 1}
+//	Capped:         RewardSchedule{SupplyCap: 1000}
+type RewardSchedule struct {
+	InitialReward   *int
+	HalvingInterval int
+	TailReward      int
+	SupplyCap       int
+}
+
+// Supply describes the currency in existence once a block has been added to the chain. Allocated is the currency that
+// the genesis block allocates, and block rewards create the rest. An account that only appears on the chain holds
+// nothing, so it adds to Accounts but not to the supply. Slashed stake that isn't paid to the producer that recorded
+// the slashing is Burned, and no longer circulates
+type Supply struct {
+	Height      int `json:"height"`
+	Accounts    int `json:"accounts"`
+	Allocated   int `json:"allocated"`
+	Minted      int `json:"minted"`
+	Burned      int `json:"burned"`
+	Circulating int `json:"circulating"`
+}
+
+// Reward returns the block reward of the block at the passed height, which doesn't include the block's fees
+func (r RewardSchedule) Reward(height int) int {
+	if height < 1 {
+		return 0
+	}
+	return r.Minted(height) - r.Minted(height-1)
+}
+
+// Minted returns the currency created by the block rewards of every block up to and including the passed height
+func (r RewardSchedule) Minted(height int) int {
+
+	minted := 0
+	for start := 1; start <= height; {
+
+		// Every block of a halving period has the same reward
+		end := height
+		if r.HalvingInterval > 0 {
+			periodEnd := cappedProduct((start-1)/r.HalvingInterval+1, r.HalvingInterval)
+			if periodEnd < end {
+				end = periodEnd
+			}
+		}
+
+		reward := r.scheduledReward(start)
+		if reward == 0 {
+			// Rewards never rise again once they reach 0
+			break
+		}
+
+		minted = cappedSum(minted, cappedProduct(reward, end-start+1))
+		if r.SupplyCap > 0 && minted >= r.SupplyCap {
+			return r.SupplyCap
+		}
+
+		if end == math.MaxInt {
+			break
+		}
+		start = end + 1
+	}
+
+	return minted
+}
+
+// MaxSupply returns the most currency that block rewards will ever create, and false if there is no limit
+func (r RewardSchedule) MaxSupply() (int, bool) {
+
+	if r.SupplyCap > 0 {
+		return r.SupplyCap, true
+	}
+
+	if r.HalvingInterval > 0 && r.TailReward == 0 {
+		// The reward is 0 after at most 63 halvings
+		return r.Minted(cappedProduct(64, r.HalvingInterval)), true
+	}
+
+	return 0, false
+}
+
+// Validate returns an error if the schedule's values can't be used
+func (r RewardSchedule) Validate() error {
+	if r.initialReward() < 0 || r.HalvingInterval < 0 || r.TailReward < 0 || r.SupplyCap < 0 {
+		return errors.New("reward schedule values must not be negative")
+	}
+	return nil
+}
+
+// String describes the schedule for people
+func (r RewardSchedule) String() string {
+
+	description := fmt.Sprintf("initial reward %d", r.initialReward())
+	if r.HalvingInterval > 0 {
+		description += fmt.Sprintf(", halving every %d blocks", r.HalvingInterval)
+	}
+	if r.TailReward > 0 {
+		description += fmt.Sprintf(", tail reward %d", r.TailReward)
+	}
+	if r.SupplyCap > 0 {
+		description += fmt.Sprintf(", supply cap %d", r.SupplyCap)
+	}
+
+	return description
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// initialReward returns the reward of the first block, which is REWARD_AMOUNT unless the schedule sets one
+func (r RewardSchedule) initialReward() int {
+	if r.InitialReward == nil {
+		return REWARD_AMOUNT
+	}
+	return *r.InitialReward
+}
+
+// scheduledReward returns the reward of the block at the passed height before the supply cap is applied
+func (r RewardSchedule) scheduledReward(height int) int {
+
+	reward := r.initialReward()
+	if r.HalvingInterval > 0 {
+		halvings := (height - 1) / r.HalvingInterval
+		if halvings >= 63 {
+			reward = 0
+		} else {
+			reward >>= uint(halvings)
+		}
+	}
+
+	if reward < r.TailReward {
+		reward = r.TailReward
+	}
+
+	return reward
+}
+
+// cappedSum returns the sum of two amounts that aren't negative, or the largest int if the sum is larger
+func cappedSum(a int, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// cappedProduct returns the product of two amounts that aren't negative, or the largest int if the product is larger
+func cappedProduct(a int, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// SupplyAt returns the supply of currency once the block at the passed height of the chain was added, by replaying
+// the chain up to that block
+func SupplyAt(chain []Block, height int) (Supply, error) {
+
+	if height < 0 || height >= len(chain) {
+		return Supply{}, fmt.Errorf("height must be between 0 and %d", len(chain)-1)
+	}
+
+	ledger := NewLedger()
+	ledger.Replay(chain[:height+1])
+
+	return ledger.Supply(), nil
+}
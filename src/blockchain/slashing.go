@@ -0,0 +1,316 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ============================ Slashing ============================
+
+// OFFENCE_DOUBLE_SIGN, OFFENCE_INVALID_BLOCK and OFFENCE_MISSED_SLOT are the offences a proof of stake validator can
+// be slashed for: signing two different blocks at the same height, signing a block that breaks the rules that every
+// peer checks, and being elected to produce a block without the block making it onto the chain
+const (
+	OFFENCE_DOUBLE_SIGN   = "doubleSign"
+	OFFENCE_INVALID_BLOCK = "invalidBlock"
+	OFFENCE_MISSED_SLOT   = "missedSlot"
+)
+
+// SLASH_DOUBLE_SIGN_PERCENT, SLASH_INVALID_BLOCK_PERCENT and SLASH_MISSED_SLOT_PERCENT are the percentages of an
+// offender's bonded and unbonding stake that each offence costs, rounded down but never less than 1. Of the penalty,
+// SLASH_REPORTER_PERCENT is paid to the producer of the block that records the evidence, and the rest is burned
+const (
+	SLASH_DOUBLE_SIGN_PERCENT   = 50
+	SLASH_INVALID_BLOCK_PERCENT = 20
+	SLASH_MISSED_SLOT_PERCENT   = 5
+	SLASH_REPORTER_PERCENT      = 50
+)
+
+// Slashing is recorded on the chain like any other payload. Anyone who sees an offence can submit SlashingEvidence,
+// which carries everything needed to prove it, to the Middleware, and the producer of the next block records it.
+// Every peer checks the evidence itself before it accepts the block, and applies the penalty to its Ledger:
+//
+//   - Double signing is proven by two headers with the same height and the same producer, but different hashes, that
+//     are both signed by the producer
+//   - An invalid block is proven by the block itself, signed by its producer, as long as what is wrong with it can be
+//     seen without the chain, such as a bad coinbase, payload, transaction signature or election
+//   - A missed slot is proven by the round of the election that the offender won. The block of a later round of the
+//     same election records the missed slot of every earlier round's leader, right after the election
+//
+// Evidence is only accepted while the offender's stake can't have been spent, which is for UNBONDING_PERIOD blocks
+// after the offence, and each offence is only slashed once. As a block can be both invalid and miss its slot, both
+// can be slashed.
+
+// =========== SlashingEvidence ===========
+
+// SlashingEvidence is a type of Data that proves a validator's Offence. Which of Headers, Block or Election is set
+// depends on the Offence, see the constructors
+type SlashingEvidence struct {
+	Offence  string        `json:"offence"`
+	Headers  []BlockHeader `json:"headers,omitempty"`
+	Block    *Block        `json:"block,omitempty"`
+	Election *Election     `json:"election,omitempty"`
+}
+
+// GetData is the interface method that is required to retrieve Data object
+func (e SlashingEvidence) GetData() Data {
+	return e
+}
+
+// GetType is the interface method that is required to retrieve the tag that the Data object's decoder is registered with
+func (e SlashingEvidence) GetType() string {
+	return "slashingEvidence"
+}
+
+// ToString is the interface method that is required to transform the Data object into a string for communication
+func (e SlashingEvidence) ToString() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return string(b)
+}
+
+// Register the decoder for the Data object and the commands whose messages carry it, and allow it to be carried in
+// blocks
+func init() {
+	RegisterDataType(SlashingEvidence{}.GetType(), func(raw json.RawMessage) (Data, error) {
+		var e SlashingEvidence
+		err := json.Unmarshal(raw, &e)
+		return e, err
+	})
+
+	RegisterCommand("EVIDENCE", SlashingEvidence{}.GetType())
+
+	RegisterPayloadType(SlashingEvidence{}.GetType(), func(d Data) error {
+		return d.(SlashingEvidence).Verify()
+	}, canonicalSlashingEvidence)
+}
+
+// NewDoubleSignEvidence returns the evidence that the producer of two headers signed both of them at the same height
+func NewDoubleSignEvidence(a BlockHeader, b BlockHeader) (SlashingEvidence, error) {
+	e := SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{a, b}}
+	return e, e.Verify()
+}
+
+// NewInvalidBlockEvidence returns the evidence that the producer of a block signed it although it is invalid
+func NewInvalidBlockEvidence(b Block) (SlashingEvidence, error) {
+	e := SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK, Block: &b}
+	return e, e.Verify()
+}
+
+// NewMissedSlotEvidence returns the evidence that the leader of an election was elected to produce a block
+func NewMissedSlotEvidence(election Election) (SlashingEvidence, error) {
+	e := SlashingEvidence{Offence: OFFENCE_MISSED_SLOT, Election: &election}
+	return e, e.Verify()
+}
+
+// Verify checks everything about the evidence that can be checked without the chain, which is that it proves its
+// Offence was committed by its Offender. A missed slot also has to be checked against the chain, see Ledger.CheckEvidence
+func (e SlashingEvidence) Verify() error {
+
+	switch e.Offence {
+	case OFFENCE_DOUBLE_SIGN:
+		if len(e.Headers) != 2 || e.Block != nil || e.Election != nil {
+			return errors.New("evidence of double signing must hold exactly two headers")
+		}
+
+		a, b := e.Headers[0], e.Headers[1]
+		if a.Index < 1 || a.Index != b.Index || a.Miner != b.Miner {
+			return errors.New("headers must be from the same producer at the same height")
+		}
+
+		if signedHash(a) == signedHash(b) {
+			return errors.New("headers are the same block")
+		}
+
+		for i, h := range e.Headers {
+			err := VerifyBlockSignature(Block{BlockHeader: h, Hash: signedHash(h)})
+			if err != nil {
+				return fmt.Errorf("header %d is not signed by its producer: %v", i, err)
+			}
+		}
+	case OFFENCE_INVALID_BLOCK:
+		if e.Block == nil || len(e.Headers) != 0 || e.Election != nil {
+			return errors.New("evidence of an invalid block must hold the block")
+		}
+
+		b := *e.Block
+		if b.Index < 1 {
+			return errors.New("the genesis block can't be invalid")
+		}
+
+		// The producer only signs the Merkle root, so data that doesn't match it wasn't signed by the producer
+		if b.MerkleRoot != MerkleRoot(b.Data) {
+			return errors.New("block data does not match the signed merkle root")
+		}
+
+		b.Hash = signedHash(b.BlockHeader)
+		err := VerifyBlockSignature(b)
+		if err != nil {
+			return fmt.Errorf("block is not signed by its producer: %v", err)
+		}
+
+		if blockFault(b) == nil {
+			return errors.New("block is valid")
+		}
+	case OFFENCE_MISSED_SLOT:
+		if e.Election == nil || len(e.Headers) != 0 || e.Block != nil {
+			return errors.New("evidence of a missed slot must hold the election")
+		}
+
+		err := ValidatePayload(*e.Election)
+		if err != nil {
+			return err
+		}
+
+		err = checkElectionEntries(*e.Election)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("offence %q is not supported", e.Offence)
+	}
+
+	return nil
+}
+
+// Offender returns the address of the validator that committed the offence, or an empty string if the evidence is
+// malformed
+func (e SlashingEvidence) Offender() string {
+
+	switch {
+	case e.Offence == OFFENCE_DOUBLE_SIGN && len(e.Headers) > 0:
+		return e.Headers[0].Miner
+	case e.Offence == OFFENCE_INVALID_BLOCK && e.Block != nil:
+		return e.Block.Miner
+	case e.Offence == OFFENCE_MISSED_SLOT && e.Election != nil:
+		leader, err := e.Election.Leader()
+		if err == nil {
+			return leader
+		}
+	}
+
+	return ""
+}
+
+// Height returns the height of the block that the offence was committed for, or -1 if the evidence is malformed
+func (e SlashingEvidence) Height() int {
+
+	switch {
+	case e.Offence == OFFENCE_DOUBLE_SIGN && len(e.Headers) > 0:
+		return e.Headers[0].Index
+	case e.Offence == OFFENCE_INVALID_BLOCK && e.Block != nil:
+		return e.Block.Index
+	case e.Offence == OFFENCE_MISSED_SLOT && e.Election != nil:
+		return e.Election.Height
+	}
+
+	return -1
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// key identifies the offence that the evidence proves, so that it is only slashed once however many times it is
+// proven. A validator whose block is rejected doesn't take part in the later rounds of the election, so it can only
+// miss one slot at each height
+func (e SlashingEvidence) key() string {
+	return e.Offence + "|" + e.Offender() + "|" + strconv.Itoa(e.Height())
+}
+
+// slashPercent returns the percentage of the offender's stake that the offence costs
+func slashPercent(offence string) int {
+	switch offence {
+	case OFFENCE_DOUBLE_SIGN:
+		return SLASH_DOUBLE_SIGN_PERCENT
+	case OFFENCE_INVALID_BLOCK:
+		return SLASH_INVALID_BLOCK_PERCENT
+	case OFFENCE_MISSED_SLOT:
+		return SLASH_MISSED_SLOT_PERCENT
+	}
+	return 0
+}
+
+// signedHash returns the hash of a header that its producer's signature is made over, which is how proof of stake
+// hashes its blocks
+func signedHash(h BlockHeader) string {
+	return (&ProofOfStake{}).CalculateHash(Block{BlockHeader: h})
+}
+
+// blockFault returns what is wrong with a block that can be seen without the chain it was produced for, or nil if
+// nothing is. Whether the coinbase pays the right reward depends on the reward schedule, so only the fees are checked
+func blockFault(b Block) error {
+
+	err := checkDistinctEntries(b.Data)
+	if err != nil {
+		return err
+	}
+
+	err = checkCoinbase(b, nil)
+	if err != nil {
+		return err
+	}
+
+	for i, d := range b.Data {
+		err = ValidatePayload(d)
+		if err != nil {
+			return fmt.Errorf("data entry %d is invalid: %v", i, err)
+		}
+
+		transaction, ok := d.(Transaction)
+		if ok && VerifyTransaction(transaction) != nil {
+			return fmt.Errorf("signature of transaction %d is invalid", i)
+		}
+	}
+
+	return checkElection(b)
+}
+
+// blockWatcher remembers the signed headers it has seen, so that a producer that signs two blocks at the same
+// height is caught
+type blockWatcher struct {
+	headers map[string]BlockHeader
+	mutex   sync.Mutex
+}
+
+// newBlockWatcher creates and returns a blockWatcher that hasn't seen any headers
+func newBlockWatcher() *blockWatcher {
+	return &blockWatcher{headers: make(map[string]BlockHeader)}
+}
+
+// observe records a signed header and returns the evidence of double signing if its producer already signed a
+// different header at the same height. Headers that aren't signed by their producer are ignored, and headers more
+// than UNBONDING_PERIOD blocks older than the passed one are forgotten, as they can no longer be slashed
+func (w *blockWatcher) observe(h BlockHeader) (SlashingEvidence, bool) {
+
+	if VerifyBlockSignature(Block{BlockHeader: h, Hash: signedHash(h)}) != nil {
+		return SlashingEvidence{}, false
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for key, seen := range w.headers {
+		if h.Index-seen.Index > UNBONDING_PERIOD {
+			delete(w.headers, key)
+		}
+	}
+
+	key := strconv.Itoa(h.Index) + "|" + h.Miner
+	seen, ok := w.headers[key]
+	if !ok {
+		w.headers[key] = h
+		return SlashingEvidence{}, false
+	}
+
+	evidence, err := NewDoubleSignEvidence(seen, h)
+	if err != nil {
+		return SlashingEvidence{}, false
+	}
+
+	return evidence, true
+}
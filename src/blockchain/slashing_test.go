@@ -0,0 +1,280 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// doubleSigned returns two different headers that the wallet signed for the block at height 2
+func (w wallet) doubleSigned(t *testing.T) (BlockHeader, BlockHeader) {
+	return w.produce(t, Note{Text: "one"}).BlockHeader, w.produce(t, Note{Text: "two"}).BlockHeader
+}
+
+// offenceBy returns evidence of the offence committed by the wallet for the block at height 2, which only holds what
+// the Ledger reads from it
+func offenceBy(t *testing.T, w wallet, offence string, stake int) SlashingEvidence {
+	switch offence {
+	case OFFENCE_DOUBLE_SIGN:
+		return SlashingEvidence{Offence: offence, Headers: []BlockHeader{{Index: 2, Miner: w.address}, {Index: 2, Miner: w.address}}}
+	case OFFENCE_INVALID_BLOCK:
+		return SlashingEvidence{Offence: offence, Block: &Block{BlockHeader: BlockHeader{Index: 2, Miner: w.address}}}
+	}
+
+	election := newElection(0, w.enter(t, stake))
+	return SlashingEvidence{Offence: offence, Election: &election}
+}
+
+// recordEvidence applies the block at the passed height, produced by the reporter, that records the evidence
+func recordEvidence(l *Ledger, height int, reporter wallet, evidence ...Data) {
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: height, Miner: reporter.address}, Data: evidence})
+}
+
+func TestSlashingEvidenceProvesOffence(t *testing.T) {
+
+	a, b := newWallet(t), newWallet(t)
+
+	first, second := a.doubleSigned(t)
+	later := a.produceAt(t, 3, parent, Note{Text: "three"}).BlockHeader
+	others, _ := b.doubleSigned(t)
+	changed := second
+	changed.Timestamp = "changed"
+
+	election := newElection(0, a.enter(t, 10))
+	invalid := a.produce(t, Note{Text: "no election"})
+	valid := a.produce(t, election)
+	swapped := invalid
+	swapped.Data = valid.Data
+	notSigned := invalid
+	notSigned.Miner = b.address
+	genesis := invalid
+	genesis.Index = 0
+
+	voters := newElection(1, a.enter(t, 10), b.enter(t, 10))
+	missed := missedSlots(t, voters)[0].(SlashingEvidence)
+	wrongSecret := newElection(0, a.enter(t, 10))
+	wrongSecret.Entries[0].Secret = "secret"
+
+	tests := []struct {
+		name     string
+		evidence SlashingEvidence
+		valid    bool
+	}{
+		{"two headers signed at the same height", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, second}}, true},
+		{"same header twice", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, first}}, false},
+		{"headers at different heights", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, later}}, false},
+		{"headers of different producers", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, others}}, false},
+		{"header changed after it was signed", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, changed}}, false},
+		{"one header", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first}}, false},
+		{"headers along with a block", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, second}, Block: &invalid}, false},
+		{"signed block without an election", SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK, Block: &invalid}, true},
+		{"valid block", SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK, Block: &valid}, false},
+		{"block data that wasn't signed", SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK, Block: &swapped}, false},
+		{"block that isn't signed by its producer", SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK, Block: &notSigned}, false},
+		{"genesis block", SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK, Block: &genesis}, false},
+		{"no block", SlashingEvidence{Offence: OFFENCE_INVALID_BLOCK}, false},
+		{"missed slot of an earlier round", missed, true},
+		{"missed slot of an election with a wrong secret", SlashingEvidence{Offence: OFFENCE_MISSED_SLOT, Election: &wrongSecret}, false},
+		{"no election", SlashingEvidence{Offence: OFFENCE_MISSED_SLOT}, false},
+		{"unknown offence", SlashingEvidence{Offence: "lateBlock", Block: &invalid}, false},
+	}
+
+	for _, test := range tests {
+		err := test.evidence.Verify()
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+
+	if missed.Offender() == "" || missed.Offender() == leaderOf(t, voters, a, b).address {
+		t.Error("missed slot isn't the offence of the first round's leader")
+	}
+	if e := (SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, second}}); e.Offender() != a.address || e.Height() != 2 {
+		t.Errorf("double signing is the offence of %s at height %d", e.Offender(), e.Height())
+	}
+}
+
+func TestLedgerSlashesOffenders(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		offence string
+		stake   int
+		penalty int
+	}{
+		{"double signing", OFFENCE_DOUBLE_SIGN, 50, 25},
+		{"invalid block", OFFENCE_INVALID_BLOCK, 30, 6},
+		{"missed slot", OFFENCE_MISSED_SLOT, 40, 2},
+		{"missed slot of a small stake", OFFENCE_MISSED_SLOT, 10, 1},
+	}
+
+	for _, test := range tests {
+		offender, reporter := newWallet(t), newWallet(t)
+		l := validatorLedger([]wallet{offender, reporter}, []int{test.stake, 10})
+
+		recordEvidence(l, 2, reporter, offenceBy(t, offender, test.offence, test.stake))
+
+		// The producer that records the evidence is paid half of the penalty, and the rest is burned
+		reward := test.penalty * SLASH_REPORTER_PERCENT / 100
+		if l.Stake(offender.address) != test.stake-test.penalty {
+			t.Errorf("%s: stake of %d was slashed to %d, expected a penalty of %d", test.name, test.stake, l.Stake(offender.address), test.penalty)
+		}
+		if l.Balance(offender.address) != 100-test.stake {
+			t.Errorf("%s: spendable balance of the offender changed to %d", test.name, l.Balance(offender.address))
+		}
+		if l.Balance(reporter.address) != 90+reward {
+			t.Errorf("%s: reporter was paid %d, expected %d", test.name, l.Balance(reporter.address)-90, reward)
+		}
+		if l.Supply().Burned != test.penalty-reward {
+			t.Errorf("%s: %d was burned, expected %d", test.name, l.Supply().Burned, test.penalty-reward)
+		}
+	}
+}
+
+func TestLedgerSlashesUnbondingStake(t *testing.T) {
+
+	offender, reporter := newWallet(t), newWallet(t)
+	l := validatorLedger([]wallet{offender, reporter}, []int{40, 10})
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 2}, Data: []Data{Transaction{Kind: TRANSACTION_UNSTAKE, From: offender.address, Amount: 30, Nonce: 1}}})
+
+	// Half of the 40 the offender had bonded before unbonding is taken, first from what is still bonded
+	recordEvidence(l, 3, reporter, offenceBy(t, offender, OFFENCE_DOUBLE_SIGN, 0))
+
+	v := l.Validator(offender.address)
+	if v.Stake != 0 || len(v.Unbonding) != 1 || v.Unbonding[0].Amount != 20 {
+		t.Errorf("stake was slashed to %+v, expected 20 unbonding", v)
+	}
+
+	// What is left of the unbonding stake is still released when its lock-up ends
+	for height := 4; height <= 2+UNBONDING_PERIOD; height++ {
+		l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: height}})
+	}
+	if l.Balance(offender.address) != 80 {
+		t.Errorf("balance is %d after the unbonding stake was released, expected 80", l.Balance(offender.address))
+	}
+}
+
+func TestLedgerCheckEvidence(t *testing.T) {
+
+	a, b, outsider := newWallet(t), newWallet(t), newWallet(t)
+	l := validatorLedger([]wallet{a, b}, []int{20, 20})
+
+	// The next block is at height 2, where a double signed
+	doubleSign := offenceBy(t, a, OFFENCE_DOUBLE_SIGN, 0)
+	ahead := doubleSign
+	ahead.Headers = []BlockHeader{{Index: 3, Miner: a.address}, {Index: 3, Miner: a.address}}
+
+	tests := []struct {
+		name     string
+		evidence SlashingEvidence
+		valid    bool
+	}{
+		{"offence at the next height", doubleSign, true},
+		{"offence of a validator that hasn't happened yet", ahead, false},
+		{"offence of an account without stake", offenceBy(t, outsider, OFFENCE_DOUBLE_SIGN, 0), false},
+		{"missed slot for the next block", offenceBy(t, a, OFFENCE_MISSED_SLOT, 20), false},
+		{"evidence without an offender", SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN}, false},
+	}
+
+	for _, test := range tests {
+		err := l.CheckEvidence(test.evidence)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+
+	recordEvidence(l, 2, b, doubleSign)
+	if l.CheckEvidence(doubleSign) == nil {
+		t.Error("offence was accepted after it was slashed")
+	}
+
+	// Evidence can be recorded for UNBONDING_PERIOD blocks after the offence, while the offender's stake is locked
+	other := offenceBy(t, b, OFFENCE_INVALID_BLOCK, 0)
+	for height := 3; height < 2+UNBONDING_PERIOD; height++ {
+		l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: height}})
+	}
+	if err := l.CheckEvidence(other); err != nil {
+		t.Errorf("offence was refused in the last block that can record it: %v", err)
+	}
+
+	l.ApplyBlock(Block{BlockHeader: BlockHeader{Index: 2 + UNBONDING_PERIOD}})
+	if l.CheckEvidence(other) == nil {
+		t.Error("offence was accepted after the offender's stake could have been spent")
+	}
+}
+
+func TestLedgerCheckSlashing(t *testing.T) {
+
+	a, b, c := newWallet(t), newWallet(t), newWallet(t)
+	wallets := []wallet{a, b, c}
+
+	second := newElection(1, a.enter(t, 10), b.enter(t, 10), c.enter(t, 10))
+	missed := missedSlots(t, second)
+	leader := leaderOf(t, second, wallets...)
+
+	third := newElection(2, a.enter(t, 10), b.enter(t, 10), c.enter(t, 10))
+	thirdLeader := leaderOf(t, third, wallets...)
+	thirdMissed := missedSlots(t, third)
+
+	other := newElection(1, a.enter(t, 10), b.enter(t, 10), c.enter(t, 10))
+
+	first, firstAgain := a.doubleSigned(t)
+	doubleSign := SlashingEvidence{Offence: OFFENCE_DOUBLE_SIGN, Headers: []BlockHeader{first, firstAgain}}
+
+	tests := []struct {
+		name  string
+		block Block
+		valid bool
+	}{
+		{"later round with its missed slot", leader.produce(t, append([]Data{second}, missed...)...), true},
+		{"later round without its missed slot", leader.produce(t, second), false},
+		{"later round with its missed slots", thirdLeader.produce(t, append([]Data{third}, thirdMissed...)...), true},
+		{"same missed slot twice", thirdLeader.produce(t, third, thirdMissed[0], thirdMissed[0]), false},
+		{"missed slot of another election", leader.produce(t, append([]Data{second}, missedSlots(t, other)...)...), false},
+		{"double signing", leader.produce(t, second, missed[0], doubleSign), true},
+		{"double signing twice", leader.produce(t, second, missed[0], doubleSign, doubleSign), false},
+	}
+
+	for _, test := range tests {
+		l := validatorLedger(wallets, []int{10, 10, 10})
+
+		err := l.CheckSlashing(test.block)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+
+		// Checking the block doesn't slash anyone
+		for _, w := range wallets {
+			if l.Stake(w.address) != 10 {
+				t.Errorf("%s: stake of %s changed to %d", test.name, w.address, l.Stake(w.address))
+			}
+		}
+	}
+}
+
+func TestBlockWatcherCatchesDoubleSigning(t *testing.T) {
+
+	a, b := newWallet(t), newWallet(t)
+	first, second := a.doubleSigned(t)
+	others, _ := b.doubleSigned(t)
+	unsigned := second
+	unsigned.Timestamp = "changed"
+
+	w := newBlockWatcher()
+	for _, h := range []BlockHeader{first, first, others, unsigned} {
+		if _, caught := w.observe(h); caught {
+			t.Fatalf("header at height %d of %s was reported without a second header", h.Index, h.Miner)
+		}
+	}
+
+	evidence, caught := w.observe(second)
+	if !caught || evidence.Verify() != nil || evidence.Offender() != a.address {
+		t.Errorf("double signing wasn't reported: %+v", evidence)
+	}
+
+	// Headers that can no longer be slashed are forgotten
+	w = newBlockWatcher()
+	w.observe(first)
+	w.observe(b.produceAt(t, 3+UNBONDING_PERIOD, parent, Note{Text: "later"}).BlockHeader)
+	if _, caught := w.observe(second); caught {
+		t.Error("double signing was reported after the first header was forgotten")
+	}
+}
@@ -0,0 +1,61 @@
+package blockchain
+
+import (
+	"fmt"
+)
+
+// ============================ Staking ============================
+
+// TRANSACTION_STAKE and TRANSACTION_UNSTAKE are the kinds of transaction that bond and unbond stake. Bonding moves
+// the Amount out of the sender's spendable balance into its stake, and unbonding moves it back once
+// UNBONDING_PERIOD blocks have passed. Either way, the Fee is paid from the spendable balance
+const (
+	TRANSACTION_STAKE   = "stake"
+	TRANSACTION_UNSTAKE = "unstake"
+)
+
+// UNBONDING_PERIOD is the number of blocks that unbonded stake stays locked before it can be spent again, so that
+// a validator can't escape the consequences of blocks it produced by withdrawing its stake right away. It is longer
+// than DEFAULT_FINALITY_DEPTH, so stake stays locked until the blocks it was bonded for are final
+const UNBONDING_PERIOD = 10
+
+// Every address with bonded stake is a validator, which may enter the election of each proof of stake block with
+// exactly its bonded stake, see Ledger.CheckElectionStake. The validator set is derived from the chain alone, so
+// every peer agrees on it. Until the first stake is bonded there are no validators, and any address may enter an
+// election with a stake of up to its balance, so that a new network can produce the blocks that bond its first stake.
+
+// Unbonding is stake that was unbonded and becomes spendable once the block at ReleaseHeight is added to the chain
+type Unbonding struct {
+	Amount        int `json:"amount"`
+	ReleaseHeight int `json:"releaseHeight"`
+}
+
+// Validator describes the stake of an address according to the chain. Stake is the bonded stake that counts in
+// elections, and Unbonding lists the stake that is waiting to become spendable
+type Validator struct {
+	Address   string      `json:"address"`
+	Stake     int         `json:"stake"`
+	Unbonding []Unbonding `json:"unbonding"`
+}
+
+// String describes the validator for people
+func (v Validator) String() string {
+
+	unbonding := 0
+	for _, u := range v.Unbonding {
+		unbonding += u.Amount
+	}
+
+	return fmt.Sprintf("address=%s, stake=%d, unbonding=%d", v.Address, v.Stake, unbonding)
+}
+
+// ==================== Non-interface, helper methods ========================
+
+// cost returns the amount that the transaction takes out of its sender's spendable balance, including its fee.
+// Unbonded stake is taken out of the sender's stake instead, so only the fee is spent
+func (t Transaction) cost() int {
+	if t.Kind == TRANSACTION_UNSTAKE {
+		return t.Fee
+	}
+	return t.Amount + t.Fee
+}
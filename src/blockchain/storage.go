@@ -0,0 +1,265 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ============================ Storage ============================
+
+const (
+	blockFileName = "blocks.dat"
+
+	// Every record in the block file is a 4 byte length and a 32 byte SHA-256 checksum followed by the JSON encoded block
+	recordHeaderSize = 4 + sha256.Size
+)
+
+// FileStorage implements StorageComponent and persists a Peer's chain to an append-only block file. A Peer always
+// loads its whole chain, so the records are read in order and no index of them is kept
+type FileStorage struct {
+	Directory string
+	mutex     sync.Mutex
+}
+
+// Initialize is the interface method that calls this component's initialize method
+func (s *FileStorage) Initialize() error {
+
+	if s.Directory == "" {
+		return errors.New("no storage directory configured")
+	}
+
+	// Create the storage directory in case this is the first time the Peer is run
+	return os.MkdirAll(s.Directory, 0755)
+}
+
+// Terminate is the interface method that calls this component's cleanup method
+func (s *FileStorage) Terminate() {
+	// No clean-up needed for this implementation, as files are only kept open while they are being written
+}
+
+// LoadChain is the interface method that reads the stored chain. Every record is checked against its checksum. If a
+// corrupt or incomplete record is found, for example because the Peer was killed in the middle of a write, the chain
+// is cut off at the last intact block and the file is rewritten to match
+func (s *FileStorage) LoadChain() ([]Block, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blockBytes, err := ioutil.ReadFile(s.blockPath())
+	if os.IsNotExist(err) {
+		// Nothing has been stored yet
+		return []Block{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	chain, err := decodeRecords(blockBytes)
+	if err != nil {
+		log.Printf("Stored chain is corrupt, keeping the first %d intact blocks: %v\n", len(chain), err)
+
+		err = s.writeChain(chain)
+		if err != nil {
+			return nil, err
+		}
+
+		return chain, nil
+	}
+
+	return chain, nil
+}
+
+// AppendBlock is the interface method that appends a single block to the end of the stored chain
+func (s *FileStorage) AppendBlock(b Block) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, err := encodeRecord(b)
+	if err != nil {
+		return err
+	}
+
+	blockFile, err := os.OpenFile(s.blockPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer blockFile.Close()
+
+	info, err := blockFile.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+
+	_, err = blockFile.Write(record)
+	if err != nil {
+		return err
+	}
+
+	err = blockFile.Sync()
+	if err != nil {
+		return err
+	}
+
+	// The first block creates the file, whose directory entry must reach the disk as well
+	if offset == 0 {
+		return syncDirectory(s.Directory)
+	}
+
+	return nil
+}
+
+// ReplaceChain is the interface method that replaces the whole stored chain with the passed chain
+func (s *FileStorage) ReplaceChain(chain []Block) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writeChain(chain)
+}
+
+// ==================== Non-interface, helper methods ========================
+
+func (s *FileStorage) blockPath() string {
+	return filepath.Join(s.Directory, blockFileName)
+}
+
+// writeChain writes the passed chain to a temporary file and then renames it over the current file, so the stored
+// chain is never left half replaced
+func (s *FileStorage) writeChain(chain []Block) error {
+
+	var blockBuffer bytes.Buffer
+	for _, b := range chain {
+		record, err := encodeRecord(b)
+		if err != nil {
+			return err
+		}
+
+		blockBuffer.Write(record)
+	}
+
+	return writeFileAtomically(s.blockPath(), blockBuffer.Bytes(), 0644)
+}
+
+// writeFileAtomically writes the data to a temporary file with the passed permissions, flushes it to disk and renames
+// it to the passed path. The directory is flushed as well, so that the rename isn't lost if the machine crashes
+func writeFileAtomically(path string, data []byte, perm os.FileMode) error {
+
+	tempPath := path + ".tmp"
+
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		return err
+	}
+
+	return syncDirectory(filepath.Dir(path))
+}
+
+// syncDirectory flushes the entries of a directory to disk, which makes the files created in it or renamed into it
+// durable
+func syncDirectory(path string) error {
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = dir.Sync()
+	closeErr := dir.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+// encodeRecord encodes a block into a length and checksum prefixed record of the block file
+func encodeRecord(b Block) ([]byte, error) {
+
+	encodedBlock, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(encodedBlock)
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(encodedBlock))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(encodedBlock)))
+	copy(record[4:recordHeaderSize], checksum[:])
+
+	return append(record, encodedBlock...), nil
+}
+
+// decodeRecords decodes every record of the block file, checking each one against its checksum. It returns the blocks
+// that were decoded before the first problem, along with an error describing it
+func decodeRecords(blockBytes []byte) ([]Block, error) {
+
+	chain := []Block{}
+	reader := bytes.NewReader(blockBytes)
+
+	for reader.Len() > 0 {
+		header := make([]byte, recordHeaderSize)
+		_, err := io.ReadFull(reader, header)
+		if err != nil {
+			return chain, fmt.Errorf("record of block %d is truncated", len(chain))
+		}
+
+		// Check the length before allocating, as a corrupt length could be huge
+		length := binary.BigEndian.Uint32(header[:4])
+		if int64(length) > int64(reader.Len()) {
+			return chain, fmt.Errorf("record of block %d is truncated", len(chain))
+		}
+
+		encodedBlock := make([]byte, length)
+		_, err = io.ReadFull(reader, encodedBlock)
+		if err != nil {
+			return chain, fmt.Errorf("record of block %d is truncated", len(chain))
+		}
+
+		checksum := sha256.Sum256(encodedBlock)
+		if !bytes.Equal(checksum[:], header[4:recordHeaderSize]) {
+			return chain, fmt.Errorf("checksum of block %d does not match", len(chain))
+		}
+
+		b, err := decodeBlock(encodedBlock)
+		if err != nil {
+			return chain, fmt.Errorf("block %d can't be decoded: %v", len(chain), err)
+		}
+
+		chain = append(chain, b)
+	}
+
+	return chain, nil
+}
+
+// decodeBlock decodes a JSON encoded block
+func decodeBlock(encodedBlock []byte) (Block, error) {
+	var b Block
+	err := json.Unmarshal(encodedBlock, &b)
+	return b, err
+}
@@ -0,0 +1,150 @@
+package blockchain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// storedBlock returns the block at the passed index, holding one note
+func storedBlock(index int) Block {
+	data := []Data{Note{Text: fmt.Sprintf("block %d", index)}}
+	return Block{BlockHeader: BlockHeader{Index: index, MerkleRoot: MerkleRoot(data)}, Data: data, Hash: fmt.Sprintf("hash %d", index)}
+}
+
+// newStorage returns a FileStorage in a new directory that holds the passed number of blocks, appended one by one
+func newStorage(t *testing.T, blocks int) *FileStorage {
+
+	s := &FileStorage{Directory: t.TempDir()}
+	err := s.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < blocks; i++ {
+		err = s.AppendBlock(storedBlock(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+// loadBlocks loads the stored chain and fails the test unless it holds the passed number of blocks, in order
+func loadBlocks(t *testing.T, name string, s *FileStorage, blocks int) {
+
+	chain, err := s.LoadChain()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	if len(chain) != blocks {
+		t.Fatalf("%s: loaded %d blocks, expected %d", name, len(chain), blocks)
+	}
+
+	for i, b := range chain {
+		expected := storedBlock(i)
+		if b.Index != i || b.Hash != expected.Hash || len(b.Data) != 1 || LeafHash(b.Data[0]) != LeafHash(expected.Data[0]) {
+			t.Errorf("%s: block %d was loaded as %+v", name, i, b)
+		}
+	}
+}
+
+func TestFileStorageLoadsStoredChain(t *testing.T) {
+
+	s := newStorage(t, 0)
+	loadBlocks(t, "nothing stored", s, 0)
+
+	s = newStorage(t, 3)
+	loadBlocks(t, "appended blocks", s, 3)
+
+	err := s.ReplaceChain([]Block{storedBlock(0), storedBlock(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadBlocks(t, "replaced chain", s, 2)
+
+	err = s.AppendBlock(storedBlock(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadBlocks(t, "block appended to the replaced chain", s, 3)
+}
+
+func TestFileStorageRecoversFromDamagedTail(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		damage func(file []byte) []byte
+		intact int
+	}{
+		{"last record cut off in its header", func(f []byte) []byte { return f[:len(f)-len(lastRecord(t, f))+10] }, 2},
+		{"last record cut off in its block", func(f []byte) []byte { return f[:len(f)-10] }, 2},
+		{"last block changed", func(f []byte) []byte { f[len(f)-2] ^= 1; return f }, 2},
+		{"last checksum changed", func(f []byte) []byte { f[len(f)-len(lastRecord(t, f))+4] ^= 1; return f }, 2},
+		{"length of the last record beyond the file", func(f []byte) []byte { f[len(f)-len(lastRecord(t, f))] = 0xff; return f }, 2},
+		{"first record changed", func(f []byte) []byte { f[recordHeaderSize+1] ^= 1; return f }, 0},
+		{"partial record after the last block", func(f []byte) []byte { return append(f, 0, 0, 1) }, 3},
+	}
+
+	for _, test := range tests {
+		s := newStorage(t, 3)
+
+		path := filepath.Join(s.Directory, blockFileName)
+		file, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, test.damage(file), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The chain is cut off at the last intact block, and the file is rewritten so that it can be appended to again
+		loadBlocks(t, test.name, s, test.intact)
+
+		err = s.AppendBlock(storedBlock(test.intact))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		loadBlocks(t, test.name+", then appended to", s, test.intact+1)
+	}
+}
+
+// lastRecord returns the record of the last block in the contents of a block file
+func lastRecord(t *testing.T, file []byte) []byte {
+
+	record, err := encodeRecord(storedBlock(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(record) > len(file) {
+		t.Fatal("block file is shorter than its last record")
+	}
+
+	return record
+}
+
+func TestFileStorageNeedsDirectory(t *testing.T) {
+
+	err := (&FileStorage{}).Initialize()
+	if err == nil {
+		t.Error("storage without a directory was initialized")
+	}
+
+	// The directory is created on first use
+	dir := filepath.Join(t.TempDir(), "chaindata")
+	err = (&FileStorage{Directory: dir}).Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(dir); err != nil {
+		t.Errorf("storage directory wasn't created: %v", err)
+	}
+}
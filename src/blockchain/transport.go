@@ -0,0 +1,223 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ============================ Transports ============================
+
+const (
+	// The largest payload that fits in a single UDP datagram
+	MAX_UDP_MESSAGE_SIZE = 65507
+
+	// The largest message accepted over TCP, which is enough for chains of many thousands of blocks
+	MAX_TCP_MESSAGE_SIZE = 64 * 1024 * 1024
+
+	// How long a TCP connection may take to be opened, written to or read from
+	tcpTimeout = 10 * time.Second
+)
+
+// transport moves encoded messages between nodes on behalf of the Communicator
+type transport interface {
+	listen(bindAddress string, port int) error
+	localPort() int
+	receive(withTimeout bool) ([]byte, *net.UDPAddr, error)
+	send(encodedMessage []byte, to net.UDPAddr) error
+	close() error
+	serviceName() string
+}
+
+// newTransport returns the transport for the passed protocol name, which defaults to UDP
+func newTransport(protocol string) (transport, error) {
+	switch protocol {
+	case "", "udp":
+		return &udpTransport{}, nil
+	case "tcp":
+		return &tcpTransport{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported transport %q", protocol)
+	}
+}
+
+// =========== UDP ===========
+
+// udpTransport sends every message as a single datagram. It is lightweight, but messages larger than one datagram
+// can't be sent and lost datagrams are never noticed
+type udpTransport struct {
+	socket *net.UDPConn
+}
+
+func (u *udpTransport) listen(bindAddress string, port int) error {
+
+	// A port of 0 dynamically gets an unused port assigned, and an empty bind address listens on every interface
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(bindAddress, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+
+	u.socket, err = net.ListenUDP("udp", addr)
+	return err
+}
+
+func (u *udpTransport) localPort() int {
+	return u.socket.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (u *udpTransport) receive(withTimeout bool) ([]byte, *net.UDPAddr, error) {
+
+	buf := make([]byte, 65535)
+	if withTimeout {
+		u.socket.SetReadDeadline(time.Now().Add(1 * time.Millisecond))
+	}
+
+	// Read from the socket
+	length, source, err := u.socket.ReadFromUDP(buf)
+	if err != nil {
+		if er, ok := err.(net.Error); ok && er.Timeout() {
+			// This was a timeout error, so just return as there was nothing to be read
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return buf[:length], source, nil
+}
+
+func (u *udpTransport) send(encodedMessage []byte, to net.UDPAddr) error {
+
+	if len(encodedMessage) > MAX_UDP_MESSAGE_SIZE {
+		return fmt.Errorf("message of %d bytes doesn't fit in a UDP datagram, use the TCP transport instead", len(encodedMessage))
+	}
+
+	_, err := u.socket.WriteToUDP(encodedMessage, &to)
+	return err
+}
+
+func (u *udpTransport) close() error {
+	return u.socket.Close()
+}
+
+func (u *udpTransport) serviceName() string {
+	return "_blockchain-P2P-Network._udp"
+}
+
+// =========== TCP ===========
+
+// tcpTransport opens a new connection for every message and writes it as a length prefixed frame. TCP takes care
+// of splitting large messages up, acknowledging them and retransmitting lost packets, and a failed delivery is
+// reported back to the sender
+type tcpTransport struct {
+	listener *net.TCPListener
+}
+
+func (t *tcpTransport) listen(bindAddress string, port int) error {
+
+	// A port of 0 dynamically gets an unused port assigned, and an empty bind address listens on every interface
+	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+
+	t.listener, err = net.ListenTCP("tcp", addr)
+	return err
+}
+
+func (t *tcpTransport) localPort() int {
+	return t.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (t *tcpTransport) receive(withTimeout bool) ([]byte, *net.UDPAddr, error) {
+
+	if withTimeout {
+		t.listener.SetDeadline(time.Now().Add(1 * time.Millisecond))
+	} else {
+		t.listener.SetDeadline(time.Time{})
+	}
+
+	conn, err := t.listener.AcceptTCP()
+	if err != nil {
+		if er, ok := err.(net.Error); ok && er.Timeout() {
+			// This was a timeout error, so just return as there was nothing to be read
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(tcpTimeout))
+
+	// A connection that doesn't deliver a whole message, such as a port scan, an early disconnect or a slow sender, is
+	// dropped. Only a failure of the listener itself is returned as an error
+	encodedMessage, err := readFrame(conn)
+	if err != nil {
+		log.Printf("Dropping connection from %s: %v\n", conn.RemoteAddr().String(), err)
+		return nil, nil, nil
+	}
+
+	// The connection was opened from a port of the sender's choosing rather than the one it listens on
+	remote := conn.RemoteAddr().(*net.TCPAddr)
+
+	return encodedMessage, &net.UDPAddr{IP: remote.IP, Zone: remote.Zone}, nil
+}
+
+func (t *tcpTransport) send(encodedMessage []byte, to net.UDPAddr) error {
+
+	if len(encodedMessage) > MAX_TCP_MESSAGE_SIZE {
+		return errors.New("message is larger than the maximum TCP message size")
+	}
+
+	// PeerAddress holds a UDPAddr, but it is only used as an IP and port pair
+	conn, err := net.DialTimeout("tcp", (&net.TCPAddr{IP: to.IP, Port: to.Port, Zone: to.Zone}).String(), tcpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(tcpTimeout))
+
+	frame := make([]byte, 4, 4+len(encodedMessage))
+	binary.BigEndian.PutUint32(frame, uint32(len(encodedMessage)))
+	frame = append(frame, encodedMessage...)
+
+	_, err = conn.Write(frame)
+	return err
+}
+
+func (t *tcpTransport) close() error {
+	return t.listener.Close()
+}
+
+func (t *tcpTransport) serviceName() string {
+	return "_blockchain-P2P-Network._tcp"
+}
+
+// readFrame reads a length prefixed message from a connection
+func readFrame(conn net.Conn) ([]byte, error) {
+
+	// Read the length prefix, then the message itself
+	prefix := make([]byte, 4)
+	_, err := io.ReadFull(conn, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error reading message length: %v", err)
+	}
+
+	length := binary.BigEndian.Uint32(prefix)
+	if length > MAX_TCP_MESSAGE_SIZE {
+		return nil, fmt.Errorf("message of %d bytes is larger than the maximum of %d", length, MAX_TCP_MESSAGE_SIZE)
+	}
+
+	encodedMessage := make([]byte, length)
+	_, err = io.ReadFull(conn, encodedMessage)
+	if err != nil {
+		return nil, fmt.Errorf("error reading message: %v", err)
+	}
+
+	return encodedMessage, nil
+}
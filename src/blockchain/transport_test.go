@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// listenOnLoopback returns a transport for the protocol that listens on a free port of the loopback interface
+func listenOnLoopback(t *testing.T, protocol string) (transport, net.UDPAddr) {
+
+	tr, err := newTransport(protocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tr.listen("127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tr.close() })
+
+	return tr, net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tr.localPort()}
+}
+
+// frame returns the message with the passed length prefix
+func frame(length uint32, message []byte) []byte {
+	prefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(prefix, length)
+	return append(prefix, message...)
+}
+
+func TestTCPTransportDeliversMessagesOfAnySize(t *testing.T) {
+
+	receiver, addr := listenOnLoopback(t, "tcp")
+	sender, _ := listenOnLoopback(t, "tcp")
+
+	for _, size := range []int{0, 1, MAX_UDP_MESSAGE_SIZE + 1, 1 << 20} {
+		message := bytes.Repeat([]byte{byte(size)}, size)
+
+		sent := make(chan error)
+		go func() { sent <- sender.send(message, addr) }()
+
+		received, source, err := receiver.receive(false)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if err = <-sent; err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(received, message) {
+			t.Errorf("%d bytes: received %d different bytes", size, len(received))
+		}
+
+		// The connection comes from a port of the sender's choosing, so only the IP address is known
+		if source == nil || !source.IP.Equal(addr.IP) || source.Port != 0 {
+			t.Errorf("%d bytes: message came from %v", size, source)
+		}
+	}
+
+	err := sender.send(make([]byte, MAX_TCP_MESSAGE_SIZE+1), addr)
+	if err == nil {
+		t.Error("message larger than the maximum was sent")
+	}
+}
+
+func TestTCPTransportDropsIncompleteFrames(t *testing.T) {
+
+	receiver, addr := listenOnLoopback(t, "tcp")
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"nothing sent", []byte{}},
+		{"partial length prefix", []byte{0, 0}},
+		{"message shorter than its length", frame(10, []byte("short"))},
+		{"length beyond the maximum", frame(MAX_TCP_MESSAGE_SIZE+1, []byte("huge"))},
+	}
+
+	for _, test := range tests {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(test.frame)
+		conn.Close()
+
+		received, _, err := receiver.receive(false)
+		if err != nil {
+			t.Fatalf("%s: the transport failed: %v", test.name, err)
+		}
+		if received != nil {
+			t.Errorf("%s: received %q", test.name, received)
+		}
+	}
+
+	// A whole frame is still received after the incomplete ones, and anything after it on the connection is ignored
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(append(frame(5, []byte("hello")), []byte("trailing")...))
+	conn.Close()
+
+	received, _, err := receiver.receive(false)
+	if err != nil || string(received) != "hello" {
+		t.Errorf("whole frame was received as %q: %v", received, err)
+	}
+}
+
+func TestUDPTransportDeliversDatagrams(t *testing.T) {
+
+	receiver, addr := listenOnLoopback(t, "udp")
+	sender, senderAddr := listenOnLoopback(t, "")
+
+	err := sender.send([]byte("hello"), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, source, err := receiver.receive(false)
+	if err != nil || string(received) != "hello" {
+		t.Fatalf("datagram was received as %q: %v", received, err)
+	}
+
+	// A datagram comes from the port the sender listens on
+	if source == nil || !source.IP.Equal(senderAddr.IP) || source.Port != senderAddr.Port {
+		t.Errorf("datagram came from %v, expected %v", source, senderAddr)
+	}
+
+	err = sender.send(make([]byte, MAX_UDP_MESSAGE_SIZE+1), addr)
+	if err == nil {
+		t.Error("message larger than a datagram was sent")
+	}
+
+	// Nothing waiting isn't an error
+	received, _, err = receiver.receive(true)
+	if received != nil || err != nil {
+		t.Errorf("receiving with nothing sent returned %q: %v", received, err)
+	}
+}
+
+func TestNewTransportRefusesUnknownProtocols(t *testing.T) {
+	_, err := newTransport("quic")
+	if err == nil {
+		t.Error("transport was created for an unknown protocol")
+	}
+}
@@ -0,0 +1,247 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// MEDIAN_TIME_BLOCKS is the number of blocks whose median timestamp a new block's timestamp must be later than.
+	// Comparing against the median rather than the previous block allows for peers whose clocks differ slightly
+	MEDIAN_TIME_BLOCKS = 11
+
+	// MAX_FUTURE_BLOCK_TIME is how far ahead of a peer's clock a block's timestamp may be
+	MAX_FUTURE_BLOCK_TIME = 2 * time.Hour
+)
+
+// ============================ Chain Validation ============================
+
+// ValidateChain walks every block of the passed chain and checks that it is a valid blockchain. The genesis block
+// must be well-formed and hold the network's allocations. Every following block must have the correct index, link to
+// the hash of the block before it, carry a plausible timestamp, carry a hash that the consensus component recomputes
+// and accepts as a valid proof, commit to its data through its Merkle root, start with a coinbase that pays exactly
+// the block reward and fees to its miner, and hold only valid payloads, with every transaction correctly signed,
+// carrying the next nonce of its sender and paid for from its sender's balance. The returned error describes the
+// first problem that was found, or is nil if the chain is valid. If no client component is passed, transaction
+// signatures aren't checked, which is only appropriate for chains whose signatures were already checked before they
+// were stored. If no consensus component is passed, hashes, proofs and block rewards aren't checked, which is only
+// appropriate for nodes such as the Middleware that don't mine and only use the chain to look up account state.
+func ValidateChain(chain []Block, consensus ConsensusComponent, client ClientComponent) error {
+
+	if len(chain) == 0 {
+		return errors.New("chain is empty")
+	}
+
+	// Every peer creates its own genesis block, so we can only check that it has the expected shape and allocations
+	genesis := chain[0]
+	err := checkGenesis(genesis)
+	if err != nil {
+		return err
+	}
+
+	// Nonces and balances depend on every transaction that came before, so the account state is rebuilt while
+	// walking the chain
+	ledger := NewLedger()
+	ledger.ApplyBlock(genesis)
+
+	// Proofs can depend on the headers before them, such as the proof of work target
+	headers := headersOf(chain)
+
+	for i := 1; i < len(chain); i++ {
+		err := validateLinkedBlock(chain[i], chain[i-1], headers[:i], consensus, client)
+		if err == nil {
+			err = validateBlockState(chain[i], ledger)
+		}
+		if err != nil {
+			return fmt.Errorf("block %d is invalid: %v", i, err)
+		}
+
+		ledger.ApplyBlock(chain[i])
+	}
+
+	return nil
+}
+
+// ValidateHeaders walks a chain of block headers, as stored by a light client, and checks that every header has the
+// correct index, links to the hash of the header before it, carries a plausible timestamp and carries a proof that the
+// consensus component accepts. The hash of every header is recomputed rather than trusted, so for proof of work a
+// header is only accepted if its recomputed hash meets the target that follows from the headers before it. The block
+// data isn't available, so transactions must be checked separately with Merkle proofs
+func ValidateHeaders(headers []BlockHeader, consensus ConsensusComponent) error {
+
+	if len(headers) == 0 {
+		return errors.New("chain of headers is empty")
+	}
+
+	err := checkGenesisHeader(headers[0])
+	if err != nil {
+		return err
+	}
+
+	prevHash := GENESIS_HASH
+	for i := 1; i < len(headers); i++ {
+		b := Block{BlockHeader: headers[i]}
+		b.Hash = consensus.CalculateHash(b)
+
+		if b.Index != i {
+			return fmt.Errorf("header %d has index %d", i, b.Index)
+		}
+
+		if b.PrevHash != prevHash {
+			return fmt.Errorf("header %d does not link to the hash of the previous header", i)
+		}
+
+		err = checkTimestamp(headers[i], headers[:i])
+		if err != nil {
+			return fmt.Errorf("header %d is invalid: %v", i, err)
+		}
+
+		if !consensus.ValidateBlock(b, headers[:i]) {
+			return fmt.Errorf("proof of header %d was rejected by the consensus component", i)
+		}
+
+		prevHash = b.Hash
+	}
+
+	return nil
+}
+
+// validateLinkedBlock checks a single block against the block that precedes it in the chain, and the headers of the
+// chain up to and including that block
+func validateLinkedBlock(b Block, prev Block, prevHeaders []BlockHeader, consensus ConsensusComponent, client ClientComponent) error {
+
+	if b.Index != prev.Index+1 {
+		return fmt.Errorf("expected index %d but found %d", prev.Index+1, b.Index)
+	}
+
+	if b.PrevHash != prev.Hash {
+		return errors.New("previous hash does not match the hash of the previous block")
+	}
+
+	err := checkTimestamp(b.BlockHeader, prevHeaders)
+	if err != nil {
+		return err
+	}
+
+	return validateBlockContents(b, prevHeaders, consensus, client)
+}
+
+// validateBlockContents checks that a block's hash, proof, Merkle root, coinbase, payloads and transaction signatures
+// are valid, and that no data entry appears twice. The headers of the chain the block extends are only passed on to
+// the consensus component
+func validateBlockContents(b Block, prevHeaders []BlockHeader, consensus ConsensusComponent, client ClientComponent) error {
+
+	if consensus != nil {
+		if b.Hash != consensus.CalculateHash(b) {
+			return errors.New("hash does not match the block header")
+		}
+
+		if !consensus.ValidateBlock(b, prevHeaders) {
+			return errors.New("proof was rejected by the consensus component")
+		}
+	}
+
+	if b.MerkleRoot != MerkleRoot(b.Data) {
+		return errors.New("merkle root does not match the block data")
+	}
+
+	err := checkDistinctEntries(b.Data)
+	if err != nil {
+		return err
+	}
+
+	// The reward schedule is a consensus rule, so without a consensus component only the fees can be checked
+	var rewards *RewardSchedule
+	if consensus != nil {
+		schedule := consensus.GetRewardSchedule()
+		rewards = &schedule
+	}
+
+	err = checkCoinbase(b, rewards)
+	if err != nil {
+		return err
+	}
+
+	for i, d := range b.Data {
+		err = ValidatePayload(d)
+		if err != nil {
+			return fmt.Errorf("data entry %d is invalid: %v", i, err)
+		}
+
+		// Only transactions move currency, so only they need to be signed
+		transaction, ok := d.(Transaction)
+		if ok && client != nil && !client.Verify(transaction) {
+			return fmt.Errorf("signature of transaction %d is invalid", i)
+		}
+	}
+
+	return nil
+}
+
+// validateBlockState checks a block against the account state of the chain before it: every transaction must carry
+// the next nonce of its sender, currency can only be transferred and bonded from spendable balances, stake can only be
+// unbonded from bonded stake, an election must have an entry for every validator, staking what the validator set
+// allows, and every piece of slashing evidence must slash an offence that hasn't been slashed yet
+func validateBlockState(b Block, ledger *Ledger) error {
+
+	err := ledger.CheckNonces(b)
+	if err != nil {
+		return err
+	}
+
+	err = ledger.CheckBalances(b)
+	if err != nil {
+		return err
+	}
+
+	err = ledger.CheckElection(b)
+	if err != nil {
+		return err
+	}
+
+	return ledger.CheckSlashing(b)
+}
+
+// checkTimestamp checks that a header's timestamp can be parsed, is later than the median timestamp of the
+// MEDIAN_TIME_BLOCKS headers before it and isn't more than MAX_FUTURE_BLOCK_TIME ahead of this peer's clock. Without
+// these limits, a miner could pick timestamps that make the proof of work target easier than it should be
+func checkTimestamp(h BlockHeader, prevHeaders []BlockHeader) error {
+
+	timestamp, err := h.Time()
+	if err != nil {
+		return fmt.Errorf("timestamp %q is not in the %s format", h.Timestamp, BLOCK_TIME_FORMAT)
+	}
+
+	if timestamp.After(time.Now().Add(MAX_FUTURE_BLOCK_TIME)) {
+		return fmt.Errorf("timestamp %s is too far in the future", h.Timestamp)
+	}
+
+	start := len(prevHeaders) - MEDIAN_TIME_BLOCKS
+	if start < 0 {
+		start = 0
+	}
+
+	times := []time.Time{}
+	for _, prev := range prevHeaders[start:] {
+		t, err := prev.Time()
+		if err != nil {
+			return fmt.Errorf("timestamp of block %d is not in the %s format", prev.Index, BLOCK_TIME_FORMAT)
+		}
+		times = append(times, t)
+	}
+
+	if len(times) == 0 {
+		return nil
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	median := times[len(times)/2]
+
+	if !timestamp.After(median) {
+		return fmt.Errorf("timestamp %s is not later than the median time of the previous blocks", h.Timestamp)
+	}
+
+	return nil
+}
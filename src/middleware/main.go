@@ -2,23 +2,96 @@ package main
 
 import (
 	"blockchain"
+	"flag"
 	"fmt"
+	"strings"
+	"time"
 )
 
 var communicator *blockchain.Communicator
+var proofOfWork *blockchain.ProofOfWork
+var proofOfStake *blockchain.ProofOfStake
+
+// The maximum number of queued entries mined into each block
+const blockSize = 10
+
+// Every node on the network must use the same transport
+var transport = flag.String("transport", "tcp", "transport that messages are sent over, either tcp or udp")
+
+// Every node on the network must be started with the same genesis allocations
+var genesisFile = flag.String("genesis", "", "JSON file listing the currency allocated to accounts in the genesis block, none if empty")
+
+// Addresses are needed when running on several machines, network namespaces or loopback aliases
+var bindAddress = flag.String("bind", "", "IPv4 or IPv6 address to listen on, every interface by default")
+var externalAddress = flag.String("external", "", "host or host:port that other nodes reach this node at, detected by default")
+
+// Seed nodes are needed on networks that block the multicast used by ZeroConf discovery
+var noZeroConf = flag.Bool("nozeroconf", false, "don't discover nodes through ZeroConf, which needs multicast")
+var seeds = flag.String("seeds", "", "comma separated host:port addresses of nodes to join the network through")
+
+// Entries wait in the mempool until they are mined, highest fee first
+var mempoolSize = flag.Int("mempoolsize", blockchain.DEFAULT_MEMPOOL_SIZE, "maximum number of entries waiting to be mined")
+var mempoolExpiry = flag.Duration("mempoolexpiry", blockchain.DEFAULT_MEMPOOL_EXPIRY, "how long an entry waits to be mined before it is dropped")
+
+// The Middleware checks copies of the chain with the Peers' consensus rules, so it must use the same values as them
+var initialReward = flag.Int("reward", blockchain.REWARD_AMOUNT, "block reward of the first block")
+var halvingInterval = flag.Int("halving", 0, "number of blocks after which the block reward halves, never if 0")
+var tailReward = flag.Int("tailreward", 0, "smallest block reward, which halvings never go below")
+var supplyCap = flag.Int("supplycap", 0, "most currency that block rewards will ever create, unlimited if 0")
+var difficulty = flag.Int("difficulty", 6, "proof of work difficulty of the first block, as a number of leading zero hex characters")
+var retargetInterval = flag.Int("retarget", 10, "number of blocks after which the proof of work difficulty is adjusted, never if 0")
+var targetBlockTime = flag.Duration("blocktime", 30*time.Second, "average time between blocks that the proof of work difficulty is adjusted towards")
+var finalityDepth = flag.Int("finality", blockchain.DEFAULT_FINALITY_DEPTH, "number of blocks built on top of a proof of stake block that make it final")
 
 func init() {
 
 	communicator = &blockchain.Communicator{}
+	proofOfWork = &blockchain.ProofOfWork{}
+	proofOfStake = &blockchain.ProofOfStake{}
 }
 
 // ============================ Main ============================
 
 func main() {
 
+	flag.Parse()
+	communicator.Transport = *transport
+	communicator.BindAddress = *bindAddress
+	communicator.ExternalAddress = *externalAddress
+	communicator.DisableZeroConf = *noZeroConf
+	if *seeds != "" {
+		communicator.Seeds = strings.Split(*seeds, ",")
+	}
+	rewards := blockchain.RewardSchedule{InitialReward: initialReward, HalvingInterval: *halvingInterval, TailReward: *tailReward, SupplyCap: *supplyCap}
+	proofOfWork.Rewards = rewards
+	proofOfWork.ProofDifficulty = *difficulty
+	proofOfWork.RetargetInterval = *retargetInterval
+	proofOfWork.TargetBlockTime = *targetBlockTime
+	proofOfStake.FinalityDepth = *finalityDepth
+	proofOfStake.Rewards = rewards
+
+	if *genesisFile != "" {
+		genesis, err := blockchain.LoadGenesis(*genesisFile)
+		if err == nil {
+			err = blockchain.SetGenesis(genesis)
+		}
+		if err != nil {
+			fmt.Printf("Fatal error loading genesis: %+v\n", err)
+			return
+		}
+	}
+
 	// start middleware
 	fmt.Println("\nStarting Blockchain Middleware...")
-	m, err := blockchain.NewMiddleware(communicator, 8080, 8090)
+	mempool := &blockchain.Mempool{MaxSize: *mempoolSize, Expiry: *mempoolExpiry}
+
+	// The Middleware must use the same consensus mechanism as the Peers, see src/peer/main.go
+
+	// Proof of Work
+	// m, err := blockchain.NewMiddleware(communicator, proofOfWork, 8080, 8090, blockSize, mempool)
+
+	// Proof of Stake
+	m, err := blockchain.NewMiddleware(communicator, proofOfStake, 8080, 8090, blockSize, mempool)
 	if err != nil {
 		fmt.Printf("Fatal error creating Blockchain Middleware: %+v\n", err)
 	} else {
@@ -2,33 +2,114 @@ package main
 
 import (
 	"blockchain"
+	"flag"
 	"fmt"
+	"strings"
+	"time"
 )
 
 var communicator *blockchain.Communicator
 var proofOfWork *blockchain.ProofOfWork
 var proofOfStake *blockchain.ProofOfStake
 var client *blockchain.Client
+var storage *blockchain.FileStorage
+
+// Each Peer running on the same machine needs its own data directory
+var dataDir = flag.String("datadir", "chaindata", "directory that this Peer's copy of the chain is stored in")
+
+// Each Peer running on the same machine can share a keystore, but should use its own account
+var keystoreDir = flag.String("keystore", "keystore", "directory that the encrypted keys of this Peer's accounts are stored in")
+var account = flag.String("account", blockchain.DEFAULT_ACCOUNT, "name of the account to use, which is created if it doesn't exist")
+
+// Every node on the network must use the same transport
+var transport = flag.String("transport", "tcp", "transport that messages are sent over, either tcp or udp")
+
+// Every node on the network must be started with the same genesis allocations
+var genesisFile = flag.String("genesis", "", "JSON file listing the currency allocated to accounts in the genesis block, none if empty")
+
+// Addresses are needed when running on several machines, network namespaces or loopback aliases
+var bindAddress = flag.String("bind", "", "IPv4 or IPv6 address to listen on, every interface by default")
+var externalAddress = flag.String("external", "", "host or host:port that other nodes reach this node at, detected by default")
+
+// Seed nodes are needed on networks that block the multicast used by ZeroConf discovery
+var noZeroConf = flag.Bool("nozeroconf", false, "don't discover nodes through ZeroConf, which needs multicast")
+var seeds = flag.String("seeds", "", "comma separated host:port addresses of nodes to join the network through")
+var middlewareAddress = flag.String("middleware", "", "host:port address of the Middleware, which is otherwise found on port 8080")
+var middlewareURL = flag.String("middlewareurl", blockchain.MIDDLEWARE_URL, "URL of the Middleware's http server")
+
+// The reward schedule is a consensus rule, so every Peer on the network must use the same values
+var initialReward = flag.Int("reward", blockchain.REWARD_AMOUNT, "block reward of the first block")
+var halvingInterval = flag.Int("halving", 0, "number of blocks after which the block reward halves, never if 0")
+var tailReward = flag.Int("tailreward", 0, "smallest block reward, which halvings never go below")
+var supplyCap = flag.Int("supplycap", 0, "most currency that block rewards will ever create, unlimited if 0")
+
+// The proof of work difficulty is also a consensus rule
+var difficulty = flag.Int("difficulty", 6, "proof of work difficulty of the first block, as a number of leading zero hex characters")
+var retargetInterval = flag.Int("retarget", 10, "number of blocks after which the proof of work difficulty is adjusted, never if 0")
+var targetBlockTime = flag.Duration("blocktime", 30*time.Second, "average time between blocks that the proof of work difficulty is adjusted towards")
+
+// So is the number of blocks after which a proof of stake block can no longer be replaced
+var finalityDepth = flag.Int("finality", blockchain.DEFAULT_FINALITY_DEPTH, "number of blocks built on top of a proof of stake block that make it final")
+
+// Unlike these consensus rules, the number of mining goroutines only affects this Peer
+var workers = flag.Int("workers", 0, "number of goroutines that mine proof of work blocks at once, one per CPU if 0")
 
 func init() {
 
 	communicator = &blockchain.Communicator{}
-	proofOfWork = &blockchain.ProofOfWork{ProofDifficulty: 6}
+	proofOfWork = &blockchain.ProofOfWork{}
 	proofOfStake = &blockchain.ProofOfStake{}
 	client = &blockchain.Client{}
+	storage = &blockchain.FileStorage{}
 }
 
 // ============================ Main ============================
 
 func main() {
 
+	flag.Parse()
+	storage.Directory = *dataDir
+	communicator.Transport = *transport
+	communicator.BindAddress = *bindAddress
+	communicator.ExternalAddress = *externalAddress
+	communicator.MiddlewareAddress = *middlewareAddress
+	communicator.DisableZeroConf = *noZeroConf
+	if *seeds != "" {
+		communicator.Seeds = strings.Split(*seeds, ",")
+	}
+	client.MiddlewareURL = *middlewareURL
+	client.KeystoreDirectory = *keystoreDir
+	client.Account = *account
+	rewards := blockchain.RewardSchedule{InitialReward: initialReward, HalvingInterval: *halvingInterval, TailReward: *tailReward, SupplyCap: *supplyCap}
+	proofOfWork.Rewards = rewards
+	proofOfWork.ProofDifficulty = *difficulty
+	proofOfWork.RetargetInterval = *retargetInterval
+	proofOfWork.TargetBlockTime = *targetBlockTime
+	proofOfWork.Workers = *workers
+	proofOfStake.FinalityDepth = *finalityDepth
+	proofOfStake.Rewards = rewards
+
+	if *genesisFile != "" {
+		genesis, err := blockchain.LoadGenesis(*genesisFile)
+		if err == nil {
+			err = blockchain.SetGenesis(genesis)
+		}
+		if err != nil {
+			fmt.Printf("Fatal error loading genesis: %+v\n", err)
+			return
+		}
+	}
+
 	fmt.Println("\nStarting Blockchain Peer...")
 
 	// Proof of Work
-	// bc, err := blockchain.NewPeer(communicator, proofOfWork, client)
+	// bc, err := blockchain.NewPeer(communicator, proofOfWork, client, storage)
 
 	// Proof of Stake
-	bc, err := blockchain.NewPeer(communicator, proofOfStake, client)
+	bc, err := blockchain.NewPeer(communicator, proofOfStake, client, storage)
+
+	// Light client, which stores only block headers and verifies transactions with Merkle proofs. Only Proof of Work is supported
+	// bc, err := blockchain.NewLightPeer(communicator, proofOfWork, client)
 
 	if err != nil {
 		fmt.Printf("Fatal error creating Blockchain Peer: %+v\n", err)